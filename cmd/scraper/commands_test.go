@@ -0,0 +1,655 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"go.opentelemetry.io/otel"
+)
+
+func writeBooks(t *testing.T, path string, books ...*models.Book) {
+	t.Helper()
+	writer, err := createWriter(formatForPath(path), path, writerOptions{})
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	if err := writer.Write(books); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func testBook(n int, price string) *models.Book {
+	return &models.Book{
+		Title:      fmt.Sprintf("Book %d", n),
+		Price:      price,
+		RatingText: "Two",
+		URL:        fmt.Sprintf("http://example.test/book-%d", n),
+		ScrapedAt:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestExecute_Dispatch(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+		out  string
+	}{
+		{"help lists commands", []string{"help"}, 0, "replay"},
+		{"command help", []string{"help", "diff"}, 0, "usage: scraper diff [flags] OLD NEW"},
+		{"help lists exit codes", []string{"help", "crawl"}, 0, "degraded run: over -max-error-rate"},
+		{"unknown command", []string{"scrape"}, 2, `unknown command "scrape"`},
+		{"bad flag", []string{"crawl", "-nope"}, 2, "flag provided but not defined"},
+		{"bare flags run crawl", []string{"-pages", "0"}, exitConfig, ""},
+		{"diff arity", []string{"diff", "a.csv"}, 2, "two output files"},
+		{"schema", []string{"schema", "-fields", "url,title,scraped_at"}, 0, `"format": "date-time"`},
+		{"schema unknown field", []string{"schema", "-exclude-fields", "author"}, exitConfig, `unknown field "author"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := execute(tt.args, &stdout, &stderr, envMap(nil)); code != tt.code {
+				t.Fatalf("exit code = %d, want %d (stderr: %s)", code, tt.code, stderr.String())
+			}
+			if !strings.Contains(stdout.String()+stderr.String(), tt.out) {
+				t.Fatalf("output missing %q:\n%s%s", tt.out, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestExecute_DiffConvertValidate(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.csv")
+	newPath := filepath.Join(dir, "new.jsonl")
+	writeBooks(t, oldPath, testBook(1, "10.00"), testBook(2, "11.00"), testBook(3, "12.00"))
+	writeBooks(t, newPath, testBook(1, "10.00"), testBook(2, "15.00"), testBook(4, "13.00"))
+
+	var stdout, stderr bytes.Buffer
+	if code := execute([]string{"diff", oldPath, newPath}, &stdout, &stderr, envMap(nil)); code != 1 {
+		t.Fatalf("diff exit code = %d, want 1 (stderr: %s)", code, stderr.String())
+	}
+	for _, want := range []string{
+		"- http://example.test/book-3",
+		"+ http://example.test/book-4",
+		`~ http://example.test/book-2  price: "11.00" -> "15.00"`,
+		"1 added, 1 removed, 1 changed, 1 unchanged",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("diff output missing %q:\n%s", want, stdout.String())
+		}
+	}
+
+	converted := filepath.Join(dir, "old.json")
+	stdout.Reset()
+	if code := execute([]string{"convert", oldPath, converted}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("convert exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	stdout.Reset()
+	if code := execute([]string{"diff", oldPath, converted}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("diff after convert exit code = %d, output:\n%s", code, stdout.String())
+	}
+	for _, name := range []string{"old.arrow", "old.parquet", "old.avro", "old.xlsx", "old.html"} {
+		columnar := filepath.Join(dir, name)
+		if code := execute([]string{"convert", converted, columnar}, &stdout, &stderr, envMap(nil)); code != 0 {
+			t.Fatalf("convert to %s exit code = %d (stderr: %s)", name, code, stderr.String())
+		}
+		stdout.Reset()
+		if code := execute([]string{"diff", oldPath, columnar}, &stdout, &stderr, envMap(nil)); code != 0 {
+			t.Fatalf("diff after convert to %s exit code = %d, output:\n%s", name, code, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if code := execute([]string{"validate", converted}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("validate exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "3 records ok") {
+		t.Fatalf("validate output: %s", stdout.String())
+	}
+
+	dupes := filepath.Join(dir, "dupes.csv")
+	writeBooks(t, dupes, testBook(1, "10.00"), testBook(1, "10.00"), testBook(2, ""))
+	stderr.Reset()
+	if code := execute([]string{"validate", dupes}, &stdout, &stderr, envMap(nil)); code != exitOutputInvalid {
+		t.Fatalf("validate exit code = %d, want %d", code, exitOutputInvalid)
+	}
+	for _, want := range []string{"duplicate url", "missing price"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("validate stderr missing %q:\n%s", want, stderr.String())
+		}
+	}
+}
+
+func TestExecute_ConvertNormalizeDedupe(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "merged.jsonl")
+	first := testBook(1, " £1,234.50 ")
+	second := testBook(2, "free")
+	writeBooks(t, in, first, second, testBook(1, "£9.99"))
+
+	out := filepath.Join(dir, "merged.parquet")
+	var stdout, stderr bytes.Buffer
+	if code := execute([]string{"convert", "-normalize", "-dedupe", in, out}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("convert exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if want := "converted 2 records from " + in + " to " + out + ", dropped 1 duplicate URLs, 1 with unparseable prices\n"; stdout.String() != want {
+		t.Fatalf("convert output = %q, want %q", stdout.String(), want)
+	}
+
+	books, err := pipeline.ReadAll(out)
+	if err != nil {
+		t.Fatalf("read converted: %v", err)
+	}
+	if len(books) != 2 {
+		t.Fatalf("converted books = %d, want 2", len(books))
+	}
+	if b := books[0]; b.URL != first.URL || b.Price != "1,234.50" || b.PriceNumeric != 1234.5 || b.RatingNumeric != 2 {
+		t.Errorf("first book = %+v, want normalized", b)
+	}
+
+	// Without the flags records pass through untouched.
+	stdout.Reset()
+	if code := execute([]string{"convert", in, filepath.Join(dir, "raw.csv")}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("convert exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "converted 3 records") {
+		t.Errorf("convert output = %q", stdout.String())
+	}
+}
+
+func TestExecute_ConvertValidatesOutput(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "empty.csv")
+	writeBooks(t, in)
+	out := filepath.Join(dir, "books.jsonl")
+	if err := os.WriteFile(out, []byte("previous\n"), 0o644); err != nil {
+		t.Fatalf("write previous output: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := execute([]string{"convert", in, out}, &stdout, &stderr, envMap(nil)); code != 1 {
+		t.Fatalf("convert exit code = %d, want 1 (stderr: %s)", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "validate "+out) {
+		t.Errorf("convert stderr = %q, want a validation error", stderr.String())
+	}
+	// The invalid output is discarded, not published over the previous one.
+	if data, err := os.ReadFile(out); err != nil || string(data) != "previous\n" {
+		t.Fatalf("output = %q, %v; want the previous file untouched", data, err)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(tmps) != 0 {
+		t.Errorf("temp files left behind: %v", tmps)
+	}
+}
+
+func TestExecute_Replay(t *testing.T) {
+	srv := catalogServer(t, 3, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	urls := filepath.Join(dir, "failed.txt")
+	if err := os.WriteFile(urls, []byte("# failed last night\n"+srv.URL+"/page-7.html\n\n"), 0o644); err != nil {
+		t.Fatalf("write url list: %v", err)
+	}
+	output := filepath.Join(dir, "replay.csv")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"replay", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0", "-output", output, urls}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("replay exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	books, err := pipeline.ReadAll(output)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if len(books) != 3 {
+		t.Fatalf("books = %d, want 3", len(books))
+	}
+
+	if err := os.WriteFile(urls, []byte("http://elsewhere.test/\n"), 0o644); err != nil {
+		t.Fatalf("write url list: %v", err)
+	}
+	args[len(args)-1] = urls
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != exitCrawlAborted {
+		t.Fatalf("replay of an unconfigured host: exit code = %d, want %d", code, exitCrawlAborted)
+	}
+}
+
+func TestExecute_TraceFile(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	srv := catalogServer(t, 3, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	traces := filepath.Join(dir, "spans.jsonl")
+	var stdout, stderr bytes.Buffer
+	args := []string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+		"-output", filepath.Join(dir, "books.csv"), "-trace-exporter", "file", "-trace-file", traces}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("crawl exit code = %d (stderr: %s)", code, stderr.String())
+	}
+
+	f, err := os.Open(traces)
+	if err != nil {
+		t.Fatalf("open trace file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	type exportedSpan struct {
+		Name        string
+		SpanContext struct{ TraceID string }
+	}
+	traceIDs := map[string]bool{}
+	names := map[string]int{}
+	decoder := json.NewDecoder(f)
+	for {
+		var span exportedSpan
+		if err := decoder.Decode(&span); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("decode span: %v", err)
+		}
+		names[span.Name]++
+		traceIDs[span.SpanContext.TraceID] = true
+	}
+	for _, name := range []string{"crawl", "scraper.crawl", "scraper.request", "scraper.extract", "pipeline.enqueue", "pipeline.prepare", "pipeline.flush"} {
+		if names[name] == 0 {
+			t.Fatalf("no %s span exported; got %v", name, names)
+		}
+	}
+	if len(traceIDs) != 1 {
+		t.Fatalf("spans belong to %d traces, want 1", len(traceIDs))
+	}
+}
+
+func TestExecute_Report(t *testing.T) {
+	srv := catalogServer(t, 3, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "books.csv")
+	report := filepath.Join(dir, "reports", "run-{{.Run}}.json")
+	baseURL := strings.Replace(srv.URL, "http://", "http://crawler:s3cret@", 1)
+	var stdout, stderr bytes.Buffer
+	args := []string{"crawl", "-base-url", baseURL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+		"-format", "dual", "-output", output, "-report", report, "-http-headers", "X-Api-Key=k3y"}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("crawl exit code = %d (stderr: %s)", code, stderr.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "reports", "run-1.json"))
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Fatal("report leaks the base URL password")
+	}
+	if strings.Contains(string(data), "k3y") {
+		t.Fatal("report leaks the http headers")
+	}
+	var rep runReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if rep.ExitCode != 0 || rep.Error != "" || rep.FinishedAt.Before(rep.StartedAt) {
+		t.Fatalf("report header = %+v", rep)
+	}
+	if rep.Result == nil || rep.Result.RequestCount != 1 || rep.Result.FailedURLs == nil || rep.Latency.Count != 1 || rep.Latency.P99 <= 0 {
+		t.Fatalf("report result = %+v latency = %+v", rep.Result, rep.Latency)
+	}
+	if rep.Pipeline == nil || rep.Pipeline.Processed != 3 || rep.Throughput.ItemsPerSecond <= 0 {
+		t.Fatalf("report pipeline = %+v throughput = %+v", rep.Pipeline, rep.Throughput)
+	}
+	if len(rep.Outputs) != 2 {
+		t.Fatalf("report outputs = %+v, want the CSV and its JSON sibling", rep.Outputs)
+	}
+	for _, out := range rep.Outputs {
+		content, err := os.ReadFile(out.Path)
+		if err != nil {
+			t.Fatalf("read output: %v", err)
+		}
+		sum := sha256.Sum256(content)
+		if out.Records != 3 || out.Bytes != int64(len(content)) || out.SHA256 != hex.EncodeToString(sum[:]) || out.Error != "" {
+			t.Fatalf("output entry = %+v", out)
+		}
+	}
+}
+
+func TestWriteReport_LeavesOtherTempFilesAlone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	// Another run writing the same report is midway through its temp file.
+	other := filepath.Join(dir, ".report.json.tmp")
+	if err := os.WriteFile(other, []byte("in flight"), 0o644); err != nil {
+		t.Fatalf("write other temp file: %v", err)
+	}
+
+	if err := writeReport(path, &runReport{ExitCode: 3}); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+	var rep runReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	if err := json.Unmarshal(data, &rep); err != nil || rep.ExitCode != 3 {
+		t.Fatalf("report = %s (%v)", data, err)
+	}
+	if got, err := os.ReadFile(other); err != nil || string(got) != "in flight" {
+		t.Fatalf("other temp file = %q (%v), want it untouched", got, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("dir holds %d entries, want the report and the other temp file", len(entries))
+	}
+}
+
+func TestExecute_CompressedOutput(t *testing.T) {
+	srv := catalogServer(t, 3, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.json")
+	var stdout, stderr bytes.Buffer
+	args := []string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+		"-format", "dual", "-compress", "zstd", "-output", filepath.Join(dir, "books.csv"), "-report", report}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("crawl exit code = %d (stderr: %s)", code, stderr.String())
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	var rep runReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	want := []string{filepath.Join(dir, "books.csv.zst"), filepath.Join(dir, "books.json.zst")}
+	if len(rep.Outputs) != len(want) {
+		t.Fatalf("report outputs = %+v, want %v", rep.Outputs, want)
+	}
+	for i, out := range rep.Outputs {
+		if out.Path != want[i] || out.Compression != "zstd" || out.Records != 3 || out.RawBytes <= 0 || out.Error != "" {
+			t.Fatalf("output entry = %+v", out)
+		}
+	}
+
+	stdout.Reset()
+	if code := execute([]string{"validate", want[0], want[1]}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("validate exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	converted := filepath.Join(dir, "converted.jsonl.gz")
+	if code := execute([]string{"convert", want[0], converted}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("convert exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if books, err := pipeline.ReadAll(converted); err != nil || len(books) != 3 {
+		t.Fatalf("converted output: %d books, err %v", len(books), err)
+	}
+}
+
+func TestExecute_SelectedFields(t *testing.T) {
+	srv := catalogServer(t, 2, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "books.csv")
+	var stdout, stderr bytes.Buffer
+	args := []string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+		"-format", "dual", "-fields", "url,title,price,isbn", "-exclude-fields", "isbn", "-output", output}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("crawl exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if header, _, _ := strings.Cut(string(mustRead(t, output)), "\n"); header != "url,title,price" {
+		t.Fatalf("csv header = %q", header)
+	}
+	record, _, _ := strings.Cut(string(mustRead(t, filepath.Join(dir, "books.json"))), "\n")
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(record), &fields); err != nil {
+		t.Fatalf("decode json record: %v", err)
+	}
+	if len(fields) != 3 || fields["url"] == nil || fields["title"] == nil || fields["price"] == nil {
+		t.Fatalf("json record = %s", record)
+	}
+
+	args = []string{"crawl", "-base-url", srv.URL, "-fields", "title,price", "-output", output}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != exitConfig {
+		t.Fatalf("crawl without the url field exit code = %d, want %d", code, exitConfig)
+	}
+}
+
+func TestExecute_TemplateOutput(t *testing.T) {
+	srv := catalogServer(t, 2, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "books.md.tmpl")
+	page := `{{define "header"}}| title | price |
+|---|---|
+{{end}}{{define "row"}}| {{md .Title}} | {{fixed 2 .PriceNumeric}} |
+{{end}}{{define "footer"}}{{.Count}} books{{with .Summary}}, {{.Stats.Processed}} processed{{end}}
+{{end}}`
+	if err := os.WriteFile(tmpl, []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "books.md")
+	report := filepath.Join(dir, "report.json")
+	var stdout, stderr bytes.Buffer
+	args := []string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+		"-format", "template", "-template", tmpl, "-output", output, "-report", report}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("crawl exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(string(mustRead(t, output)), "\n"), "\n")
+	if len(lines) != 5 || lines[0] != "| title | price |" || !strings.HasPrefix(lines[2], "| ") || lines[4] != "2 books, 2 processed" {
+		t.Fatalf("template output:\n%s", strings.Join(lines, "\n"))
+	}
+	var rep runReport
+	if err := json.Unmarshal(mustRead(t, report), &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if len(rep.Outputs) != 1 || rep.Outputs[0].Error != "" {
+		t.Fatalf("report outputs = %+v", rep.Outputs)
+	}
+
+	converted := filepath.Join(dir, "converted.md")
+	csvPath := filepath.Join(dir, "books.csv")
+	writeBooks(t, csvPath, testBook(1, "10.00"))
+	if code := execute([]string{"convert", "-template", tmpl, csvPath, converted}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("convert exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if got := string(mustRead(t, converted)); !strings.Contains(got, "| Book 1 | 0.00 |") {
+		t.Fatalf("converted output:\n%s", got)
+	}
+
+	args = []string{"crawl", "-base-url", srv.URL, "-format", "template", "-output", output}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != exitConfig {
+		t.Fatalf("crawl without a template file exit code = %d, want %d", code, exitConfig)
+	}
+}
+
+func TestExecute_RotatedOutput(t *testing.T) {
+	srv := catalogServer(t, 3, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.json")
+	var stdout, stderr bytes.Buffer
+	args := []string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+		"-format", "dual", "-rotate-records", "2", "-output", filepath.Join(dir, "books.csv"), "-report", report}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("crawl exit code = %d (stderr: %s)", code, stderr.String())
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	var rep runReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	want := map[string]int{
+		"books-00001.csv":     2,
+		"books-00001.json":    2,
+		"books-00002.csv":     1,
+		"books-00002.json":    1,
+		"books.manifest.json": 0,
+	}
+	if len(rep.Outputs) != len(want) {
+		t.Fatalf("report outputs = %+v, want %v", rep.Outputs, want)
+	}
+	for _, out := range rep.Outputs {
+		records, ok := want[filepath.Base(out.Path)]
+		if !ok || out.Records != records || out.Error != "" {
+			t.Fatalf("output entry = %+v", out)
+		}
+	}
+}
+
+func TestExecute_Sinks(t *testing.T) {
+	srv := catalogServer(t, 3, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.json")
+	var stdout, stderr bytes.Buffer
+	args := []string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+		"-sink", "csv:" + filepath.Join(dir, "a.csv"), "-sink", "json:" + filepath.Join(dir, "b.jsonl.gz"), "-report", report}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("crawl exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	var rep runReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if len(rep.Outputs) != 2 || rep.Outputs[0].Records != 3 || rep.Outputs[1].Records != 3 || rep.Outputs[1].Compression != "gzip" {
+		t.Fatalf("report outputs = %+v, want both sinks with 3 records", rep.Outputs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "books.csv")); !os.IsNotExist(err) {
+		t.Fatalf("sinks should replace -output, stat err = %v", err)
+	}
+
+	// An http sink receives the records as NDJSON batches.
+	var mu sync.Mutex
+	var posted int
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		posted += bytes.Count(data, []byte("\n"))
+		mu.Unlock()
+	}))
+	defer hook.Close()
+	args = []string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+		"-sink", "csv:" + filepath.Join(dir, "d.csv"), "-sink", "http:" + hook.URL, "-http-token", "s3cret", "-report", report}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("crawl exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	mu.Lock()
+	if posted != 3 {
+		t.Fatalf("http sink received %d records, want 3", posted)
+	}
+	mu.Unlock()
+
+	// A sink that cannot be opened fails the run whatever its policy.
+	missing := filepath.Join(dir, "a.csv", "books.jsonl")
+	args = []string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false",
+		"-sink", "csv:" + filepath.Join(dir, "c.csv"), "-sink", "json:" + missing + ",on-error=best-effort"}
+	if code := execute(args, &stdout, &stderr, envMap(nil)); code != exitWriterInit {
+		t.Fatalf("crawl exit code = %d, want %d", code, exitWriterInit)
+	}
+}
+
+func TestExecute_PublishedOutput(t *testing.T) {
+	srv := catalogServer(t, 3, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	latest := filepath.Join(dir, "latest")
+	report := filepath.Join(dir, "report.json")
+	crawl := func(extra ...string) int {
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"crawl", "-base-url", srv.URL, "-pages", "1", "-respect-robots=false", "-max-retries", "0",
+			"-format", "dual", "-publish", "-output", filepath.Join(latest, "books.csv"), "-report", report}, extra...)
+		return execute(args, &stdout, &stderr, envMap(nil))
+	}
+
+	if code := crawl(); code != exitOK {
+		t.Fatalf("crawl exit code = %d", code)
+	}
+	first, err := os.Readlink(latest)
+	if err != nil {
+		t.Fatalf("outputs directory is not a symlink: %v", err)
+	}
+	for _, name := range []string{"books.csv", "books.json", pipeline.PublishManifestName} {
+		if _, err := os.Stat(filepath.Join(latest, name)); err != nil {
+			t.Fatalf("published %s: %v", name, err)
+		}
+	}
+	var rep runReport
+	if err := json.Unmarshal(mustRead(t, report), &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if len(rep.Outputs) != 2 || rep.Outputs[0].Path != filepath.Join(latest, "books.csv") || rep.Outputs[0].Records != 3 {
+		t.Fatalf("report outputs = %+v, want the published paths", rep.Outputs)
+	}
+
+	// A run that fails its thresholds is not published.
+	if code := crawl("-min-items", "10"); code != exitThreshold {
+		t.Fatalf("crawl exit code = %d, want %d", code, exitThreshold)
+	}
+	if current, _ := os.Readlink(latest); current != first {
+		t.Fatalf("failed run was published: link %s, want %s", current, first)
+	}
+	if err := json.Unmarshal(mustRead(t, report), &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if len(rep.Outputs) != 2 || filepath.Dir(rep.Outputs[0].Path) == latest {
+		t.Fatalf("report outputs = %+v, want the staged paths of the unpublished run", rep.Outputs)
+	}
+
+	if code := crawl(); code != exitOK {
+		t.Fatalf("crawl exit code = %d", code)
+	}
+	if current, _ := os.Readlink(latest); current == first {
+		t.Fatal("second successful run was not published")
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return data
+}
@@ -0,0 +1,799 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"github.com/aluiziolira/go-scrape-books/scraper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer returns the tracer of the "crawl" span every span of a run is
+// parented to.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/aluiziolira/go-scrape-books/cmd/scraper")
+}
+
+// crawlCommand runs the configured crawl. It is the default command, so the
+// flags of the original single-command CLI keep working unchanged.
+func crawlCommand(_ *flag.FlagSet) runFunc {
+	return func(ctx context.Context, inv *invocation) int {
+		if err := inv.cfg.Validate(); err != nil {
+			slog.Error("invalid configuration", slog.Any("error", err))
+			return exitConfig
+		}
+		outputFile, reportFile, err := expandRunPaths(inv.cfg, time.Now(), 1)
+		if err != nil {
+			slog.Error("invalid output path", slog.Any("error", err))
+			return exitConfig
+		}
+		return run(ctx, inv.cfg, outputFile, reportFile)
+	}
+}
+
+// replayCommand crawls the URLs listed in a file instead of the configured
+// base URLs. Each URL must belong to one of the configured sites.
+func replayCommand(_ *flag.FlagSet) runFunc {
+	return func(ctx context.Context, inv *invocation) int {
+		if len(inv.args) != 1 {
+			fmt.Fprintln(inv.stderr, "replay needs exactly one URL file (- for stdin)")
+			return exitUsage
+		}
+		urls, err := readURLList(inv.args[0], inv.stdin)
+		if err != nil {
+			fmt.Fprintln(inv.stderr, err)
+			return exitFailure
+		}
+		if len(urls) == 0 {
+			fmt.Fprintf(inv.stderr, "no URLs to replay in %s\n", inv.args[0])
+			return exitFailure
+		}
+		if err := inv.cfg.Validate(); err != nil {
+			slog.Error("invalid configuration", slog.Any("error", err))
+			return exitConfig
+		}
+		outputFile, reportFile, err := expandRunPaths(inv.cfg, time.Now(), 1)
+		if err != nil {
+			slog.Error("invalid output path", slog.Any("error", err))
+			return exitConfig
+		}
+		return crawl(ctx, inv.cfg, outputFile, reportFile, func(ctx context.Context, s *scraper.Scraper, sink scraper.Sink) (*models.ScraperResult, error) {
+			return s.Replay(ctx, sink, urls)
+		})
+	}
+}
+
+// readURLList reads one URL per line from path (or stdin for "-"), skipping
+// blank lines and # comments.
+func readURLList(path string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open url list: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read url list: %w", err)
+	}
+	return urls, nil
+}
+
+// outputPathData is what an output path template can refer to.
+type outputPathData struct {
+	Date      string // 2006-01-02
+	Time      string // 150405
+	Timestamp string // 20060102-150405
+	Run       int    // 1-based run number within this process
+}
+
+// expandOutputPath renders pattern, a text/template such as
+// "output/books-{{.Date}}.csv", for a run started at t. Plain paths are
+// returned unchanged.
+func expandOutputPath(pattern string, t time.Time, run int) (string, error) {
+	if !strings.Contains(pattern, "{{") {
+		return pattern, nil
+	}
+	return renderOutputPath(pattern, outputPathData{
+		Date:      t.Format("2006-01-02"),
+		Time:      t.Format("150405"),
+		Timestamp: t.Format("20060102-150405"),
+		Run:       run,
+	})
+}
+
+// renderOutputPath renders the output path template pattern with data.
+func renderOutputPath(pattern string, data outputPathData) (string, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return "", fmt.Errorf("parse output path template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("expand output path template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// expandRunPaths expands the output and report path templates of cfg for a
+// run started at t.
+func expandRunPaths(cfg *config.Config, t time.Time, run int) (outputFile, reportFile string, err error) {
+	if outputFile, err = expandOutputPath(withCompression(cfg.OutputFile, cfg.Compression), t, run); err != nil {
+		return "", "", err
+	}
+	if reportFile, err = expandOutputPath(cfg.ReportFile, t, run); err != nil {
+		return "", "", err
+	}
+	return outputFile, reportFile, nil
+}
+
+// visitFunc starts a crawl on s and streams the books it extracts into sink.
+type visitFunc func(ctx context.Context, s *scraper.Scraper, sink scraper.Sink) (*models.ScraperResult, error)
+
+// visitConfigured crawls every configured site from its base URL.
+func visitConfigured(ctx context.Context, s *scraper.Scraper, sink scraper.Sink) (*models.ScraperResult, error) {
+	return s.Run(ctx, sink)
+}
+
+// run executes the scrape and returns a process exit code. reportFile, if
+// set, receives the run report.
+func run(ctx context.Context, cfg *config.Config, outputFile, reportFile string) int {
+	return crawl(ctx, cfg, outputFile, reportFile, visitConfigured)
+}
+
+// crawl wires the scraper, pipeline, writer and metrics server together,
+// visits what visit asks for, and reports the outcome as an exit code.
+func crawl(ctx context.Context, cfg *config.Config, outputFile, reportFile string, visit visitFunc) int {
+	logger, level := newLogger(cfg.Verbose, logOutput(cfg))
+	slog.SetDefault(logger)
+	slog.SetLogLoggerLevel(level.Level())
+
+	r := &crawlRun{cfg: cfg, outputFile: outputFile, reportFile: reportFile, visit: visit, summary: logOutput(cfg), stdout: os.Stdout, showProgress: true}
+	return r.execute(ctx)
+}
+
+// crawlRun is one crawl from scraper construction to summary. The crawl and
+// replay commands run one and exit; serve runs one per job and watches its
+// progress while it runs.
+type crawlRun struct {
+	cfg        *config.Config
+	outputFile string
+	reportFile string // where the run report goes; empty skips it
+	visit      visitFunc
+	metrics    *scraper.Metrics     // shared registry; nil gives the run its own (and its own metrics server)
+	collectors *pipeline.Collectors // pipeline collectors registered on metrics; used only when metrics is set
+	summary    io.Writer            // printSummary destination; nil skips the summary
+	stdout     io.Writer            // where records stream when cfg.StreamsToStdout
+
+	showProgress bool // report progress while crawling; see watchProgress
+
+	publisher *pipeline.Publisher // stages the outputs when cfg.Publish is set
+	outputs   []string            // the files written, once the writer is closed
+
+	mu       sync.Mutex
+	started  time.Time
+	scraper  *scraper.Scraper
+	pipeline *pipeline.Pipeline
+	result   *models.ScraperResult
+	err      error
+}
+
+// progress returns the scraper counters and pipeline stats so far, or the
+// final ones once the run has finished. Both are nil before the run starts.
+func (r *crawlRun) progress() (*models.ScraperResult, *pipeline.PipelineStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.scraper == nil {
+		return nil, nil
+	}
+	result := r.result
+	if result == nil {
+		result = r.scraper.Progress()
+	}
+	var stats *pipeline.PipelineStats
+	if r.pipeline != nil {
+		s := r.pipeline.GetMetrics()
+		stats = &s
+	}
+	return result, stats
+}
+
+// failure returns why the run failed, or nil.
+func (r *crawlRun) failure() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// fail logs and records a failure and returns code, its exit code.
+func (r *crawlRun) fail(code int, msg string, err error) int {
+	slog.Error(msg, slog.Any("error", err), slog.Int("exit_code", code))
+	r.mu.Lock()
+	r.err = fmt.Errorf("%s: %w", msg, err)
+	r.mu.Unlock()
+	return code
+}
+
+// execute performs the run and, when a report file is set, writes the run
+// report once the outputs are final. A report that cannot be written fails
+// the run, since whoever asked for it depends on it.
+func (r *crawlRun) execute(ctx context.Context) int {
+	started := time.Now()
+	r.mu.Lock()
+	r.started = started
+	r.mu.Unlock()
+	code := r.crawl(ctx)
+	if r.reportFile == "" {
+		return code
+	}
+	if err := writeReport(r.reportFile, r.report(started, time.Now(), code)); err != nil {
+		slog.Error("writing run report", slog.Any("error", err))
+		if code == exitOK {
+			code = exitFailure
+		}
+		return code
+	}
+	slog.Info("run report written", slog.String("path", r.reportFile))
+	return code
+}
+
+func (r *crawlRun) crawl(ctx context.Context) (code int) { //nolint:gocyclo // linear sequence of setup and teardown steps
+	cfg := r.cfg
+	ctx, span := tracer().Start(ctx, "crawl", trace.WithAttributes(
+		attribute.String("output.path", r.outputFile),
+		attribute.String("output.format", cfg.OutputFormat),
+	))
+	defer func() {
+		if err := r.failure(); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	for _, site := range cfg.ResolvedSites() {
+		slog.Info("starting scrape",
+			slog.String("site", site.Name),
+			slog.String("base_url", site.BaseURL),
+			slog.Int("pages", site.MaxPages),
+			slog.Int("workers", site.Parallelism),
+			slog.String("profile", site.Profile),
+		)
+	}
+
+	metrics, collectors := r.metrics, r.collectors
+	if metrics == nil {
+		metrics = scraper.NewMetrics()
+		collectors = pipeline.NewCollectors(metrics.Registry)
+	}
+	s, err := scraper.NewScraperWithMetrics(cfg, metrics)
+	if err != nil {
+		return r.fail(exitConfig, "initialising scraper", err)
+	}
+
+	var baseline *scraper.HealthBaseline
+	if cfg.HealthBaseline != "" {
+		baseline, err = scraper.LoadHealthBaseline(cfg.HealthBaseline)
+		if err != nil {
+			return r.fail(exitConfig, "loading health baseline", err)
+		}
+	}
+
+	writer, err := r.openWriter()
+	if err != nil {
+		return r.fail(exitWriterInit, "creating writer", err)
+	}
+	defer func() {
+		code = r.closeWriter(writer, code)
+		// Only a successful run may become the baseline later runs are
+		// checked against.
+		if code == exitOK && cfg.UpdateHealthBaseline {
+			r.updateHealthBaseline(baseline)
+		}
+	}()
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			slog.Info("shutdown signal received, waiting for in-flight work to finish")
+		case <-finished:
+		}
+	}()
+
+	var metricsServer *http.Server
+	if r.metrics == nil && cfg.MetricsAddr != "" {
+		metricsServer = startMetricsServer(ctx, cfg.MetricsAddr, metrics.Registry, endpoints{pprof: cfg.Pprof, ready: r.ready, status: func() any { return r.status() }})
+	}
+
+	p := pipeline.NewPipelineWithCollectors(ctx, writer, cfg, collectors)
+	p.Start(cfg.Parallelism)
+	if cfg.Verbose {
+		p.StartMetricsReporting(10 * time.Second)
+	}
+	r.mu.Lock()
+	r.scraper, r.pipeline = s, p
+	r.mu.Unlock()
+
+	startTime := time.Now()
+	stopProgress := r.watchProgress(startTime)
+	result, err := r.visit(ctx, s, p)
+	stopProgress()
+	if err != nil {
+		shutdownMetricsServer(metricsServer, 5*time.Second)
+		return r.failStep(ctx, exitCrawlAborted, "scraping failed", err)
+	}
+	r.mu.Lock()
+	r.result = result
+	r.mu.Unlock()
+
+	if err := p.Close(); err != nil {
+		shutdownMetricsServer(metricsServer, 5*time.Second)
+		if errors.Is(err, pipeline.ErrWriteBatch) {
+			return r.failStep(ctx, exitOutputInvalid, "writing output failed", err)
+		}
+		return r.failStep(ctx, exitCrawlAborted, "pipeline shutdown failed", err)
+	}
+
+	pipeline.SetSummary(writer, pipeline.RunSummary{Result: result, Stats: p.GetMetrics()})
+	if err := writer.Validate(); err != nil {
+		shutdownMetricsServer(metricsServer, 5*time.Second)
+		return r.failStep(ctx, exitOutputInvalid, "output validation failed", err)
+	}
+
+	warnings := s.CheckHealth(result, baseline, cfg.HealthTolerance)
+	shutdownMetricsServer(metricsServer, 5*time.Second)
+
+	stats := p.GetMetrics()
+	duration := time.Since(startTime)
+	totalItems := stats.Processed
+	itemsPerSec := 0.0
+	if duration.Seconds() > 0 {
+		itemsPerSec = float64(totalItems) / duration.Seconds()
+	}
+
+	if r.summary != nil {
+		printSummary(r.summary, result, duration, itemsPerSec, runOutputSummary(r.cfg, r.outputFile), stats)
+	}
+	if ctx.Err() != nil {
+		return r.fail(exitInterrupted, "crawl interrupted", context.Cause(ctx))
+	}
+	if cfg.FailOnDrift && len(warnings) > 0 {
+		return r.fail(exitThreshold, "extraction health check failed", fmt.Errorf("%d warnings", len(warnings)))
+	}
+	if err := checkThresholds(cfg, result, stats); err != nil {
+		return r.fail(exitThreshold, "run below thresholds", err)
+	}
+	return exitOK
+}
+
+// failStep is fail for a step of the run that failed, unless ctx is done:
+// the interrupt most likely caused the failure, so the run reports that.
+func (r *crawlRun) failStep(ctx context.Context, code int, msg string, err error) int {
+	if ctx.Err() != nil {
+		return r.fail(exitInterrupted, "crawl interrupted", fmt.Errorf("%s: %w", msg, err))
+	}
+	return r.fail(code, msg, err)
+}
+
+// updateHealthBaseline folds the run's result into baseline and saves it. A
+// baseline that cannot be saved is logged but does not fail the run.
+func (r *crawlRun) updateHealthBaseline(baseline *scraper.HealthBaseline) {
+	r.mu.Lock()
+	result := r.result
+	r.mu.Unlock()
+	baseline.Update(result)
+	if err := baseline.Save(r.cfg.HealthBaseline); err != nil {
+		slog.Error("saving health baseline", slog.Any("error", err))
+		return
+	}
+	slog.Info("health baseline updated", slog.String("path", r.cfg.HealthBaseline))
+}
+
+// openWriter creates the writer of the run. Output to stdout is streamed as
+// it comes; with cfg.Publish the outputs are staged in a new run directory
+// for closeWriter to publish.
+func (r *crawlRun) openWriter() (pipeline.OutputWriter, error) {
+	if r.cfg.StreamsToStdout() {
+		fields, err := r.cfg.OutputFields()
+		if err != nil {
+			return nil, fmt.Errorf("invalid output fields: %w", err)
+		}
+		return pipeline.NewStreamWriter(r.stdout, r.cfg.OutputFormat, fields...)
+	}
+	if !r.cfg.Publish {
+		return createRunWriter(r.cfg, r.outputFile)
+	}
+	pub, err := pipeline.NewPublisher(publishDir(r.cfg, r.outputFile), r.cfg.Retain)
+	if err != nil {
+		return nil, err
+	}
+	r.publisher = pub
+	writer, err := createRunWriter(stageOutputs(r.cfg, r.outputFile, pub))
+	if err != nil {
+		pub.Abandon()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// closeWriter closes writer and records what the run wrote. When publishing,
+// the outputs are published only if the run succeeded; otherwise they stay
+// staged and the previous run remains current. It returns the exit code of
+// the run, code unless publishing fails.
+func (r *crawlRun) closeWriter(writer pipeline.OutputWriter, code int) int {
+	closeErr := writer.Close()
+	if closeErr != nil {
+		slog.Error("close writer", slog.Any("error", closeErr))
+	}
+	pub := r.publisher
+	if pub == nil {
+		r.outputs = runOutputFiles(r.cfg, r.outputFile)
+		return code
+	}
+
+	err := closeErr
+	if code == exitOK && err == nil {
+		if err = pub.Publish(); err == nil {
+			slog.Info("outputs published", slog.String("dir", publishDir(r.cfg, r.outputFile)), slog.String("run", pub.Dir()))
+			r.outputs = runOutputFiles(r.cfg, r.outputFile)
+			return code
+		}
+	}
+	pub.Abandon()
+	r.outputs = runOutputFiles(stageOutputs(r.cfg, r.outputFile, pub))
+	if code == exitOK {
+		code = r.fail(exitOutputInvalid, "publishing outputs", err)
+	}
+	return code
+}
+
+// publishDir returns the directory the file outputs of a run share, which
+// cfg.Validate checks when publishing.
+func publishDir(cfg *config.Config, filename string) string {
+	for _, sink := range runSinks(cfg, filename) {
+		if sink.IsFile() {
+			return filepath.Dir(sink.Path)
+		}
+	}
+	return filepath.Dir(filename)
+}
+
+// stageOutputs returns cfg and filename with every output moved into the
+// staging directory of pub.
+func stageOutputs(cfg *config.Config, filename string, pub *pipeline.Publisher) (*config.Config, string) {
+	staged := *cfg
+	staged.Sinks = make([]config.SinkConfig, len(cfg.Sinks))
+	for i, sink := range cfg.Sinks {
+		if sink.IsFile() {
+			sink.Path = pub.Path(sink.Path)
+		}
+		staged.Sinks[i] = sink
+	}
+	return &staged, pub.Path(filename)
+}
+
+// checkThresholds turns a degraded run into a failure: more than
+// cfg.MaxErrorRate of the requests failed, or fewer than cfg.MinItems items
+// were written.
+func checkThresholds(cfg *config.Config, result *models.ScraperResult, stats pipeline.PipelineStats) error {
+	var errs []error
+	if result.RequestCount > 0 {
+		if rate := float64(result.ErrorCount) / float64(result.RequestCount); rate > cfg.MaxErrorRate {
+			errs = append(errs, fmt.Errorf("error rate %.2f exceeds the maximum of %.2f", rate, cfg.MaxErrorRate))
+		}
+	}
+	if stats.Processed < int64(cfg.MinItems) {
+		errs = append(errs, fmt.Errorf("%d items is below the minimum of %d", stats.Processed, cfg.MinItems))
+	}
+	return errors.Join(errs...)
+}
+
+// startMetricsServer launches the Prometheus metrics HTTP server, which also
+// serves the routes of e. It returns nil when addr is empty (metrics
+// disabled).
+func startMetricsServer(ctx context.Context, addr string, registry *prometheus.Registry, e endpoints) *http.Server {
+	_ = ctx
+	if addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	e.register(mux)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server failed", slog.Any("error", err))
+		}
+	}()
+	slog.Info("metrics server enabled", slog.String("addr", addr))
+	return srv
+}
+
+// shutdownMetricsServer gracefully shuts down the metrics server.
+// It is a no-op when srv is nil.
+func shutdownMetricsServer(srv *http.Server, timeout time.Duration) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("metrics server shutdown failed", slog.Any("error", err))
+	}
+}
+
+// runSinks returns the outputs of a run writing filename: cfg.Sinks when set,
+// otherwise filename in cfg.OutputFormat.
+func runSinks(cfg *config.Config, filename string) []config.SinkConfig {
+	if len(cfg.Sinks) > 0 {
+		return cfg.Sinks
+	}
+	return []config.SinkConfig{{Format: cfg.OutputFormat, Path: filename}}
+}
+
+// createRunWriter creates the writer of a run: one per sink, each sharded
+// when cfg asks for rotation, fanned out by a MultiWriter when there is more
+// than one or a sink has an error policy of its own.
+func createRunWriter(cfg *config.Config, filename string) (pipeline.OutputWriter, error) {
+	sinks := runSinks(cfg, filename)
+	open := func(sink config.SinkConfig) (pipeline.OutputWriter, error) {
+		return createSinkWriter(cfg, sink)
+	}
+	if len(sinks) == 1 && (sinks[0].OnError == "" || pipeline.ErrorPolicy(sinks[0].OnError) == pipeline.FailFast) {
+		return open(sinks[0])
+	}
+	if cfg.Rotates() {
+		manifests := make(map[string]string, len(sinks))
+		for _, sink := range sinks {
+			if !sink.IsFile() {
+				continue
+			}
+			manifest := pipeline.ManifestPath(sink.Path)
+			if other, ok := manifests[manifest]; ok {
+				return nil, fmt.Errorf("sinks %s and %s would share the manifest %s", other, sink.Path, manifest)
+			}
+			manifests[manifest] = sink.Path
+		}
+	}
+	return openSinks(sinks, open)
+}
+
+// createSinkWriter creates the writer of one sink, wrapped in a
+// RotatingWriter when cfg asks for rotation and the sink writes files.
+func createSinkWriter(cfg *config.Config, sink config.SinkConfig) (pipeline.OutputWriter, error) {
+	fields, err := cfg.OutputFields()
+	if err != nil {
+		return nil, fmt.Errorf("invalid output fields: %w", err)
+	}
+	if !sink.IsFile() {
+		return createHTTPWriter(cfg, sink.Path, fields)
+	}
+	opts := writerOptions{Fields: fields, Template: cfg.TemplateFile}
+	if !cfg.Rotates() {
+		return createWriter(sink.Format, sink.Path, opts)
+	}
+	rotation := pipeline.RotationConfig{
+		MaxRecords:  cfg.RotateRecords,
+		MaxBytes:    int64(cfg.RotateBytes),
+		PartitionBy: cfg.PartitionBy,
+		Files:       func(shard string) []string { return outputFiles(sink.Format, shard) },
+	}
+	return pipeline.NewRotatingWriter(sink.Path, rotation, func(shard string) (pipeline.OutputWriter, error) {
+		return createWriter(sink.Format, shard, opts)
+	})
+}
+
+// createHTTPWriter creates the writer of an http sink posting the fields of
+// each record to url.
+func createHTTPWriter(cfg *config.Config, url string, fields []models.Field) (pipeline.OutputWriter, error) {
+	headers, err := cfg.ParseHTTPHeaders()
+	if err != nil {
+		return nil, fmt.Errorf("invalid http headers: %w", err)
+	}
+	return pipeline.NewHTTPWriter(pipeline.HTTPWriterConfig{
+		URL:        url,
+		Body:       cfg.HTTPBody,
+		Headers:    headers,
+		Token:      cfg.HTTPToken,
+		Gzip:       cfg.HTTPGzip,
+		Fields:     fields,
+		MaxRetries: cfg.HTTPRetries,
+		Backoff:    cfg.RetryBackoff,
+		BackoffMax: cfg.RetryBackoffMax,
+		Client:     &http.Client{Timeout: cfg.Timeout},
+	})
+}
+
+// openSinks opens a writer for each of sinks with open and fans out to them.
+// If one cannot be opened, those already open are aborted, leaving their
+// previous outputs in place.
+func openSinks(sinks []config.SinkConfig, open func(config.SinkConfig) (pipeline.OutputWriter, error)) (*pipeline.MultiWriter, error) {
+	outs := make([]pipeline.Sink, 0, len(sinks))
+	for _, sink := range sinks {
+		w, err := open(sink)
+		if err != nil {
+			for _, out := range outs {
+				_ = pipeline.Abort(out.Writer)
+			}
+			return nil, fmt.Errorf("open sink %s: %w", sink.Path, err)
+		}
+		outs = append(outs, pipeline.Sink{Name: sink.Path, Writer: w, Policy: pipeline.ErrorPolicy(sink.OnError)})
+	}
+	return pipeline.NewMultiWriter(outs...)
+}
+
+// writerOptions are the settings createWriter passes on to the writers.
+type writerOptions struct {
+	Fields   []models.Field // fields to write; nil writes every field
+	Template string         // template file of the template format
+}
+
+// createWriter creates the writer for one file in format. The dual format is
+// shorthand for a CSV sink at filename and a JSON sink at its dualJSONPath.
+func createWriter(format, filename string, opts writerOptions) (pipeline.OutputWriter, error) {
+	switch format {
+	case "template":
+		return pipeline.NewTemplateWriter(filename, opts.Template, opts.Fields...)
+	case "dual":
+		return openSinks([]config.SinkConfig{
+			{Format: "csv", Path: filename},
+			{Format: "json", Path: dualJSONPath(filename)},
+		}, func(sink config.SinkConfig) (pipeline.OutputWriter, error) {
+			return createWriter(sink.Format, sink.Path, opts)
+		})
+	}
+	f, ok := pipeline.LookupFormat(format)
+	if !ok {
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	return f.NewWriter(filename, opts.Fields...)
+}
+
+// dualJSONPath is the JSON sibling the dual format writes next to filename.
+func dualJSONPath(filename string) string {
+	ext := pipeline.CompressionExt(pipeline.CompressionForPath(filename))
+	return strings.TrimSuffix(pipeline.TrimCompressionExt(filename), ".csv") + ".json" + ext
+}
+
+// withCompression adds the extension of codec to filename unless it already
+// ends in it; the writers pick their compression from the extension.
+func withCompression(filename, codec string) string {
+	if codec == "" || pipeline.CompressionForPath(filename) == codec {
+		return filename
+	}
+	return filename + pipeline.CompressionExt(codec)
+}
+
+// runOutputFiles lists the files a run with cfg wrote for filename: those of
+// every sink, which for a rotated sink are the shards listed in its manifest
+// and the manifest itself.
+func runOutputFiles(cfg *config.Config, filename string) []string {
+	var files []string
+	for _, sink := range runSinks(cfg, filename) {
+		if !sink.IsFile() {
+			continue
+		}
+		if !cfg.Rotates() {
+			files = append(files, outputFiles(sink.Format, sink.Path)...)
+			continue
+		}
+		manifestPath := pipeline.ManifestPath(sink.Path)
+		m, err := pipeline.ReadManifest(manifestPath)
+		if err != nil {
+			continue
+		}
+		for _, s := range m.Shards {
+			files = append(files, filepath.Join(filepath.Dir(manifestPath), s.Path))
+		}
+		files = append(files, manifestPath)
+	}
+	return files
+}
+
+// runOutputSummary names the outputs of a run for its summary: the path of
+// each sink, or of its manifest when rotating.
+func runOutputSummary(cfg *config.Config, filename string) string {
+	sinks := runSinks(cfg, filename)
+	paths := make([]string, len(sinks))
+	for i, sink := range sinks {
+		paths[i] = sink.Path
+		if sink.Path == config.StdoutPath {
+			paths[i] = "stdout"
+		}
+		if cfg.Rotates() && sink.IsFile() {
+			paths[i] = pipeline.ManifestPath(sink.Path)
+		}
+	}
+	return strings.Join(paths, ", ")
+}
+
+// outputFiles lists the files a run in format writes for filename.
+func outputFiles(format, filename string) []string {
+	if format == "dual" {
+		return []string{filename, dualJSONPath(filename)}
+	}
+	return []string{filename}
+}
+
+func printSummary(w io.Writer, result *models.ScraperResult, duration time.Duration, itemsPerSec float64, outputFile string, metrics pipeline.PipelineStats) {
+	separator := "--------------------------------------------------"
+	fmt.Fprintln(w, "\n"+separator)
+	fmt.Fprintln(w, "Scrape complete")
+
+	totalItems := metrics.Processed
+
+	fmt.Fprintf(w, "  Total items:   %d\n", totalItems)
+	successRate := 0.0
+	if result.RequestCount > 0 {
+		successRate = float64(result.RequestCount-result.ErrorCount) / float64(result.RequestCount) * 100
+	}
+	fmt.Fprintf(w, "  Success rate:  %.2f%%\n", successRate)
+	fmt.Fprintf(w, "  Errors:        %d\n", result.ErrorCount)
+	fmt.Fprintf(w, "  Retries:       %d\n", result.RetryCount)
+	fmt.Fprintf(w, "  Failed URLs:   %d\n", len(result.FailedURLs))
+	if len(result.ErrorsByType) > 0 {
+		fmt.Fprintf(w, "  Error types:   %v\n", result.ErrorsByType)
+	}
+	if len(result.Domains) > 1 {
+		names := make([]string, 0, len(result.Domains))
+		for name := range result.Domains {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			d := result.Domains[name]
+			fmt.Fprintf(w, "  %-14s requests=%d pages=%d items=%d errors=%d retries=%d\n",
+				name+":", d.RequestCount, d.PageCount, d.ItemCount, d.ErrorCount, d.RetryCount)
+		}
+	}
+	if len(result.Warnings) > 0 {
+		kinds := make(map[string]int)
+		for _, w := range result.Warnings {
+			kinds[w.Kind]++
+		}
+		fmt.Fprintf(w, "  Warnings:      %v\n", kinds)
+	}
+	if valErrors := metrics.ValidationErrors; len(valErrors) > 0 {
+		fmt.Fprintf(w, "  Validation:    %v\n", valErrors)
+	}
+	fmt.Fprintf(w, "  Duration:      %v\n", duration)
+	fmt.Fprintf(w, "  Items/sec:     %.2f\n", itemsPerSec)
+	fmt.Fprintf(w, "  Output file:   %s\n", outputFile)
+	fmt.Fprintln(w, separator)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"github.com/aluiziolira/go-scrape-books/scraper"
+	"github.com/robfig/cron/v3"
+)
+
+// daemonCommand crawls on cfg.Schedule until the context is cancelled. The
+// metrics server stays up between runs, a run that is due while the previous
+// one is still going is skipped, and only the newest cfg.Retain outputs are
+// kept.
+func daemonCommand(_ *flag.FlagSet) runFunc {
+	return func(ctx context.Context, inv *invocation) int {
+		cfg := inv.cfg
+		if err := cfg.Validate(); err != nil {
+			slog.Error("invalid configuration", slog.Any("error", err))
+			return exitConfig
+		}
+		if cfg.Schedule == "" {
+			slog.Error("invalid configuration", slog.String("error", "the daemon command needs a schedule (-schedule or SCRAPER_SCHEDULE)"))
+			return exitConfig
+		}
+		schedule, err := cron.ParseStandard(cfg.Schedule)
+		if err != nil {
+			slog.Error("invalid configuration", slog.Any("error", fmt.Errorf("parse schedule %q: %w", cfg.Schedule, err)))
+			return exitConfig
+		}
+
+		metrics := scraper.NewMetrics()
+		d := &daemon{cfg: cfg, schedule: schedule, metrics: metrics, collectors: pipeline.NewCollectors(metrics.Registry)}
+		metricsServer := startMetricsServer(ctx, cfg.MetricsAddr, d.metrics.Registry, endpoints{pprof: cfg.Pprof, ready: d.ready, status: func() any { return d.status() }})
+		defer shutdownMetricsServer(metricsServer, 5*time.Second)
+
+		c := cron.New(
+			cron.WithLogger(cronLogger{}),
+			cron.WithChain(cron.Recover(cronLogger{}), cron.SkipIfStillRunning(cronLogger{})),
+		)
+		c.Schedule(schedule, cron.FuncJob(func() { d.runOnce(ctx) }))
+		c.Start()
+		slog.Info("daemon started",
+			slog.String("schedule", cfg.Schedule),
+			slog.Time("next_run", schedule.Next(time.Now())),
+			slog.String("output", cfg.OutputFile),
+			slog.Int("retain", cfg.Retain),
+		)
+
+		<-ctx.Done()
+		slog.Info("shutdown signal received, waiting for the running crawl to finish")
+		<-c.Stop().Done()
+		return 0
+	}
+}
+
+// daemon holds the state shared by scheduled runs.
+type daemon struct {
+	cfg        *config.Config
+	schedule   cron.Schedule
+	metrics    *scraper.Metrics
+	collectors *pipeline.Collectors
+	runs       atomic.Int64
+
+	mu       sync.Mutex
+	current  *crawlRun // the run in progress, if any
+	lastCode *int      // exit code of the last finished run
+}
+
+// daemonStatus is the daemon's /status body.
+type daemonStatus struct {
+	Runs         int64        `json:"runs"`
+	NextRun      time.Time    `json:"next_run"`
+	LastExitCode *int         `json:"last_exit_code,omitempty"`
+	Current      *crawlStatus `json:"current,omitempty"`
+}
+
+// ready reports the health of the run in progress; between runs the daemon
+// is always ready.
+func (d *daemon) ready() error {
+	d.mu.Lock()
+	current := d.current
+	d.mu.Unlock()
+	if current == nil {
+		return nil
+	}
+	return current.healthy()
+}
+
+func (d *daemon) status() daemonStatus {
+	d.mu.Lock()
+	current, lastCode := d.current, d.lastCode
+	d.mu.Unlock()
+	st := daemonStatus{Runs: d.runs.Load(), LastExitCode: lastCode}
+	if d.schedule != nil {
+		st.NextRun = d.schedule.Next(time.Now())
+	}
+	if current != nil {
+		cs := current.status()
+		st.Current = &cs
+	}
+	return st
+}
+
+// runOnce performs one scheduled crawl, logs its summary as a structured
+// event and prunes old outputs and run reports.
+func (d *daemon) runOnce(ctx context.Context) int {
+	n := int(d.runs.Add(1))
+	start := time.Now()
+	output, report, err := expandRunPaths(d.cfg, start, n)
+	if err != nil {
+		slog.Error("daemon run failed", slog.Int("run", n), slog.Any("error", err))
+		return exitConfig
+	}
+
+	r := &crawlRun{cfg: d.cfg, outputFile: output, reportFile: report, visit: visitConfigured, metrics: d.metrics, collectors: d.collectors}
+	d.mu.Lock()
+	d.current = r
+	d.mu.Unlock()
+	code := r.execute(ctx)
+	d.mu.Lock()
+	d.current, d.lastCode = nil, &code
+	d.mu.Unlock()
+
+	attrs := []any{
+		slog.Int("run", n),
+		slog.String("output", output),
+		slog.Int("exit_code", code),
+		slog.Duration("duration", time.Since(start)),
+	}
+	result, stats := r.progress()
+	if result != nil {
+		attrs = append(attrs,
+			slog.Int("requests", result.RequestCount),
+			slog.Int("pages", result.PageCount),
+			slog.Int("errors", result.ErrorCount),
+			slog.Int("retries", result.RetryCount),
+			slog.Int("failed_urls", len(result.FailedURLs)),
+			slog.Int("warnings", len(result.Warnings)),
+		)
+	}
+	if stats != nil {
+		attrs = append(attrs, slog.Int64("items", stats.Processed), slog.Any("validation_errors", stats.ValidationErrors))
+	}
+	if err := r.failure(); err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	level := slog.LevelInfo
+	if code != 0 {
+		level = slog.LevelError
+	}
+	slog.Log(ctx, level, "daemon run finished", attrs...)
+
+	pattern := withCompression(d.cfg.OutputFile, d.cfg.Compression)
+	pruned := pruneOutputs(pattern, d.cfg.OutputFormat, d.cfg.Retain)
+	if d.cfg.Rotates() {
+		pruned = pruneRotatedOutputs(pattern, d.cfg.Retain)
+	}
+	if pruned != nil {
+		slog.Error("pruning old outputs", slog.Any("error", pruned))
+	}
+	if err := pruneOutputs(d.cfg.ReportFile, "", d.cfg.Retain); err != nil {
+		slog.Error("pruning old run reports", slog.Any("error", err))
+	}
+	return code
+}
+
+// templateActions matches the {{...}} actions of an output path template.
+var templateActions = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// Placeholders outputPathMatcher renders a template with, to find where each
+// value lands in the path.
+const (
+	datePlaceholder      = "\x00date\x00"
+	timePlaceholder      = "\x00time\x00"
+	timestampPlaceholder = "\x00timestamp\x00"
+	runPlaceholder       = 987654321
+)
+
+// outputPathMatcher returns a regexp matching exactly the paths the output
+// path template pattern renders to, whatever the time and run number, so
+// that pruning never touches other files the template's glob would match.
+func outputPathMatcher(pattern string) (*regexp.Regexp, error) {
+	rendered, err := renderOutputPath(pattern, outputPathData{
+		Date:      datePlaceholder,
+		Time:      timePlaceholder,
+		Timestamp: timestampPlaceholder,
+		Run:       runPlaceholder,
+	})
+	if err != nil {
+		return nil, err
+	}
+	expr := strings.NewReplacer(
+		datePlaceholder, `\d{4}-\d{2}-\d{2}`,
+		timePlaceholder, `\d{6}`,
+		timestampPlaceholder, `\d{8}-\d{6}`,
+		strconv.Itoa(runPlaceholder), `\d+`,
+	).Replace(regexp.QuoteMeta(rendered))
+	return regexp.Compile("^" + expr + "$")
+}
+
+// pruneOutputs removes all but the newest keep files produced from the output
+// path template pattern (and, for the dual format, their JSON siblings).
+// keep <= 0 and plain paths, which every run overwrites, are left alone.
+func pruneOutputs(pattern, format string, keep int) error {
+	if keep <= 0 || !strings.Contains(pattern, "{{") {
+		return nil
+	}
+	patterns := []string{pattern}
+	if format == "dual" {
+		patterns = append(patterns, dualJSONPath(pattern))
+	}
+
+	for _, p := range patterns {
+		stale, err := staleOutputs(p, keep)
+		if err != nil {
+			return err
+		}
+		for _, path := range stale {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("remove old output: %w", err)
+			}
+			slog.Info("removed old output", slog.String("path", path))
+		}
+	}
+	return nil
+}
+
+// pruneRotatedOutputs is pruneOutputs for rotated output: it keeps the newest
+// keep runs by their manifests, and removes older manifests together with
+// every shard they list.
+func pruneRotatedOutputs(pattern string, keep int) error {
+	if keep <= 0 || !strings.Contains(pattern, "{{") {
+		return nil
+	}
+	stale, err := staleOutputs(pipeline.ManifestPath(pattern), keep)
+	if err != nil {
+		return err
+	}
+	for _, path := range stale {
+		m, err := pipeline.ReadManifest(path)
+		if err != nil {
+			return err
+		}
+		for _, s := range m.Shards {
+			shard := filepath.Join(filepath.Dir(path), s.Path)
+			if err := os.Remove(shard); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("remove old shard: %w", err)
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("remove old manifest: %w", err)
+		}
+		slog.Info("removed old output", slog.String("manifest", path), slog.Int("shards", len(m.Shards)))
+	}
+	return nil
+}
+
+// staleOutputs returns the files rendered from the output path template
+// pattern beyond the newest keep, skipping writer temp files.
+func staleOutputs(pattern string, keep int) ([]string, error) {
+	match, err := outputPathMatcher(pattern)
+	if err != nil {
+		return nil, err
+	}
+	glob := templateActions.ReplaceAllString(pattern, "*")
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, fmt.Errorf("glob %s: %w", glob, err)
+	}
+	type output struct {
+		path    string
+		modTime time.Time
+	}
+	var outputs []output
+	for _, m := range matches {
+		if strings.HasPrefix(filepath.Base(m), ".") {
+			continue // writer temp file
+		}
+		if !match.MatchString(m) {
+			continue // matches the glob, but not the template
+		}
+		info, err := os.Stat(m)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		outputs = append(outputs, output{path: m, modTime: info.ModTime()})
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		if !outputs[i].modTime.Equal(outputs[j].modTime) {
+			return outputs[i].modTime.After(outputs[j].modTime)
+		}
+		return outputs[i].path > outputs[j].path
+	})
+	var stale []string
+	for i := keep; i < len(outputs); i++ {
+		stale = append(stale, outputs[i].path)
+	}
+	return stale, nil
+}
+
+// cronLogger routes cron's own messages to slog. Its scheduling chatter goes
+// to debug; skipped runs are surfaced as warnings.
+type cronLogger struct{}
+
+func (cronLogger) Info(msg string, keysAndValues ...any) {
+	if msg == "skip" {
+		slog.Warn("skipping scheduled run: the previous run is still in progress")
+		return
+	}
+	slog.Debug("cron: "+msg, keysAndValues...)
+}
+
+func (cronLogger) Error(err error, msg string, keysAndValues ...any) {
+	slog.Error("cron: "+msg, append(keysAndValues, slog.Any("error", err))...)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"github.com/aluiziolira/go-scrape-books/scraper"
+)
+
+func TestExpandOutputPath(t *testing.T) {
+	at := time.Date(2024, 3, 9, 7, 5, 1, 0, time.Local)
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"output/books.csv", "output/books.csv"},
+		{"output/books-{{.Date}}.csv", "output/books-2024-03-09.csv"},
+		{"output/{{.Timestamp}}/run-{{.Run}}-{{.Time}}.jsonl", "output/20240309-070501/run-4-070501.jsonl"},
+	}
+	for _, tt := range tests {
+		got, err := expandOutputPath(tt.pattern, at, 4)
+		if err != nil || got != tt.want {
+			t.Fatalf("expandOutputPath(%q) = %q, %v; want %q", tt.pattern, got, err, tt.want)
+		}
+	}
+	if _, err := expandOutputPath("output/{{.Nope}}.csv", at, 1); err == nil {
+		t.Fatal("expected error for unknown template field")
+	}
+}
+
+func TestPruneOutputs(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	for i, name := range []string{"books-1.csv", "books-1.json", "books-2.csv", "books-2.json", "books-3.csv", "books-3.json", "other.csv"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		mod := base.Add(time.Duration(i/2) * time.Minute)
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	if err := pruneOutputs(filepath.Join(dir, "books-{{.Run}}.csv"), "dual", 2); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	want := "books-2.csv books-2.json books-3.csv books-3.json other.csv"
+	if got := strings.Join(names, " "); got != want {
+		t.Fatalf("remaining = %s, want %s", got, want)
+	}
+
+	if err := pruneOutputs(filepath.Join(dir, "other.csv"), "csv", 1); err != nil {
+		t.Fatalf("prune plain path: %v", err)
+	}
+}
+
+func TestPruneOutputs_KeepsUnrelatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-24 * time.Hour)
+	names := []string{"2024-05-01.csv", "2024-05-02.csv", "2024-05-03.csv", "notes.csv", "books-2024-05-01-00001.csv", "2024-05-01.csv.bak"}
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		// The unrelated files are the oldest, so only the template keeps them.
+		mod := old.Add(time.Duration(i%3) * time.Minute)
+		if i >= 3 {
+			mod = old.Add(-time.Hour)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	if err := pruneOutputs(filepath.Join(dir, "{{.Date}}.csv"), "csv", 1); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := "2024-05-01.csv.bak 2024-05-03.csv books-2024-05-01-00001.csv notes.csv"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("remaining = %s, want %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestPruneRotatedOutputs(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	for run := 1; run <= 3; run++ {
+		m := pipeline.Manifest{}
+		for shard := 1; shard <= 2; shard++ {
+			name := fmt.Sprintf("books-%d-%05d.csv", run, shard)
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			m.Shards = append(m.Shards, pipeline.ManifestShard{Path: name})
+		}
+		data, _ := json.Marshal(m)
+		path := filepath.Join(dir, fmt.Sprintf("books-%d.manifest.json", run))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+		mod := base.Add(time.Duration(run) * time.Minute)
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	if err := pruneRotatedOutputs(filepath.Join(dir, "books-{{.Run}}.csv"), 1); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	want := "books-3-00001.csv books-3-00002.csv books-3.manifest.json"
+	if got := strings.Join(names, " "); got != want {
+		t.Fatalf("remaining = %s, want %s", got, want)
+	}
+}
+
+func TestDaemon_RunOnceLogsSummaryAndRetains(t *testing.T) {
+	srv := catalogServer(t, 3, false)
+	defer srv.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.BaseURL = srv.URL
+	cfg.MaxPages = 1
+	cfg.MaxRetries = 0
+	cfg.RespectRobotsTxt = false
+	cfg.OutputFile = filepath.Join(t.TempDir(), "books-{{.Run}}.csv")
+	cfg.Retain = 1
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	defer slog.SetDefault(prev)
+
+	d := &daemon{cfg: cfg, metrics: scraper.NewMetrics()}
+	for i := 0; i < 2; i++ {
+		if code := d.runOnce(context.Background()); code != 0 {
+			t.Fatalf("run %d exit code = %d\n%s", i+1, code, logs.String())
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(cfg.OutputFile), "books-*.csv"))
+	if len(matches) != 1 || filepath.Base(matches[0]) != "books-2.csv" {
+		t.Fatalf("outputs = %v, want only books-2.csv", matches)
+	}
+
+	var summaries int
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var event map[string]any
+		if json.Unmarshal([]byte(line), &event) != nil || event["msg"] != "daemon run finished" {
+			continue
+		}
+		summaries++
+		if event["items"] != float64(3) || event["requests"] != float64(1) || event["exit_code"] != float64(0) {
+			t.Fatalf("unexpected run summary: %v", event)
+		}
+	}
+	if summaries != 2 {
+		t.Fatalf("run summaries = %d, want 2", summaries)
+	}
+}
+
+func TestExecute_DaemonRequiresSchedule(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	for _, schedule := range []string{"", "every tuesday"} {
+		if code := execute([]string{"daemon", "-schedule", schedule}, &stdout, &stderr, envMap(nil)); code != exitConfig {
+			t.Fatalf("daemon with schedule %q: exit code = %d, want %d", schedule, code, exitConfig)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+)
+
+// endpoints configures the operational routes served next to /metrics:
+//
+//	GET /healthz       200 while the process is up
+//	GET /readyz        200 when ready reports nil, 503 with the reason otherwise
+//	GET /status        the JSON returned by status
+//	GET /debug/pprof/  net/http/pprof profiles, only when pprof is set
+type endpoints struct {
+	pprof  bool
+	ready  func() error // nil is always ready
+	status func() any   // nil leaves /status unregistered
+}
+
+// register adds the routes to mux.
+func (e endpoints) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if e.ready != nil {
+			if err := e.ready(); err != nil {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "error": err.Error()})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	})
+	if e.status != nil {
+		mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+			writeJSON(w, http.StatusOK, e.status())
+		})
+	}
+	if e.pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+}
+
+// crawlStatus is the /status body of a crawl.
+type crawlStatus struct {
+	State          string         `json:"state"` // starting, running, finished or failed
+	ElapsedSeconds float64        `json:"elapsed_seconds"`
+	Pages          int            `json:"pages"`
+	MaxPages       int            `json:"max_pages"`
+	Items          int64          `json:"items"`
+	ItemsPerSecond float64        `json:"items_per_second"`
+	InFlight       int            `json:"in_flight"`
+	PendingRetries int            `json:"pending_retries"`
+	Buffered       int            `json:"buffered"`
+	BufferCapacity int            `json:"buffer_capacity"`
+	ErrorsByType   map[string]int `json:"errors_by_type"`
+	ETASeconds     *float64       `json:"eta_seconds,omitempty"`
+	Error          string         `json:"error,omitempty"`
+}
+
+// ready reports nil while r is crawling with a healthy pipeline and writer,
+// and otherwise what is wrong.
+func (r *crawlRun) ready() error {
+	if err := r.healthy(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.scraper == nil || r.pipeline == nil:
+		return errors.New("collector not started")
+	case r.result != nil:
+		return errors.New("crawl finished")
+	}
+	return nil
+}
+
+// healthy reports whether r, its pipeline or its writer has failed.
+func (r *crawlRun) healthy() error {
+	r.mu.Lock()
+	p, runErr := r.pipeline, r.err
+	r.mu.Unlock()
+	if runErr != nil {
+		return runErr
+	}
+	if p == nil {
+		return nil
+	}
+	if err := p.Err(); errors.Is(err, pipeline.ErrWriteBatch) {
+		return fmt.Errorf("writer: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("pipeline: %w", err)
+	}
+	return nil
+}
+
+// status reports the progress of r.
+func (r *crawlRun) status() crawlStatus {
+	r.mu.Lock()
+	started, finished, runErr := r.started, r.result != nil, r.err
+	r.mu.Unlock()
+
+	st := crawlStatus{State: "running", ErrorsByType: map[string]int{}}
+	snap, ok := r.snapshotProgress(started)
+	switch {
+	case runErr != nil:
+		st.State, st.Error = "failed", runErr.Error()
+	case !ok:
+		st.State = "starting"
+	case finished:
+		st.State = "finished"
+	}
+	if !ok {
+		return st
+	}
+	st.ElapsedSeconds = snap.Elapsed.Seconds()
+	st.Pages, st.MaxPages = snap.Pages, snap.MaxPages
+	st.Items, st.ItemsPerSecond = snap.Items, snap.itemsPerSecond()
+	st.InFlight, st.PendingRetries = snap.InFlight, snap.PendingRetries
+	st.Buffered, st.BufferCapacity = snap.Buffered, snap.BufferCap
+	st.ErrorsByType = snap.ErrorsByType
+	if eta, ok := snap.eta(); ok && !finished {
+		secs := eta.Round(time.Second).Seconds()
+		st.ETASeconds = &secs
+	}
+	return st
+}
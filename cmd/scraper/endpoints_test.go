@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+)
+
+func getJSON(t *testing.T, url string, v any) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestEndpoints(t *testing.T) {
+	mux := http.NewServeMux()
+	endpoints{
+		pprof:  true,
+		ready:  func() error { return errors.New("writer: disk full") },
+		status: func() any { return map[string]int{"pages": 3} },
+	}.register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if code := getJSON(t, srv.URL+"/healthz", nil); code != http.StatusOK {
+		t.Fatalf("/healthz = %d, want 200", code)
+	}
+	var ready map[string]string
+	if code := getJSON(t, srv.URL+"/readyz", &ready); code != http.StatusServiceUnavailable || ready["error"] != "writer: disk full" {
+		t.Fatalf("/readyz = %d %v, want 503 with the reason", code, ready)
+	}
+	var status map[string]int
+	if code := getJSON(t, srv.URL+"/status", &status); code != http.StatusOK || status["pages"] != 3 {
+		t.Fatalf("/status = %d %v", code, status)
+	}
+	if code := getJSON(t, srv.URL+"/debug/pprof/cmdline", nil); code != http.StatusOK {
+		t.Fatalf("/debug/pprof/cmdline = %d, want 200", code)
+	}
+
+	mux = http.NewServeMux()
+	endpoints{}.register(mux)
+	bare := httptest.NewServer(mux)
+	defer bare.Close()
+	if code := getJSON(t, bare.URL+"/readyz", nil); code != http.StatusOK {
+		t.Fatalf("/readyz without a check = %d, want 200", code)
+	}
+	for _, path := range []string{"/status", "/debug/pprof/"} {
+		if code := getJSON(t, bare.URL+path, nil); code != http.StatusNotFound {
+			t.Fatalf("%s = %d, want 404 when not enabled", path, code)
+		}
+	}
+}
+
+func TestRun_MetricsServerProbes(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, buildCatalogPage(2, false))
+	}))
+	defer site.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.BaseURL = site.URL
+	cfg.MaxPages = 1
+	cfg.RespectRobotsTxt = false
+	cfg.MetricsAddr = freeAddr(t)
+	r := &crawlRun{cfg: cfg, outputFile: filepath.Join(t.TempDir(), "books.csv"), visit: visitConfigured}
+	if err := r.ready(); err == nil {
+		t.Fatal("a run that has not started should not be ready")
+	}
+	if st := r.status(); st.State != "starting" {
+		t.Fatalf("state = %q before the run, want starting", st.State)
+	}
+
+	done := make(chan int, 1)
+	go func() { done <- r.execute(context.Background()) }()
+
+	base := "http://" + cfg.MetricsAddr
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if resp, err := http.Get(base + "/readyz"); err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("metrics server never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var st crawlStatus
+	if code := getJSON(t, base+"/status", &st); code != http.StatusOK || st.State != "running" || st.MaxPages != 1 {
+		t.Fatalf("/status = %d %+v, want a running crawl of 1 page", code, st)
+	}
+
+	if code := <-done; code != exitOK {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	if err := r.ready(); err == nil {
+		t.Fatal("a finished run should not be ready")
+	}
+	if st := r.status(); st.State != "finished" || st.Items != 2 {
+		t.Fatalf("status after the run = %+v, want finished with 2 items", st)
+	}
+}
+
+func TestDaemonStatus(t *testing.T) {
+	d := &daemon{cfg: config.DefaultConfig()}
+	if err := d.ready(); err != nil {
+		t.Fatalf("idle daemon not ready: %v", err)
+	}
+	d.runs.Add(2)
+	code := exitThreshold
+	d.lastCode = &code
+	st := d.status()
+	if st.Runs != 2 || st.LastExitCode == nil || *st.LastExitCode != exitThreshold || st.Current != nil {
+		t.Fatalf("status = %+v", st)
+	}
+}
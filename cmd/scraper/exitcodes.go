@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Process exit codes. diff keeps diff(1)'s convention instead: 1 when the
+// files differ and 2 on trouble.
+const (
+	exitOK            = 0
+	exitFailure       = 1 // a failure none of the codes below describes
+	exitUsage         = 2 // bad command line
+	exitConfig        = 3 // the configuration could not be loaded or is invalid
+	exitWriterInit    = 4 // the output writer could not be created
+	exitCrawlAborted  = 5 // the crawl or pipeline stopped before finishing
+	exitThreshold     = 6 // the run finished degraded: over -max-error-rate, under -min-items or drifted with -fail-on-drift
+	exitOutputInvalid = 7 // the output could not be written, failed validation or could not be published
+	exitInterrupted   = 130
+)
+
+var exitCodeHelp = []struct {
+	code    int
+	meaning string
+}{
+	{exitOK, "success"},
+	{exitFailure, "unclassified failure"},
+	{exitUsage, "bad command line"},
+	{exitConfig, "invalid configuration"},
+	{exitWriterInit, "output writer could not be created"},
+	{exitCrawlAborted, "crawl aborted before finishing"},
+	{exitThreshold, "degraded run: over -max-error-rate, under -min-items, or drift with -fail-on-drift"},
+	{exitOutputInvalid, "output failed writing, validation or publishing"},
+	{exitInterrupted, "interrupted by SIGINT/SIGTERM; outputs hold what was scraped until then"},
+}
+
+// printExitCodes documents the exit codes in help output.
+func printExitCodes(w io.Writer) {
+	fmt.Fprintln(w, "\nExit codes:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range exitCodeHelp {
+		fmt.Fprintf(tw, "  %d\t%s\n", c.code, c.meaning)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"github.com/aluiziolira/go-scrape-books/scraper"
+)
+
+// jobState is the lifecycle stage of a crawl job.
+type jobState string
+
+const (
+	jobQueued    jobState = "queued"
+	jobRunning   jobState = "running"
+	jobSucceeded jobState = "succeeded"
+	jobFailed    jobState = "failed"
+	jobCancelled jobState = "cancelled"
+)
+
+// done reports whether a job in state s has finished.
+func (s jobState) done() bool {
+	return s == jobSucceeded || s == jobFailed || s == jobCancelled
+}
+
+var errJobNotFound = errors.New("job not found")
+
+// jobKeys are the settings a job request may override: what to crawl, how
+// politely, and the shape of the records. Everything else, such as paths,
+// addresses, publishing, compression and scheduling, belongs to the server.
+var jobKeys = map[string]bool{
+	"sites": true, "base_url": true, "pages": true, "parallel": true, "delay": true,
+	"random_delay": true, "timeout": true, "max_retries": true, "retry_backoff": true,
+	"retry_backoff_max": true, "respect_robots": true, "user_agent": true,
+	"format": true, "fields": true, "exclude_fields": true,
+	"rotate_records": true, "rotate_bytes": true, "partition_by": true,
+	"pipeline_buffer_size": true, "batch_size": true, "dedupe_max_size": true,
+	"health_tolerance": true, "fail_on_drift": true, "max_error_rate": true, "min_items": true,
+}
+
+// maxFinishedJobs is how many finished jobs the server remembers; older ones
+// are forgotten, though their outputs stay in jobs_dir.
+const maxFinishedJobs = 100
+
+// job is one crawl submitted to the serve command.
+type job struct {
+	id     string
+	seq    int
+	cfg    *config.Config
+	dir    string
+	run    *crawlRun
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu              sync.Mutex
+	state           jobState
+	created         time.Time
+	started         time.Time
+	finished        time.Time
+	exitCode        int
+	cancelRequested bool
+}
+
+// jobStatus is the JSON view of a job.
+type jobStatus struct {
+	ID         string                  `json:"id"`
+	State      jobState                `json:"state"`
+	CreatedAt  time.Time               `json:"created_at"`
+	StartedAt  *time.Time              `json:"started_at,omitempty"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+	ExitCode   int                     `json:"exit_code"`
+	Error      string                  `json:"error,omitempty"`
+	Outputs    []jobOutput             `json:"outputs,omitempty"`
+	Result     *models.ScraperResult   `json:"result,omitempty"`
+	Pipeline   *pipeline.PipelineStats `json:"pipeline,omitempty"`
+}
+
+// jobOutput describes one file written by a finished job.
+type jobOutput struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+func (j *job) status() jobStatus {
+	j.mu.Lock()
+	st := jobStatus{ID: j.id, State: j.state, CreatedAt: j.created, ExitCode: j.exitCode}
+	if !j.started.IsZero() {
+		started := j.started
+		st.StartedAt = &started
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		st.FinishedAt = &finished
+	}
+	done := j.state.done()
+	j.mu.Unlock()
+
+	st.Result, st.Pipeline = j.run.progress()
+	if err := j.run.failure(); err != nil {
+		st.Error = err.Error()
+	}
+	if done {
+		st.Outputs = j.outputs()
+	}
+	return st
+}
+
+// outputs lists the files in the job's output directory.
+func (j *job) outputs() []jobOutput {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil
+	}
+	var out []jobOutput
+	for _, e := range entries {
+		// Skip directories and writer temp files.
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, jobOutput{Name: e.Name(), Size: info.Size()})
+	}
+	return out
+}
+
+// jobManager queues crawl jobs and runs at most cfg.MaxConcurrentJobs of them
+// at once, all recording into one shared metrics registry.
+type jobManager struct {
+	ctx        context.Context
+	base       *config.Config
+	metrics    *scraper.Metrics
+	collectors *pipeline.Collectors
+	slots      chan struct{}
+	keep       int // finished jobs remembered; see maxFinishedJobs
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	nextID int
+	wg     sync.WaitGroup
+}
+
+func newJobManager(ctx context.Context, base *config.Config, metrics *scraper.Metrics) *jobManager {
+	return &jobManager{
+		ctx:        ctx,
+		base:       base,
+		metrics:    metrics,
+		collectors: pipeline.NewCollectors(metrics.Registry),
+		slots:      make(chan struct{}, base.MaxConcurrentJobs),
+		keep:       maxFinishedJobs,
+		jobs:       make(map[string]*job),
+	}
+}
+
+// submit applies override (field keys plus an optional "sites" list) on top
+// of the server's configuration and queues the resulting crawl. The output
+// location is always chosen by the server: <jobs_dir>/<id>/, which also
+// receives the server's file sinks.
+func (m *jobManager) submit(override map[string]any) (*job, error) {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(override)) {
+		if !jobKeys[key] {
+			errs = append(errs, fmt.Errorf("setting %q cannot be overridden per job", key))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	cfg := *m.base
+	cfg.Sites = append([]config.SiteConfig(nil), m.base.Sites...)
+	if err := cfg.Apply(override, nil, config.SourceFlag); err != nil {
+		return nil, err
+	}
+
+	// IDs are prefixed with the submission time so they stay unique (and so
+	// do their output directories) across server restarts.
+	m.mu.Lock()
+	m.nextID++
+	seq := m.nextID
+	m.mu.Unlock()
+	id := fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102-150405"), seq)
+
+	dir := filepath.Join(cfg.JobsDir, id)
+	cfg.OutputFile = filepath.Join(dir, "books"+outputExt(&cfg)+pipeline.CompressionExt(cfg.Compression))
+	cfg.ReportFile = filepath.Join(dir, "report.json")
+	cfg.MetricsAddr = ""
+	// Jobs may run concurrently, so each keeps to its own directory and
+	// leaves what the server shares, such as a published directory or the
+	// health baseline, untouched.
+	cfg.Sinks = jobSinks(m.base.Sinks, dir)
+	cfg.Publish = false
+	cfg.UpdateHealthBaseline = false
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &job{
+		id:      id,
+		seq:     seq,
+		cfg:     &cfg,
+		dir:     dir,
+		ctx:     ctx,
+		cancel:  cancel,
+		state:   jobQueued,
+		created: time.Now(),
+		run: &crawlRun{
+			cfg:        &cfg,
+			outputFile: cfg.OutputFile,
+			reportFile: cfg.ReportFile,
+			metrics:    m.metrics,
+			collectors: m.collectors,
+			visit:      visitConfigured,
+		},
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = j
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.execute(j)
+	return j, nil
+}
+
+// jobSinks returns sinks with every file sink moved into dir under its own
+// file name; http sinks are kept as they are.
+func jobSinks(sinks []config.SinkConfig, dir string) []config.SinkConfig {
+	if len(sinks) == 0 {
+		return nil
+	}
+	out := make([]config.SinkConfig, len(sinks))
+	for i, sink := range sinks {
+		if sink.IsFile() {
+			sink.Path = filepath.Join(dir, filepath.Base(sink.Path))
+		}
+		out[i] = sink
+	}
+	return out
+}
+
+func (m *jobManager) execute(j *job) {
+	defer m.wg.Done()
+	defer m.prune()
+	defer j.cancel()
+
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-j.ctx.Done():
+		m.finish(j, 1)
+		return
+	}
+
+	j.mu.Lock()
+	j.state = jobRunning
+	j.started = time.Now()
+	j.mu.Unlock()
+	slog.Info("job started", slog.String("job", j.id), slog.String("output", j.cfg.OutputFile))
+
+	m.finish(j, j.run.execute(j.ctx))
+}
+
+func (m *jobManager) finish(j *job, code int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.exitCode = code
+	j.finished = time.Now()
+	switch {
+	case j.cancelRequested || j.ctx.Err() != nil:
+		j.state = jobCancelled
+	case code == 0:
+		j.state = jobSucceeded
+	default:
+		j.state = jobFailed
+	}
+	slog.Info("job finished", slog.String("job", j.id), slog.String("state", string(j.state)), slog.Int("exit_code", code))
+}
+
+// prune forgets the oldest finished jobs beyond m.keep, so a long-running
+// server does not grow without bound.
+func (m *jobManager) prune() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var finished []*job
+	for _, j := range m.jobs {
+		j.mu.Lock()
+		if j.state.done() {
+			finished = append(finished, j)
+		}
+		j.mu.Unlock()
+	}
+	if len(finished) <= m.keep {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].seq < finished[b].seq })
+	for _, j := range finished[:len(finished)-m.keep] {
+		delete(m.jobs, j.id)
+	}
+}
+
+func (m *jobManager) get(id string) (*job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	return j, nil
+}
+
+// list returns every job, oldest first.
+func (m *jobManager) list() []*job {
+	m.mu.Lock()
+	jobs := make([]*job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	m.mu.Unlock()
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].seq < jobs[b].seq })
+	return jobs
+}
+
+// cancel stops a queued or running job through its context. Cancelling a
+// finished job is a no-op.
+func (m *jobManager) cancel(id string) (*job, error) {
+	j, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	j.mu.Lock()
+	if j.state == jobQueued || j.state == jobRunning {
+		j.cancelRequested = true
+	}
+	j.mu.Unlock()
+	j.cancel()
+	return j, nil
+}
+
+// wait blocks until every job has finished.
+func (m *jobManager) wait() {
+	m.wg.Wait()
+}
+
+// outputExt is the file extension createWriter's primary output uses for
+// the output format of cfg.
+func outputExt(cfg *config.Config) string {
+	if cfg.OutputFormat == "template" {
+		return pipeline.TemplateExt(cfg.TemplateFile)
+	}
+	if f, ok := pipeline.LookupFormat(cfg.OutputFormat); ok {
+		return f.Exts[0]
+	}
+	return ".csv"
+}
+
+// outputPath resolves name inside the job's output directory, refusing
+// anything that is not a plain file name listed there.
+func (j *job) outputPath(name string) (string, error) {
+	for _, o := range j.outputs() {
+		if o.Name == name {
+			return filepath.Join(j.dir, name), nil
+		}
+	}
+	return "", fmt.Errorf("output %q not found", name)
+}
@@ -7,261 +7,323 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/aluiziolira/go-scrape-books/config"
-	"github.com/aluiziolira/go-scrape-books/models"
-	"github.com/aluiziolira/go-scrape-books/pipeline"
-	"github.com/aluiziolira/go-scrape-books/scraper"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/aluiziolira/go-scrape-books/telemetry"
 )
 
 func main() {
-	pagesDefault, parallelDefault, outputDefault, metricsDefault, err := flagDefaults()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
-
-	maxPages := flag.Int("pages", pagesDefault, "Maximum catalog pages to scrape")
-	parallelism := flag.Int("parallel", parallelDefault, "Number of concurrent requests")
-	delayMs := flag.Int("delay", 0, "Delay between requests (milliseconds)")
-	randomDelayMs := flag.Int("random-delay", 0, "Random jitter added to delay (milliseconds)")
-	maxRetries := flag.Int("max-retries", 2, "Maximum retry attempts per URL")
-	retryBackoffMs := flag.Int("retry-backoff", 200, "Initial retry backoff (milliseconds)")
-	retryBackoffMaxMs := flag.Int("retry-backoff-max", 2000, "Maximum retry backoff (milliseconds)")
-	respectRobots := flag.Bool("respect-robots", true, "Respect robots.txt directives (enabled by default; pass -respect-robots=false to disable)")
-	outputFile := flag.String("output", outputDefault, "Output file path")
-	outputFormat := flag.String("format", "csv", "Output format: csv, json, or dual")
-	verbose := flag.Bool("v", false, "Enable verbose logging")
-	baseURL := flag.String("base-url", "https://books.toscrape.com", "Base URL to crawl")
-	metricsAddr := flag.String("metrics-addr", metricsDefault, "Prometheus metrics listen address (e.g. :9090)")
-
-	flag.Parse()
-
-	logger, level := newLogger(*verbose)
-	slog.SetDefault(logger)
-	slog.SetLogLoggerLevel(level.Level())
+	os.Exit(execute(os.Args[1:], os.Stdout, os.Stderr, os.LookupEnv))
+}
 
-	cfg := buildConfigFromFlags(*baseURL, *maxPages, *parallelism, *delayMs, *randomDelayMs, *maxRetries, *retryBackoffMs, *retryBackoffMaxMs, *respectRobots, *outputFile, *outputFormat, *verbose, *metricsAddr)
-	if err := cfg.Validate(); err != nil {
-		slog.Error("invalid configuration", slog.Any("error", err))
-		os.Exit(1)
-	}
+// command is one scraper subcommand. bind registers the command's own flags
+// on its flag set and returns the function that runs it once the
+// configuration has been loaded.
+type command struct {
+	name     string
+	args     string // positional arguments, for the usage line
+	summary  string
+	settings bool // accepts every config field flag, not only the global ones
+	bind     func(fs *flag.FlagSet) runFunc
+}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+// runFunc runs a command and returns the process exit code.
+type runFunc func(ctx context.Context, inv *invocation) int
+
+// invocation is everything a command needs once its flags are parsed.
+type invocation struct {
+	cfg     *config.Config
+	sources config.Sources
+	args    []string
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
 
-	os.Exit(run(ctx, cfg, *outputFile))
+var commands = []*command{
+	{name: "crawl", summary: "Crawl the configured sites and write every book found (default command)", settings: true, bind: crawlCommand},
+	{name: "replay", args: "URL_FILE", summary: "Crawl the URLs listed one per line in a file (- for stdin), e.g. the failed URLs of an earlier run", settings: true, bind: replayCommand},
+	{name: "validate", args: "[OUTPUT_FILE...]", summary: "Check the configuration and that output files hold valid, unique records", settings: true, bind: validateCommand},
+	{name: "diff", args: "OLD NEW", summary: "Compare two output files by book URL; exits 1 when they differ", bind: diffCommand},
+	{name: "convert", args: "IN OUT", summary: "Convert an output file to another format", bind: convertCommand},
+	{name: "schema", summary: "Print the JSON Schema of an output record, with the fields selected by -fields and -exclude-fields", settings: true, bind: schemaCommand},
+	{name: "daemon", summary: "Crawl on the configured cron schedule, keeping the metrics server up between runs", settings: true, bind: daemonCommand},
+	{name: "serve", summary: "Run the HTTP job API until interrupted: POST /jobs queues a crawl, GET /jobs[/{id}] reports progress, POST /jobs/{id}/cancel stops one and GET /jobs/{id}/outputs serves its files, next to /metrics", settings: true, bind: serveCommand},
+	{name: "config print", summary: "Print the effective configuration and where each value came from", settings: true, bind: configPrintCommand},
 }
 
-// run executes the scrape and returns a process exit code.
-func run(ctx context.Context, cfg *config.Config, outputFile string) int {
-	logger, level := newLogger(cfg.Verbose)
-	slog.SetDefault(logger)
-	slog.SetLogLoggerLevel(level.Level())
+// globalFields are the config fields every command accepts as flags.
+var globalFields = map[string]bool{"verbose": true}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
 
-	slog.Info("starting scrape",
-		slog.String("base_url", cfg.BaseURL),
-		slog.Int("pages", cfg.MaxPages),
-		slog.Int("workers", cfg.Parallelism),
-	)
+// execute dispatches args to a command. Arguments that start with a flag run
+// crawl, so invocations from before subcommands existed behave as they did.
+func execute(args []string, stdout, stderr io.Writer, lookupEnv func(string) (string, bool)) int {
+	name := "crawl"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+		if name == "config" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			name, args = name+" "+args[0], args[1:]
+		}
+	}
+	if name == "help" {
+		if len(args) == 0 {
+			printUsage(stdout)
+			return exitOK
+		}
+		name, args = strings.Join(args, " "), []string{"-h"}
+	}
+	cmd := lookupCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		printUsage(stderr)
+		return exitUsage
+	}
 
-	s, err := scraper.NewScraper(cfg)
+	fs := flag.NewFlagSet("scraper "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cf := addConfigFlags(fs, cmd.settings)
+	runCmd := cmd.bind(fs)
+	fs.Usage = func() { cmd.usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	cfg, sources, err := cf.load(fs, lookupEnv)
 	if err != nil {
-		slog.Error("initialising scraper", slog.Any("error", err))
-		return 1
+		fmt.Fprintln(stderr, err)
+		return exitConfig
 	}
 
-	writer, err := createWriter(cfg.OutputFormat, outputFile)
+	logger, level := newLogger(cfg.Verbose, logOutput(cfg))
+	slog.SetDefault(logger)
+	slog.SetLogLoggerLevel(level.Level())
+
+	shutdownTracing, err := telemetry.Setup(cfg, traceOutput(cfg, stdout, stderr))
 	if err != nil {
-		slog.Error("creating writer", slog.Any("error", err))
-		return 1
+		slog.Error("initialising tracing", slog.Any("error", err))
+		return exitConfig
 	}
 	defer func() {
-		if err := writer.Close(); err != nil {
-			slog.Error("close writer", slog.Any("error", err))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("flushing traces", slog.Any("error", err))
 		}
 	}()
 
-	go func() {
-		<-ctx.Done()
-		slog.Info("shutdown signal received, waiting for in-flight work to finish")
-	}()
-
-	var metricsServer *http.Server
-	if cfg.MetricsAddr != "" && s.Metrics != nil {
-		metricsServer = startMetricsServer(ctx, cfg.MetricsAddr, s.Metrics.Registry)
-	}
-
-	p := pipeline.NewPipeline(ctx, writer, cfg)
-	p.Start(cfg.Parallelism)
-	if cfg.Verbose {
-		p.StartMetricsReporting(10 * time.Second)
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	startTime := time.Now()
-	result, err := s.Run(ctx, p)
-	if err != nil {
-		slog.Error("scraping failed", slog.Any("error", err))
-		shutdownMetricsServer(metricsServer, 5*time.Second)
-		return 1
-	}
+	return runCmd(ctx, &invocation{cfg: cfg, sources: sources, args: fs.Args(), stdin: os.Stdin, stdout: stdout, stderr: stderr})
+}
 
-	if err := p.Close(); err != nil {
-		slog.Error("pipeline shutdown failed", slog.Any("error", err))
-		shutdownMetricsServer(metricsServer, 5*time.Second)
-		return 1
+func (c *command) usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	synopsis := "scraper " + c.name + " [flags]"
+	if c.args != "" {
+		synopsis += " " + c.args
 	}
-
-	if err := writer.Validate(); err != nil {
-		slog.Error("output validation failed", slog.Any("error", err))
-		shutdownMetricsServer(metricsServer, 5*time.Second)
-		return 1
+	fmt.Fprintf(w, "usage: %s\n\n%s.\n\nFlags:\n", synopsis, c.summary)
+	fs.PrintDefaults()
+	if c.settings {
+		printExitCodes(w)
 	}
+	fmt.Fprintln(w, "\nRun 'scraper help' to list every command.")
+}
 
-	shutdownMetricsServer(metricsServer, 5*time.Second)
-
-	metrics := p.GetMetrics()
-	duration := time.Since(startTime)
-	totalItems := metrics.Processed
-	itemsPerSec := 0.0
-	if duration.Seconds() > 0 {
-		itemsPerSec = float64(totalItems) / duration.Seconds()
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: scraper [command] [flags] [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
 	}
+	_ = tw.Flush()
+	printExitCodes(w)
+	fmt.Fprintln(w, "\nWithout a command, flags are passed to crawl. Run 'scraper help <command>' for its flags.")
+}
 
-	printSummary(os.Stdout, result, duration, itemsPerSec, outputFile, metrics)
-	return 0
+// configFlags holds the flags that feed the configuration loader.
+type configFlags struct {
+	path  *string
+	sites siteFlags
+	sinks sinkFlags
 }
 
-// startMetricsServer launches the Prometheus metrics HTTP server.
-// It returns nil when addr is empty (metrics disabled).
-func startMetricsServer(ctx context.Context, addr string, registry *prometheus.Registry) *http.Server {
-	_ = ctx
-	if addr == "" {
-		return nil
+// addConfigFlags registers -config and the global field flags on fs, plus
+// every other config field, -site and -sink when settings is true.
+func addConfigFlags(fs *flag.FlagSet, settings bool) *configFlags {
+	cf := &configFlags{}
+	defaults := config.DefaultConfig()
+	cf.path = fs.String("config", "", "Config file (.yaml, .toml or .json); also read from SCRAPER_CONFIG")
+	for _, f := range config.Fields() {
+		if !settings && !globalFields[f.Key] {
+			continue
+		}
+		fs.Var(&fieldFlag{field: f, value: defaults.Get(f.Key)}, f.Flag, fmt.Sprintf("%s (env %s)", f.Usage, f.Env))
 	}
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+	if settings {
+		fs.Var(&cf.sites, "site", "Additional site to crawl as url[,name=..,pages=..,parallel=..,delay=..,random-delay=..,user-agent=..,robots=..,profile=..,structured=..] (repeatable; replaces -base-url)")
+		fs.Var(&cf.sinks, "sink", "Output to write as format:path[,on-error=fail-fast|best-effort|quarantine] with format csv, json, arrow, parquet, avro, xlsx, html, template or http (an http sink's path is its URL; repeatable; replaces -output and -format)")
 	}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			slog.Error("metrics server failed", slog.Any("error", err))
-		}
-	}()
-	slog.Info("metrics server enabled", slog.String("addr", addr))
-	return srv
+	return cf
 }
 
-// shutdownMetricsServer gracefully shuts down the metrics server.
-// It is a no-op when srv is nil.
-func shutdownMetricsServer(srv *http.Server, timeout time.Duration) {
-	if srv == nil {
-		return
+// load resolves the effective configuration once fs has been parsed:
+// defaults, then the config file (-config or SCRAPER_CONFIG), then the
+// environment, then explicitly set flags.
+func (cf *configFlags) load(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) (*config.Config, config.Sources, error) {
+	path := *cf.path
+	if path == "" && lookupEnv != nil {
+		path, _ = lookupEnv("SCRAPER_CONFIG")
+	}
+	cfg, sources, err := config.Load(path, lookupEnv)
+	errs := []error{err}
+	fs.Visit(func(fl *flag.Flag) {
+		ff, ok := fl.Value.(*fieldFlag)
+		if !ok {
+			return
+		}
+		if err := cfg.Set(ff.field.Key, ff.value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid -%s: %w", fl.Name, err))
+			return
+		}
+		sources[ff.field.Key] = config.SourceFlag
+	})
+	if len(cf.sites) > 0 {
+		cfg.Sites = cf.sites
+		sources["sites"] = config.SourceFlag
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		slog.Error("metrics server shutdown failed", slog.Any("error", err))
+	if len(cf.sinks) > 0 {
+		cfg.Sinks = cf.sinks
+		sources["sinks"] = config.SourceFlag
 	}
+	cfg.OutputFormat = strings.ToLower(cfg.OutputFormat)
+	return cfg, sources, errors.Join(errs...)
 }
 
-// flagDefaults computes flag default values, applying environment overrides.
-// It returns an error (matching the original stderr message) when an env var is
-// present but cannot be parsed.
-func flagDefaults() (pagesDefault, parallelDefault int, outputDefault, metricsDefault string, err error) {
-	defaultCfg := config.DefaultConfig()
-	pagesDefault = defaultCfg.MaxPages
-	if value, ok, parseErr := config.EnvInt("SCRAPER_PAGES"); parseErr != nil {
-		return 0, 0, "", "", fmt.Errorf("invalid SCRAPER_PAGES: %v", parseErr)
-	} else if ok {
-		pagesDefault = value
-	}
-	parallelDefault = defaultCfg.Parallelism
-	if value, ok, parseErr := config.EnvInt("SCRAPER_PARALLEL"); parseErr != nil {
-		return 0, 0, "", "", fmt.Errorf("invalid SCRAPER_PARALLEL: %v", parseErr)
-	} else if ok {
-		parallelDefault = value
+// configPrintCommand shows the effective configuration and where each value
+// came from, followed by every validation problem.
+func configPrintCommand(_ *flag.FlagSet) runFunc {
+	return func(_ context.Context, inv *invocation) int {
+		if err := config.Print(inv.stdout, inv.cfg, inv.sources); err != nil {
+			fmt.Fprintln(inv.stderr, err)
+			return 1
+		}
+		if err := inv.cfg.Validate(); err != nil {
+			fmt.Fprintf(inv.stderr, "\ninvalid configuration:\n%v\n", err)
+			return exitConfig
+		}
+		return exitOK
 	}
-	outputDefault = defaultCfg.OutputFile
-	if value, ok := config.EnvString("SCRAPER_OUTPUT"); ok {
-		outputDefault = value
+}
+
+// fieldFlag is the flag.Value for one config field. It only records the raw
+// value; configFlags.load applies it on top of the file and environment so that
+// flags take precedence regardless of parse order.
+type fieldFlag struct {
+	field config.Field
+	value string
+}
+
+func (f *fieldFlag) String() string {
+	if f == nil {
+		return ""
 	}
-	metricsDefault = defaultCfg.MetricsAddr
-	if value, ok := config.EnvString("SCRAPER_METRICS_ADDR"); ok {
-		metricsDefault = value
+	return f.value
+}
+
+func (f *fieldFlag) Set(value string) error {
+	if err := config.DefaultConfig().Set(f.field.Key, value); err != nil {
+		return err
 	}
-	return pagesDefault, parallelDefault, outputDefault, metricsDefault, nil
+	f.value = value
+	return nil
 }
 
-func buildConfigFromFlags(baseURL string, maxPages, parallelism, delayMs, randomDelayMs, maxRetries, retryBackoffMs, retryBackoffMaxMs int, respectRobots bool, outputFile, outputFormat string, verbose bool, metricsAddr string) *config.Config {
-	cfg := config.DefaultConfig()
-	cfg.BaseURL = baseURL
-	cfg.MaxPages = maxPages
-	cfg.Parallelism = parallelism
-	cfg.Delay = time.Duration(delayMs) * time.Millisecond
-	cfg.RandomDelay = time.Duration(randomDelayMs) * time.Millisecond
-	cfg.MaxRetries = maxRetries
-	cfg.RetryBackoff = time.Duration(retryBackoffMs) * time.Millisecond
-	cfg.RetryBackoffMax = time.Duration(retryBackoffMaxMs) * time.Millisecond
-	cfg.RespectRobotsTxt = respectRobots
-	cfg.OutputFile = outputFile
-	cfg.OutputFormat = strings.ToLower(outputFormat)
-	cfg.Verbose = verbose
-	cfg.MetricsAddr = metricsAddr
-	return cfg
+// IsBoolFlag lets boolean fields be passed without a value, e.g. -v.
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.field.IsBool()
 }
 
-func createWriter(format, filename string) (pipeline.OutputWriter, error) {
-	switch format {
-	case "json":
-		return pipeline.NewJSONWriter(filename)
-	case "csv":
-		return pipeline.NewCSVWriter(filename)
-	case "dual":
-		jsonFilename := strings.TrimSuffix(filename, ".csv") + ".json"
-		return pipeline.NewDualWriter(filename, jsonFilename)
-	default:
-		return nil, fmt.Errorf("unsupported format: %s", format)
+// siteFlags collects repeated -site values.
+type siteFlags []config.SiteConfig
+
+func (f *siteFlags) String() string {
+	names := make([]string, 0, len(*f))
+	for _, site := range *f {
+		names = append(names, site.BaseURL)
 	}
+	return strings.Join(names, " ")
 }
 
-func printSummary(w io.Writer, result *models.ScraperResult, duration time.Duration, itemsPerSec float64, outputFile string, metrics pipeline.PipelineStats) {
-	separator := "--------------------------------------------------"
-	fmt.Fprintln(w, "\n"+separator)
-	fmt.Fprintln(w, "Scrape complete")
+func (f *siteFlags) Set(value string) error {
+	site, err := config.ParseSiteSpec(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, site)
+	return nil
+}
 
-	totalItems := metrics.Processed
+// sinkFlags collects repeated -sink values.
+type sinkFlags []config.SinkConfig
 
-	fmt.Fprintf(w, "  Total items:   %d\n", totalItems)
-	successRate := 0.0
-	if result.RequestCount > 0 {
-		successRate = float64(result.RequestCount-result.ErrorCount) / float64(result.RequestCount) * 100
+func (f *sinkFlags) String() string {
+	paths := make([]string, 0, len(*f))
+	for _, sink := range *f {
+		paths = append(paths, sink.Path)
 	}
-	fmt.Fprintf(w, "  Success rate:  %.2f%%\n", successRate)
-	fmt.Fprintf(w, "  Errors:        %d\n", result.ErrorCount)
-	fmt.Fprintf(w, "  Retries:       %d\n", result.RetryCount)
-	fmt.Fprintf(w, "  Failed URLs:   %d\n", len(result.FailedURLs))
-	if len(result.ErrorsByType) > 0 {
-		fmt.Fprintf(w, "  Error types:   %v\n", result.ErrorsByType)
+	return strings.Join(paths, " ")
+}
+
+func (f *sinkFlags) Set(value string) error {
+	sink, err := config.ParseSinkSpec(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, sink)
+	return nil
+}
+
+// logOutput is where logs, progress and the run summary go: stdout, or
+// stderr when records stream to stdout.
+func logOutput(cfg *config.Config) *os.File {
+	if cfg.StreamsToStdout() {
+		return os.Stderr
 	}
-	if valErrors := metrics.ValidationErrors; len(valErrors) > 0 {
-		fmt.Fprintf(w, "  Validation:    %v\n", valErrors)
+	return os.Stdout
+}
+
+// traceOutput is where the stdout trace exporter writes: stdout, or stderr
+// when records stream to stdout.
+func traceOutput(cfg *config.Config, stdout, stderr io.Writer) io.Writer {
+	if cfg.StreamsToStdout() {
+		return stderr
 	}
-	fmt.Fprintf(w, "  Duration:      %v\n", duration)
-	fmt.Fprintf(w, "  Items/sec:     %.2f\n", itemsPerSec)
-	fmt.Fprintf(w, "  Output file:   %s\n", outputFile)
-	fmt.Fprintln(w, separator)
+	return stdout
 }
 
-func newLogger(verbose bool) (*slog.Logger, *slog.LevelVar) {
+// newLogger returns a logger writing to out: text through its console when
+// out is a terminal, JSON otherwise.
+func newLogger(verbose bool, out *os.File) (*slog.Logger, *slog.LevelVar) {
 	level := &slog.LevelVar{}
 	if verbose {
 		level.Set(slog.LevelDebug)
@@ -271,10 +333,10 @@ func newLogger(verbose bool) (*slog.Logger, *slog.LevelVar) {
 
 	opts := &slog.HandlerOptions{Level: level}
 	var handler slog.Handler
-	if isTerminal(os.Stdout) {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+	if isTerminal(out) {
+		handler = slog.NewTextHandler(consoleOf(out), opts)
 	} else {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(out, opts)
 	}
 
 	return slog.New(handler), level
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -17,6 +21,7 @@ import (
 	"github.com/aluiziolira/go-scrape-books/config"
 	"github.com/aluiziolira/go-scrape-books/models"
 	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"github.com/aluiziolira/go-scrape-books/scraper"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -42,6 +47,16 @@ func buildCatalogPage(bookCount int, hasNext bool) string {
 	return b.String()
 }
 
+// loadConfig registers every config flag on fs, parses args and resolves the
+// effective configuration.
+func loadConfig(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*config.Config, config.Sources, error) {
+	cf := addConfigFlags(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	return cf.load(fs, lookupEnv)
+}
+
 // catalogServer returns an httptest.Server that responds with a canned page on
 // every path.
 func catalogServer(t *testing.T, bookCount int, hasNext bool) *httptest.Server {
@@ -89,7 +104,7 @@ func TestRun_EndToEnd(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if code := run(ctx, cfg, outputFile); code != 0 {
+	if code := run(ctx, cfg, outputFile, ""); code != 0 {
 		t.Fatalf("run exit code = %d, want 0", code)
 	}
 
@@ -135,7 +150,7 @@ func TestRun_WithMetrics(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if code := run(ctx, cfg, outputFile); code != 0 {
+	if code := run(ctx, cfg, outputFile, ""); code != 0 {
 		t.Fatalf("run exit code = %d, want 0", code)
 	}
 }
@@ -154,8 +169,8 @@ func TestRun_CreateWriterFailure(t *testing.T) {
 	cfg.OutputFormat = "csv"
 	cfg.MetricsAddr = ""
 
-	if code := run(context.Background(), cfg, cfg.OutputFile); code != 1 {
-		t.Fatalf("run exit code = %d, want 1", code)
+	if code := run(context.Background(), cfg, cfg.OutputFile, ""); code != exitWriterInit {
+		t.Fatalf("run exit code = %d, want %d", code, exitWriterInit)
 	}
 }
 
@@ -179,17 +194,195 @@ func TestRun_ContextCancellation(t *testing.T) {
 	cancel()
 
 	done := make(chan int, 1)
-	go func() { done <- run(ctx, cfg, outputFile) }()
+	go func() { done <- run(ctx, cfg, outputFile, "") }()
 	select {
 	case code := <-done:
-		if code != 0 && code != 1 {
-			t.Fatalf("run exit code = %d, want 0 or 1", code)
+		if code != exitInterrupted {
+			t.Fatalf("run exit code = %d, want %d", code, exitInterrupted)
 		}
 	case <-time.After(10 * time.Second):
 		t.Fatal("run did not return within 10s after context cancellation")
 	}
 }
 
+func TestRun_FailureAfterInterruptExitsInterrupted(t *testing.T) {
+	tests := []struct {
+		name     string
+		visitErr error
+	}{
+		{"visit fails", errors.New("connection reset")},
+		{"output invalid", nil}, // nothing was written, so validation fails
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.OutputFile = filepath.Join(t.TempDir(), "books.json")
+			cfg.OutputFormat = "json"
+			cfg.MetricsAddr = ""
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := &crawlRun{cfg: cfg, outputFile: cfg.OutputFile, visit: func(context.Context, *scraper.Scraper, scraper.Sink) (*models.ScraperResult, error) {
+				cancel()
+				return &models.ScraperResult{}, tt.visitErr
+			}}
+			if code := r.execute(ctx); code != exitInterrupted {
+				t.Fatalf("run exit code = %d, want %d", code, exitInterrupted)
+			}
+		})
+	}
+}
+
+func TestRun_WriteFailureExitsOutputInvalid(t *testing.T) {
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer sink.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Sinks = []config.SinkConfig{{Format: "http", Path: sink.URL}}
+	cfg.HTTPRetries = 0
+	cfg.MetricsAddr = ""
+	r := &crawlRun{cfg: cfg, visit: func(_ context.Context, _ *scraper.Scraper, sink scraper.Sink) (*models.ScraperResult, error) {
+		return &models.ScraperResult{}, sink.Process(testBook(1, "10.00"))
+	}}
+	if code := r.execute(context.Background()); code != exitOutputInvalid {
+		t.Fatalf("run exit code = %d, want %d", code, exitOutputInvalid)
+	}
+}
+
+func TestRun_FailOnDrift(t *testing.T) {
+	srv := catalogServer(t, 0, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "books.csv")
+	cfg := config.DefaultConfig()
+	cfg.BaseURL = srv.URL
+	cfg.MaxPages = 1
+	cfg.Parallelism = 1
+	cfg.RespectRobotsTxt = false
+	cfg.MaxRetries = 0
+	cfg.OutputFile = outputFile
+	cfg.Timeout = 5 * time.Second
+	cfg.HealthBaseline = filepath.Join(dir, "baseline.json")
+	cfg.FailOnDrift = true
+
+	if code := run(context.Background(), cfg, outputFile, ""); code != exitThreshold {
+		t.Fatalf("run exit code = %d, want %d for a page without items", code, exitThreshold)
+	}
+}
+
+func TestRun_UpdatesBaselineOnlyOnSuccess(t *testing.T) {
+	srv := catalogServer(t, 2, false)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.BaseURL = srv.URL
+	cfg.MaxPages = 1
+	cfg.Parallelism = 1
+	cfg.RespectRobotsTxt = false
+	cfg.MaxRetries = 0
+	cfg.OutputFile = filepath.Join(dir, "books.csv")
+	cfg.MetricsAddr = ""
+	cfg.HealthBaseline = filepath.Join(dir, "baseline.json")
+	cfg.UpdateHealthBaseline = true
+
+	cfg.MinItems = 3
+	if code := run(context.Background(), cfg, cfg.OutputFile, ""); code != exitThreshold {
+		t.Fatalf("run exit code = %d, want %d", code, exitThreshold)
+	}
+	if _, err := os.Stat(cfg.HealthBaseline); !os.IsNotExist(err) {
+		t.Fatalf("baseline written by a run below thresholds: %v", err)
+	}
+
+	cfg.MinItems = 0
+	if code := run(context.Background(), cfg, cfg.OutputFile, ""); code != exitOK {
+		t.Fatalf("run exit code = %d, want %d", code, exitOK)
+	}
+	if _, err := os.Stat(cfg.HealthBaseline); err != nil {
+		t.Fatalf("baseline not written by a successful run: %v", err)
+	}
+}
+
+func TestRun_Thresholds(t *testing.T) {
+	srv := catalogServer(t, 2, false)
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		maxErrorRate float64
+		minItems     int
+		code         int
+	}{
+		{"within thresholds", 1, 2, exitOK},
+		{"too few items", 1, 3, exitThreshold},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "books.csv")
+			cfg := config.DefaultConfig()
+			cfg.BaseURL = srv.URL
+			cfg.MaxPages = 1
+			cfg.Parallelism = 1
+			cfg.RespectRobotsTxt = false
+			cfg.MaxRetries = 0
+			cfg.OutputFile = outputFile
+			cfg.Timeout = 5 * time.Second
+			cfg.MaxErrorRate = tt.maxErrorRate
+			cfg.MinItems = tt.minItems
+			if code := run(context.Background(), cfg, outputFile, ""); code != tt.code {
+				t.Fatalf("run exit code = %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MaxErrorRate = 0.25
+	cfg.MinItems = 10
+	err := checkThresholds(cfg, &models.ScraperResult{RequestCount: 4, ErrorCount: 2}, pipeline.PipelineStats{Processed: 3})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"error rate 0.50 exceeds the maximum of 0.25", "3 items is below the minimum of 10"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q missing %q", err, want)
+		}
+	}
+	if err := checkThresholds(cfg, &models.ScraperResult{RequestCount: 4, ErrorCount: 1}, pipeline.PipelineStats{Processed: 10}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestOpenSinks_FailureKeepsPreviousOutputs(t *testing.T) {
+	dir := t.TempDir()
+	previous := filepath.Join(dir, "books.csv")
+	if err := os.WriteFile(previous, []byte("previous\n"), 0o644); err != nil {
+		t.Fatalf("write previous output: %v", err)
+	}
+	sinks := []config.SinkConfig{
+		{Format: "csv", Path: previous},
+		{Format: "json", Path: filepath.Join(dir, "books.jsonl")},
+	}
+	_, err := openSinks(sinks, func(sink config.SinkConfig) (pipeline.OutputWriter, error) {
+		if sink.Format == "json" {
+			return nil, errors.New("disk full")
+		}
+		return createWriter(sink.Format, sink.Path, writerOptions{})
+	})
+	if err == nil {
+		t.Fatal("expected an error for the sink that cannot be opened")
+	}
+	if data, err := os.ReadFile(previous); err != nil || string(data) != "previous\n" {
+		t.Fatalf("previous output = %q, %v; want it untouched", data, err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*")); len(leftovers) != 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+}
+
 func TestCreateWriter(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -204,7 +397,7 @@ func TestCreateWriter(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			base := filepath.Join(t.TempDir(), "books.csv")
-			w, err := createWriter(tt.format, base)
+			w, err := createWriter(tt.format, base, writerOptions{})
 			if tt.wantErr {
 				if err == nil {
 					_ = w.Close()
@@ -275,11 +468,42 @@ func TestPrintSummary_ErrorAndValidationBreakdowns(t *testing.T) {
 	}
 }
 
-func TestBuildConfigFromFlags(t *testing.T) {
-	cfg := buildConfigFromFlags(
-		"http://example.com", 3, 4, 100, 50, 2, 200, 2000,
-		true, "out.csv", "DUAL", true, ":9090",
-	)
+func TestPrintSummary_DomainBreakdown(t *testing.T) {
+	result := &models.ScraperResult{
+		RequestCount: 3,
+		Domains: map[string]models.DomainResult{
+			"alpha.test": {RequestCount: 1, PageCount: 1, ItemCount: 20},
+			"beta":       {RequestCount: 2, PageCount: 2, ItemCount: 40, ErrorCount: 1},
+		},
+	}
+	var buf bytes.Buffer
+	printSummary(&buf, result, time.Second, 60.0, "out.csv", pipeline.PipelineStats{Processed: 60})
+	got := buf.String()
+	for _, want := range []string{"alpha.test:", "items=20", "beta:", "items=40 errors=1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary missing %q\ngot:\n%s", want, got)
+		}
+	}
+}
+
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestLoadConfig_Flags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, _, err := loadConfig(fs, []string{
+		"-base-url", "http://example.com", "-pages", "3", "-parallel", "4",
+		"-delay", "100", "-random-delay", "50", "-max-retries", "2",
+		"-retry-backoff", "200", "-retry-backoff-max", "2s", "-respect-robots=true",
+		"-output", "out.csv", "-format", "DUAL", "-v", "-metrics-addr", ":9090",
+	}, envMap(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
 	tests := []struct {
 		name string
 		got  interface{}
@@ -288,7 +512,7 @@ func TestBuildConfigFromFlags(t *testing.T) {
 		{"BaseURL", cfg.BaseURL, "http://example.com"},
 		{"MaxPages", cfg.MaxPages, 3},
 		{"Parallelism", cfg.Parallelism, 4},
-		{"Delay", cfg.Delay, 100 * time.Millisecond},
+		{"Delay", cfg.Delay, 100 * time.Millisecond}, // bare numbers are milliseconds
 		{"RandomDelay", cfg.RandomDelay, 50 * time.Millisecond},
 		{"MaxRetries", cfg.MaxRetries, 2},
 		{"RetryBackoff", cfg.RetryBackoff, 200 * time.Millisecond},
@@ -308,8 +532,109 @@ func TestBuildConfigFromFlags(t *testing.T) {
 	}
 }
 
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scraper.yaml")
+	data := "pages: 3\nparallel: 2\ndelay: 150ms\noutput: file.csv\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, sources, err := loadConfig(fs, []string{"-output", "flag.csv"}, envMap(map[string]string{
+		"SCRAPER_CONFIG":   path,
+		"SCRAPER_PARALLEL": "5",
+		"SCRAPER_OUTPUT":   "env.csv",
+	}))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.MaxPages != 3 || cfg.Delay != 150*time.Millisecond || cfg.Parallelism != 5 || cfg.OutputFile != "flag.csv" {
+		t.Fatalf("unexpected config: pages=%d delay=%s parallel=%d output=%q", cfg.MaxPages, cfg.Delay, cfg.Parallelism, cfg.OutputFile)
+	}
+	want := config.Sources{"pages": config.SourceFile, "parallel": config.SourceEnv, "output": config.SourceFlag, "timeout": config.SourceDefault}
+	for key, source := range want {
+		if sources[key] != source {
+			t.Fatalf("source of %s = %q, want %q", key, sources[key], source)
+		}
+	}
+}
+
+func TestLoadConfig_Env(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		def := config.DefaultConfig()
+		cfg, _, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), nil, envMap(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.MaxPages != def.MaxPages || cfg.Parallelism != def.Parallelism ||
+			cfg.OutputFile != def.OutputFile || cfg.MetricsAddr != def.MetricsAddr {
+			t.Fatalf("got pages=%d parallel=%d output=%q metrics=%q", cfg.MaxPages, cfg.Parallelism, cfg.OutputFile, cfg.MetricsAddr)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		cfg, _, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), nil, envMap(map[string]string{
+			"SCRAPER_PAGES":        "7",
+			"SCRAPER_PARALLEL":     "3",
+			"SCRAPER_OUTPUT":       "/tmp/over.csv",
+			"SCRAPER_METRICS_ADDR": ":1234",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.MaxPages != 7 || cfg.Parallelism != 3 || cfg.OutputFile != "/tmp/over.csv" || cfg.MetricsAddr != ":1234" {
+			t.Fatalf("got pages=%d parallel=%d output=%q metrics=%q", cfg.MaxPages, cfg.Parallelism, cfg.OutputFile, cfg.MetricsAddr)
+		}
+	})
+
+	t.Run("invalid_values", func(t *testing.T) {
+		_, _, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), nil, envMap(map[string]string{
+			"SCRAPER_PAGES":    "nope",
+			"SCRAPER_PARALLEL": "nope",
+		}))
+		if err == nil {
+			t.Fatal("expected error for invalid env values")
+		}
+		for _, want := range []string{"invalid SCRAPER_PAGES", "invalid SCRAPER_PARALLEL"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Fatalf("error = %v, want message containing %s", err, want)
+			}
+		}
+	})
+}
+
+func TestLoadConfig_InvalidFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, _, err := loadConfig(fs, []string{"-pages", "many"}, envMap(nil)); err == nil {
+		t.Fatal("expected error for non-numeric -pages")
+	}
+}
+
+func TestExecute_ConfigPrint(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := execute([]string{"config", "print", "-pages", "4"}, &stdout, &stderr, envMap(nil)); code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{"KEY", "pages", `"4"`, "flag", "SCRAPER_PAGES", "sites[0]"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("config print output missing %q:\n%s", want, out)
+		}
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := execute([]string{"config", "print", "-pages", "0", "-parallel", "0"}, &stdout, &stderr, envMap(nil)); code != exitConfig {
+		t.Fatalf("exit code = %d, want %d for invalid configuration", code, exitConfig)
+	}
+	if !strings.Contains(stderr.String(), "max pages") || !strings.Contains(stderr.String(), "parallelism") {
+		t.Fatalf("expected every validation problem on stderr, got %q", stderr.String())
+	}
+}
+
 func TestStartMetricsServer_EmptyAddr(t *testing.T) {
-	if srv := startMetricsServer(context.Background(), "", prometheus.NewRegistry()); srv != nil {
+	if srv := startMetricsServer(context.Background(), "", prometheus.NewRegistry(), endpoints{}); srv != nil {
 		t.Fatalf("expected nil server for empty addr, got %v", srv)
 	}
 }
@@ -321,7 +646,7 @@ func TestShutdownMetricsServer_Nil(t *testing.T) {
 
 func TestStartShutdownMetricsServer(t *testing.T) {
 	addr := freeAddr(t)
-	srv := startMetricsServer(context.Background(), addr, prometheus.NewRegistry())
+	srv := startMetricsServer(context.Background(), addr, prometheus.NewRegistry(), endpoints{})
 	if srv == nil {
 		t.Fatal("expected non-nil server")
 	}
@@ -354,7 +679,7 @@ func TestStartMetricsServer_PortConflict(t *testing.T) {
 	}
 	defer func() { _ = ln.Close() }()
 
-	srv := startMetricsServer(context.Background(), addr, prometheus.NewRegistry())
+	srv := startMetricsServer(context.Background(), addr, prometheus.NewRegistry(), endpoints{})
 	if srv == nil {
 		t.Fatal("expected non-nil server")
 	}
@@ -362,9 +687,50 @@ func TestStartMetricsServer_PortConflict(t *testing.T) {
 	shutdownMetricsServer(srv, time.Second)
 }
 
+func TestRun_StreamsToStdout(t *testing.T) {
+	const bookCount = 3
+	srv := catalogServer(t, bookCount, false)
+	defer srv.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.BaseURL = srv.URL
+	cfg.MaxPages = 1
+	cfg.RespectRobotsTxt = false
+	cfg.MaxRetries = 0
+	cfg.OutputFile = config.StdoutPath
+	cfg.OutputFormat = "json"
+	cfg.BatchSize = 1
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	var stdout, summary bytes.Buffer
+	r := &crawlRun{cfg: cfg, outputFile: cfg.OutputFile, visit: visitConfigured, summary: &summary, stdout: &stdout}
+	if code := r.execute(context.Background()); code != 0 {
+		t.Fatalf("run exit code = %d, want 0", code)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(lines) != bookCount {
+		t.Fatalf("stdout has %d lines, want %d records:\n%s", len(lines), bookCount, stdout.String())
+	}
+	for i, line := range lines {
+		var book models.Book
+		if err := json.Unmarshal([]byte(line), &book); err != nil {
+			t.Fatalf("line %d is not a record: %v\n%s", i+1, err, line)
+		}
+	}
+	if !strings.Contains(summary.String(), "Output file:   stdout") {
+		t.Errorf("summary does not name stdout:\n%s", summary.String())
+	}
+	if logOutput(cfg) != os.Stderr {
+		t.Error("logs go to stdout while records stream there")
+	}
+}
+
 func TestNewLogger(t *testing.T) {
 	for _, verbose := range []bool{true, false} {
-		logger, level := newLogger(verbose)
+		logger, level := newLogger(verbose, os.Stderr)
 		if logger == nil {
 			t.Fatalf("nil logger for verbose=%v", verbose)
 		}
@@ -373,64 +739,3 @@ func TestNewLogger(t *testing.T) {
 		}
 	}
 }
-
-func TestFlagDefaults(t *testing.T) {
-	keys := []string{"SCRAPER_PAGES", "SCRAPER_PARALLEL", "SCRAPER_OUTPUT", "SCRAPER_METRICS_ADDR"}
-	for _, k := range keys {
-		old, had := os.LookupEnv(k)
-		_ = os.Unsetenv(k)
-		t.Cleanup(func() {
-			if had {
-				_ = os.Setenv(k, old)
-			}
-		})
-	}
-
-	t.Run("defaults", func(t *testing.T) {
-		def := config.DefaultConfig()
-		pages, parallel, output, metrics, err := flagDefaults()
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-		if pages != def.MaxPages || parallel != def.Parallelism ||
-			output != def.OutputFile || metrics != def.MetricsAddr {
-			t.Fatalf("got pages=%d parallel=%d output=%q metrics=%q", pages, parallel, output, metrics)
-		}
-	})
-
-	t.Run("overrides", func(t *testing.T) {
-		t.Setenv("SCRAPER_PAGES", "7")
-		t.Setenv("SCRAPER_PARALLEL", "3")
-		t.Setenv("SCRAPER_OUTPUT", "/tmp/over.csv")
-		t.Setenv("SCRAPER_METRICS_ADDR", ":1234")
-		pages, parallel, output, metrics, err := flagDefaults()
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-		if pages != 7 || parallel != 3 || output != "/tmp/over.csv" || metrics != ":1234" {
-			t.Fatalf("got pages=%d parallel=%d output=%q metrics=%q", pages, parallel, output, metrics)
-		}
-	})
-
-	t.Run("invalid_pages", func(t *testing.T) {
-		t.Setenv("SCRAPER_PAGES", "nope")
-		_, _, _, _, err := flagDefaults()
-		if err == nil {
-			t.Fatal("expected error for invalid SCRAPER_PAGES")
-		}
-		if !strings.Contains(err.Error(), "invalid SCRAPER_PAGES") {
-			t.Fatalf("error = %v, want message containing invalid SCRAPER_PAGES", err)
-		}
-	})
-
-	t.Run("invalid_parallel", func(t *testing.T) {
-		t.Setenv("SCRAPER_PARALLEL", "nope")
-		_, _, _, _, err := flagDefaults()
-		if err == nil {
-			t.Fatal("expected error for invalid SCRAPER_PARALLEL")
-		}
-		if !strings.Contains(err.Error(), "invalid SCRAPER_PARALLEL") {
-			t.Fatalf("error = %v, want message containing invalid SCRAPER_PARALLEL", err)
-		}
-	})
-}
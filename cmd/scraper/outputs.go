@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/aluiziolira/go-scrape-books/parser"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+)
+
+// diffCommand compares two output files record by record, keyed by URL. Like
+// diff(1) it exits 0 when they match, 1 when they differ and 2 on trouble.
+func diffCommand(_ *flag.FlagSet) runFunc {
+	return func(_ context.Context, inv *invocation) int {
+		if len(inv.args) != 2 {
+			fmt.Fprintln(inv.stderr, "diff needs two output files: OLD NEW")
+			return 2
+		}
+		oldBooks, err := pipeline.ReadAll(inv.args[0])
+		if err != nil {
+			fmt.Fprintln(inv.stderr, err)
+			return 2
+		}
+		newBooks, err := pipeline.ReadAll(inv.args[1])
+		if err != nil {
+			fmt.Fprintln(inv.stderr, err)
+			return 2
+		}
+		d := diffBooks(oldBooks, newBooks)
+		d.print(inv.stdout)
+		if d.empty() {
+			return 0
+		}
+		return 1
+	}
+}
+
+// bookDiff is the difference between two sets of books keyed by URL.
+type bookDiff struct {
+	added     []*models.Book
+	removed   []*models.Book
+	changed   []bookChange
+	unchanged int
+}
+
+type bookChange struct {
+	url    string
+	fields []fieldChange
+}
+
+type fieldChange struct {
+	name     string
+	old, new string
+}
+
+// diffFields are the compared columns; scraped_at always differs and the
+// numeric columns follow their text counterparts.
+var diffFields = []struct {
+	name string
+	get  func(*models.Book) string
+}{
+	{"title", func(b *models.Book) string { return b.Title }},
+	{"price", func(b *models.Book) string { return b.Price }},
+	{"currency", func(b *models.Book) string { return b.Currency }},
+	{"rating", func(b *models.Book) string { return b.RatingText }},
+	{"availability", func(b *models.Book) string { return b.Availability }},
+	{"image_url", func(b *models.Book) string { return b.ImageURL }},
+	{"isbn", func(b *models.Book) string { return b.ISBN }},
+	{"source", func(b *models.Book) string { return b.Source }},
+}
+
+func diffBooks(oldBooks, newBooks []*models.Book) bookDiff {
+	byURL := func(books []*models.Book) map[string]*models.Book {
+		m := make(map[string]*models.Book, len(books))
+		for _, b := range books {
+			m[b.URL] = b
+		}
+		return m
+	}
+	oldByURL, newByURL := byURL(oldBooks), byURL(newBooks)
+
+	var d bookDiff
+	for url, nb := range newByURL {
+		ob, ok := oldByURL[url]
+		if !ok {
+			d.added = append(d.added, nb)
+			continue
+		}
+		var fields []fieldChange
+		for _, f := range diffFields {
+			if o, n := f.get(ob), f.get(nb); o != n {
+				fields = append(fields, fieldChange{name: f.name, old: o, new: n})
+			}
+		}
+		if len(fields) == 0 {
+			d.unchanged++
+			continue
+		}
+		d.changed = append(d.changed, bookChange{url: url, fields: fields})
+	}
+	for url, ob := range oldByURL {
+		if _, ok := newByURL[url]; !ok {
+			d.removed = append(d.removed, ob)
+		}
+	}
+
+	sort.Slice(d.added, func(i, j int) bool { return d.added[i].URL < d.added[j].URL })
+	sort.Slice(d.removed, func(i, j int) bool { return d.removed[i].URL < d.removed[j].URL })
+	sort.Slice(d.changed, func(i, j int) bool { return d.changed[i].url < d.changed[j].url })
+	return d
+}
+
+func (d bookDiff) empty() bool {
+	return len(d.added) == 0 && len(d.removed) == 0 && len(d.changed) == 0
+}
+
+func (d bookDiff) print(w io.Writer) {
+	for _, b := range d.removed {
+		fmt.Fprintf(w, "- %s  %s\n", b.URL, b.Title)
+	}
+	for _, b := range d.added {
+		fmt.Fprintf(w, "+ %s  %s\n", b.URL, b.Title)
+	}
+	for _, c := range d.changed {
+		parts := make([]string, 0, len(c.fields))
+		for _, f := range c.fields {
+			parts = append(parts, fmt.Sprintf("%s: %q -> %q", f.name, f.old, f.new))
+		}
+		fmt.Fprintf(w, "~ %s  %s\n", c.url, strings.Join(parts, "; "))
+	}
+	fmt.Fprintf(w, "%d added, %d removed, %d changed, %d unchanged\n", len(d.added), len(d.removed), len(d.changed), d.unchanged)
+}
+
+// convertCommand rewrites an output file in another format, optionally
+// normalizing and deduplicating its records as a crawl would.
+func convertCommand(fs *flag.FlagSet) runFunc {
+	format := fs.String("to", "", "Output format: csv, json, arrow, parquet, avro, xlsx, html or template (default: template with -template, else taken from the OUT extension)")
+	tmpl := fs.String("template", "", "text/template file to render OUT with, for the template format (default: the configured template)")
+	normalize := fs.Bool("normalize", false, "Re-run the pipeline's price, availability and rating normalization on every record")
+	dedupe := fs.Bool("dedupe", false, "Keep only the first record of each URL")
+	return func(_ context.Context, inv *invocation) int {
+		if len(inv.args) != 2 {
+			fmt.Fprintln(inv.stderr, "convert needs an input and an output file: IN OUT")
+			return 2
+		}
+		c := conversion{
+			Writer:    writerOptions{Template: *tmpl},
+			BatchSize: inv.cfg.BatchSize,
+			Normalize: *normalize,
+			Dedupe:    *dedupe,
+		}
+		if c.Writer.Template == "" {
+			c.Writer.Template = inv.cfg.TemplateFile
+		}
+		switch {
+		case *format != "":
+			c.Format = *format
+		case *tmpl != "":
+			c.Format = "template"
+		default:
+			c.Format = formatForPath(inv.args[1])
+		}
+		if c.Format == "template" && c.Writer.Template == "" {
+			fmt.Fprintln(inv.stderr, "convert -to template needs a -template file")
+			return 2
+		}
+		res, err := convertFile(inv.args[0], inv.args[1], c)
+		if err != nil {
+			fmt.Fprintln(inv.stderr, err)
+			return 1
+		}
+		fmt.Fprintf(inv.stdout, "converted %d records from %s to %s", res.Written, inv.args[0], inv.args[1])
+		if c.Dedupe {
+			fmt.Fprintf(inv.stdout, ", dropped %d duplicate URLs", res.Duplicates)
+		}
+		if res.Unparseable > 0 {
+			fmt.Fprintf(inv.stdout, ", %d with unparseable prices", res.Unparseable)
+		}
+		fmt.Fprintln(inv.stdout)
+		return 0
+	}
+}
+
+// schemaCommand prints the JSON Schema of the records the JSON writer writes
+// with the configured fields, so consumers can validate outputs.
+func schemaCommand(_ *flag.FlagSet) runFunc {
+	return func(_ context.Context, inv *invocation) int {
+		fields, err := inv.cfg.OutputFields()
+		if err != nil {
+			fmt.Fprintf(inv.stderr, "invalid output fields: %v\n", err)
+			return exitConfig
+		}
+		enc := json.NewEncoder(inv.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(pipeline.JSONSchema(fields...)); err != nil {
+			fmt.Fprintln(inv.stderr, err)
+			return 1
+		}
+		return exitOK
+	}
+}
+
+// formatForPath guesses the writer format from a file extension.
+func formatForPath(path string) string {
+	if f, ok := pipeline.FormatForPath(path); ok {
+		return f.Name
+	}
+	return "csv"
+}
+
+// conversion is what convertFile does with the records it reads.
+type conversion struct {
+	Format    string
+	Writer    writerOptions
+	BatchSize int
+	Normalize bool // re-run the pipeline's normalization on every record
+	Dedupe    bool // keep only the first record of each URL
+}
+
+// convertResult counts what convertFile did.
+type convertResult struct {
+	Written     int
+	Duplicates  int // records dropped by Dedupe
+	Unparseable int // records whose price Normalize could not parse
+}
+
+// convertFile reads every record of in and writes them to a new writer for
+// out, c.BatchSize records at a time. The input is read completely first and
+// the output validated before it is published, so a malformed input or a
+// failed write never leaves a partial output behind.
+func convertFile(in, out string, c conversion) (convertResult, error) {
+	books, err := pipeline.ReadAll(in)
+	if err != nil {
+		return convertResult{}, err
+	}
+	books, res := c.prepare(books)
+	batchSize := c.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(books) + 1
+	}
+
+	writer, err := createWriter(c.Format, out, c.Writer)
+	if err != nil {
+		return res, err
+	}
+	for start := 0; start < len(books); start += batchSize {
+		end := min(start+batchSize, len(books))
+		if err := writer.Write(books[start:end]); err != nil {
+			_ = pipeline.Abort(writer)
+			res.Written = start
+			return res, err
+		}
+	}
+	if err := writer.Validate(); err != nil {
+		_ = pipeline.Abort(writer)
+		return res, fmt.Errorf("validate %s: %w", out, err)
+	}
+	if err := writer.Close(); err != nil {
+		return res, err
+	}
+	res.Written = len(books)
+	return res, nil
+}
+
+// prepare drops duplicate URLs and normalizes books as c asks.
+func (c conversion) prepare(books []*models.Book) ([]*models.Book, convertResult) {
+	var res convertResult
+	seen := make(map[string]struct{})
+	kept := books[:0]
+	for _, book := range books {
+		if c.Dedupe {
+			if _, ok := seen[book.URL]; ok {
+				res.Duplicates++
+				continue
+			}
+			seen[book.URL] = struct{}{}
+		}
+		if c.Normalize && pipeline.NormalizeBook(book) != nil {
+			res.Unparseable++
+		}
+		kept = append(kept, book)
+	}
+	return kept, res
+}
+
+// validateCommand checks the configuration and then every output file named
+// on the command line. An invalid configuration exits with exitConfig and an
+// invalid output file with exitOutputInvalid.
+func validateCommand(_ *flag.FlagSet) runFunc {
+	return func(_ context.Context, inv *invocation) int {
+		code := exitOK
+		if err := inv.cfg.Validate(); err != nil {
+			fmt.Fprintf(inv.stderr, "invalid configuration:\n%v\n", err)
+			code = exitConfig
+		} else {
+			fmt.Fprintln(inv.stdout, "configuration: ok")
+		}
+		for _, path := range inv.args {
+			if err := validateOutput(inv.stdout, path); err != nil {
+				fmt.Fprintf(inv.stderr, "%s: %v\n", path, err)
+				if code == exitOK {
+					code = exitOutputInvalid
+				}
+			}
+		}
+		return code
+	}
+}
+
+// validateOutput reads every record of path, reporting records that fail
+// parser.ValidateBook and URLs that occur more than once.
+func validateOutput(w io.Writer, path string) error {
+	books, err := pipeline.ReadAll(path)
+	if err != nil {
+		return err
+	}
+	if len(books) == 0 {
+		return fmt.Errorf("no records")
+	}
+
+	var problems []error
+	seen := make(map[string]int, len(books))
+	for i, book := range books {
+		if err := parser.ValidateBook(book); err != nil {
+			problems = append(problems, fmt.Errorf("record %d: %w", i+1, err))
+		}
+		if first, ok := seen[book.URL]; ok {
+			problems = append(problems, fmt.Errorf("record %d: duplicate url %s (first seen in record %d)", i+1, book.URL, first))
+			continue
+		}
+		seen[book.URL] = i + 1
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d of %d records have problems:\n%w", len(problems), len(books), errors.Join(problems...))
+	}
+	fmt.Fprintf(w, "%s: %d records ok\n", path, len(books))
+	return nil
+}
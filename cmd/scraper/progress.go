@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dashboardRefresh is how often the terminal dashboard is redrawn.
+const dashboardRefresh = 500 * time.Millisecond
+
+// console serialises writes to a terminal and keeps the live dashboard as
+// the last lines on screen: each write erases the dashboard, prints above
+// it, and draws it again.
+type console struct {
+	mu    sync.Mutex
+	w     io.Writer
+	frame string
+	lines int // lines of frame currently on screen
+}
+
+// The consoles of stdout and stderr, for when they are terminals: newLogger
+// writes through the one logs go to so log lines and the dashboard do not
+// overwrite each other.
+var (
+	stdoutConsole = &console{w: os.Stdout}
+	stderrConsole = &console{w: os.Stderr}
+)
+
+// consoleOf returns the console of f, stdout or stderr.
+func consoleOf(f *os.File) *console {
+	if f == os.Stderr {
+		return stderrConsole
+	}
+	return stdoutConsole
+}
+
+func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eraseLocked()
+	n, err := c.w.Write(p)
+	c.drawLocked()
+	return n, err
+}
+
+// show replaces the dashboard on screen with frame.
+func (c *console) show(frame string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eraseLocked()
+	c.frame = frame
+	c.drawLocked()
+}
+
+// release leaves the dashboard on screen as ordinary output and stops
+// redrawing it.
+func (c *console) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frame, c.lines = "", 0
+}
+
+func (c *console) eraseLocked() {
+	if c.lines == 0 {
+		return
+	}
+	// Move to the first line of the frame and clear to the end of screen.
+	fmt.Fprintf(c.w, "\x1b[%dA\r\x1b[J", c.lines)
+	c.lines = 0
+}
+
+func (c *console) drawLocked() {
+	if c.frame == "" {
+		return
+	}
+	_, _ = io.WriteString(c.w, c.frame)
+	c.lines = strings.Count(c.frame, "\n")
+}
+
+// progressSnapshot is the state of a running crawl shown by the dashboard
+// and the periodic progress log.
+type progressSnapshot struct {
+	Elapsed        time.Duration
+	Pages          int
+	MaxPages       int
+	Items          int64
+	InFlight       int
+	PendingRetries int
+	Buffered       int
+	BufferCap      int
+	ErrorsByType   map[string]int
+}
+
+func (p progressSnapshot) itemsPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Items) / p.Elapsed.Seconds()
+}
+
+// eta extrapolates the page rate so far to MaxPages. It is an upper bound,
+// since a site may run out of pages first, and unknown before the first page.
+func (p progressSnapshot) eta() (time.Duration, bool) {
+	if p.Pages >= p.MaxPages {
+		return 0, true
+	}
+	if p.Pages == 0 {
+		return 0, false
+	}
+	perPage := p.Elapsed / time.Duration(p.Pages)
+	return perPage * time.Duration(p.MaxPages-p.Pages), true
+}
+
+// errorSummary lists the error counts as category=count, sorted by category.
+func (p progressSnapshot) errorSummary() string {
+	if len(p.ErrorsByType) == 0 {
+		return "none"
+	}
+	categories := make([]string, 0, len(p.ErrorsByType))
+	for category := range p.ErrorsByType {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	parts := make([]string, len(categories))
+	for i, category := range categories {
+		parts[i] = fmt.Sprintf("%s=%d", category, p.ErrorsByType[category])
+	}
+	return strings.Join(parts, " ")
+}
+
+// renderDashboard draws the terminal dashboard for p.
+func renderDashboard(p progressSnapshot) string {
+	const barWidth = 30
+	done := 0.0
+	if p.MaxPages > 0 {
+		done = min(float64(p.Pages)/float64(p.MaxPages), 1)
+	}
+	filled := int(done * barWidth)
+	eta := "unknown"
+	if d, ok := p.eta(); ok {
+		eta = d.Round(time.Second).String()
+	}
+	fill := 0.0
+	if p.BufferCap > 0 {
+		fill = float64(p.Buffered) / float64(p.BufferCap)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pages     %d/%d [%s%s] %3.0f%%\n", p.Pages, p.MaxPages, strings.Repeat("#", filled), strings.Repeat(".", barWidth-filled), done*100)
+	fmt.Fprintf(&b, "Items     %d (%.1f/s)  elapsed %s  ETA %s\n", p.Items, p.itemsPerSecond(), p.Elapsed.Round(time.Second), eta)
+	fmt.Fprintf(&b, "Requests  %d in flight, %d retries pending\n", p.InFlight, p.PendingRetries)
+	fmt.Fprintf(&b, "Pipeline  %d/%d buffered (%.0f%%)\n", p.Buffered, p.BufferCap, fill*100)
+	fmt.Fprintf(&b, "Errors    %s\n", p.errorSummary())
+	return b.String()
+}
+
+// logProgress writes p as one structured "crawl progress" event.
+func logProgress(p progressSnapshot) {
+	attrs := []any{
+		slog.Int("pages", p.Pages),
+		slog.Int("max_pages", p.MaxPages),
+		slog.Int64("items", p.Items),
+		slog.Float64("items_per_sec", p.itemsPerSecond()),
+		slog.Int("in_flight", p.InFlight),
+		slog.Int("pending_retries", p.PendingRetries),
+		slog.Int("buffered", p.Buffered),
+		slog.Int("buffer_capacity", p.BufferCap),
+		slog.Any("errors_by_type", p.ErrorsByType),
+	}
+	if eta, ok := p.eta(); ok {
+		attrs = append(attrs, slog.Duration("eta", eta))
+	}
+	slog.Info("crawl progress", attrs...)
+}
+
+// snapshotProgress reads the live counters of the run, which started at
+// started. It reports false before the scraper exists.
+func (r *crawlRun) snapshotProgress(started time.Time) (progressSnapshot, bool) {
+	result, stats := r.progress()
+	if result == nil {
+		return progressSnapshot{}, false
+	}
+	snap := progressSnapshot{
+		Elapsed:        time.Since(started),
+		Pages:          result.PageCount,
+		InFlight:       result.InFlight,
+		PendingRetries: result.PendingRetries,
+		ErrorsByType:   result.ErrorsByType,
+	}
+	for _, site := range r.cfg.ResolvedSites() {
+		snap.MaxPages += site.MaxPages
+	}
+	if stats != nil {
+		snap.Items = stats.Processed
+	}
+	r.mu.Lock()
+	p := r.pipeline
+	r.mu.Unlock()
+	if p != nil {
+		snap.Buffered, snap.BufferCap = p.QueueFill()
+	}
+	return snap, true
+}
+
+// watchProgress reports the progress of r, which started at started, until
+// the returned func is called: as a dashboard redrawn in place when the log
+// output is a terminal, otherwise as a log event every cfg.ProgressInterval.
+func (r *crawlRun) watchProgress(started time.Time) (stop func()) {
+	interval := r.cfg.ProgressInterval
+	if !r.showProgress || interval <= 0 {
+		return func() {}
+	}
+	out := logOutput(r.cfg)
+	tty, terminal := isTerminal(out), consoleOf(out)
+	if tty {
+		interval = dashboardRefresh
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				snap, ok := r.snapshotProgress(started)
+				switch {
+				case !ok:
+				case tty:
+					terminal.show(renderDashboard(snap))
+				default:
+					logProgress(snap)
+				}
+			case <-done:
+				if snap, ok := r.snapshotProgress(started); ok && tty {
+					terminal.show(renderDashboard(snap))
+					terminal.release()
+				}
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
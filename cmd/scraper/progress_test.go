@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+)
+
+func TestConsole_RedrawsFrameBelowWrites(t *testing.T) {
+	var out bytes.Buffer
+	c := &console{w: &out}
+	c.show("a\nb\n")
+	fmt.Fprintln(c, "log line")
+	c.show("c\n")
+	c.release()
+	fmt.Fprintln(c, "after")
+
+	want := "a\nb\n" + "\x1b[2A\r\x1b[J" + "log line\n" + "a\nb\n" + "\x1b[2A\r\x1b[J" + "c\n" + "after\n"
+	if got := out.String(); got != want {
+		t.Fatalf("console output = %q, want %q", got, want)
+	}
+}
+
+func TestRenderDashboard(t *testing.T) {
+	got := renderDashboard(progressSnapshot{
+		Elapsed:        10 * time.Second,
+		Pages:          5,
+		MaxPages:       20,
+		Items:          100,
+		InFlight:       3,
+		PendingRetries: 1,
+		Buffered:       64,
+		BufferCap:      512,
+		ErrorsByType:   map[string]int{"timeout": 2, "http_5xx": 1},
+	})
+	for _, want := range []string{
+		"Pages     5/20 [#######.......................]  25%",
+		"Items     100 (10.0/s)  elapsed 10s  ETA 30s",
+		"Requests  3 in flight, 1 retries pending",
+		"Pipeline  64/512 buffered (12%)",
+		"Errors    http_5xx=1 timeout=2",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("dashboard missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "\n") != 5 {
+		t.Fatalf("dashboard should be 5 lines:\n%s", got)
+	}
+}
+
+func TestProgressSnapshot_ETA(t *testing.T) {
+	if _, ok := (progressSnapshot{MaxPages: 10}).eta(); ok {
+		t.Fatal("ETA should be unknown before the first page")
+	}
+	if eta, ok := (progressSnapshot{Pages: 10, MaxPages: 10}).eta(); !ok || eta != 0 {
+		t.Fatalf("ETA = %s/%v, want 0 once every page is visited", eta, ok)
+	}
+}
+
+func TestWatchProgress_LogsWhenNotATerminal(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, buildCatalogPage(2, false))
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	cfg := config.DefaultConfig()
+	cfg.BaseURL = srv.URL
+	cfg.MaxPages = 1
+	cfg.RespectRobotsTxt = false
+	cfg.ProgressInterval = 10 * time.Millisecond
+	r := &crawlRun{cfg: cfg, outputFile: filepath.Join(t.TempDir(), "books.csv"), visit: visitConfigured, showProgress: true}
+	if code := r.execute(context.Background()); code != exitOK {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	var event struct {
+		MaxPages int `json:"max_pages"`
+	}
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, `"msg":"crawl progress"`) {
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				t.Fatalf("decode %s: %v", line, err)
+			}
+			if event.MaxPages != 1 {
+				t.Fatalf("max_pages = %d, want 1", event.MaxPages)
+			}
+			return
+		}
+	}
+	t.Fatalf("no crawl progress event logged:\n%s", logs.String())
+}
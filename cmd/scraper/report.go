@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+)
+
+// runReport is the machine-readable account of one crawl written by -report.
+// CI and orchestration read it to decide whether to publish the outputs.
+type runReport struct {
+	StartedAt       time.Time               `json:"started_at"`
+	FinishedAt      time.Time               `json:"finished_at"`
+	DurationSeconds float64                 `json:"duration_seconds"`
+	ExitCode        int                     `json:"exit_code"`
+	Error           string                  `json:"error,omitempty"`
+	Config          map[string]any          `json:"config"`
+	Result          *models.ScraperResult   `json:"result"`
+	Pipeline        *pipeline.PipelineStats `json:"pipeline"`
+	Latency         latencyReport           `json:"request_latency_ms"`
+	Throughput      throughputReport        `json:"throughput"`
+	Outputs         []outputReport          `json:"outputs"`
+}
+
+// latencyReport is models.LatencySummary in milliseconds.
+type latencyReport struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+type throughputReport struct {
+	ItemsPerSecond    float64 `json:"items_per_second"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+}
+
+// outputReport describes one file the run wrote. Bytes is the size on disk;
+// for a compressed file RawBytes is the size once decompressed.
+type outputReport struct {
+	Path        string `json:"path"`
+	Bytes       int64  `json:"bytes"`
+	Compression string `json:"compression,omitempty"`
+	RawBytes    int64  `json:"raw_bytes"`
+	Records     int    `json:"records"`
+	SHA256      string `json:"sha256"`
+	Error       string `json:"error,omitempty"`
+}
+
+// report assembles the run report of r, which ran from started to finished
+// and exited with code.
+func (r *crawlRun) report(started, finished time.Time, code int) *runReport {
+	rep := &runReport{
+		StartedAt:       started,
+		FinishedAt:      finished,
+		DurationSeconds: finished.Sub(started).Seconds(),
+		ExitCode:        code,
+		Config:          r.cfg.Redacted(),
+		Outputs:         []outputReport{},
+	}
+	if err := r.failure(); err != nil {
+		rep.Error = err.Error()
+	}
+
+	rep.Result, rep.Pipeline = r.progress()
+	if rep.Result != nil {
+		ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+		l := rep.Result.RequestLatency
+		rep.Latency = latencyReport{Count: l.Count, Mean: ms(l.Mean), P50: ms(l.P50), P90: ms(l.P90), P95: ms(l.P95), P99: ms(l.P99), Max: ms(l.Max)}
+		if secs := rep.DurationSeconds; secs > 0 {
+			rep.Throughput.RequestsPerSecond = float64(rep.Result.RequestCount) / secs
+			if rep.Pipeline != nil {
+				rep.Throughput.ItemsPerSecond = float64(rep.Pipeline.Processed) / secs
+			}
+		}
+	}
+
+	for _, path := range r.outputs {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		rep.Outputs = append(rep.Outputs, describeOutput(path))
+	}
+	return rep
+}
+
+// describeOutput measures, checksums and counts the records of an output
+// file. Problems are recorded on the entry rather than failing the report.
+func describeOutput(path string) outputReport {
+	out := outputReport{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		out.Error = fmt.Sprintf("checksum: %v", err)
+		return out
+	}
+	out.Bytes, out.RawBytes, out.SHA256 = n, n, hex.EncodeToString(h.Sum(nil))
+	if out.Compression = pipeline.CompressionForPath(path); out.Compression != pipeline.CompressionNone {
+		if out.RawBytes, err = pipeline.UncompressedSize(path); err != nil {
+			out.Error = fmt.Sprintf("decompress: %v", err)
+			return out
+		}
+	}
+
+	if strings.HasSuffix(path, ".manifest.json") {
+		return out // a rotation manifest holds no records
+	}
+	reader, err := pipeline.OpenReader(path)
+	if errors.Is(err, pipeline.ErrNoReader) {
+		return out // a template output cannot be read back to count its records
+	}
+	if err != nil {
+		out.Error = fmt.Sprintf("count records: %v", err)
+		return out
+	}
+	defer func() { _ = reader.Close() }()
+	for {
+		_, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		if err != nil {
+			out.Error = fmt.Sprintf("count records: %v", err)
+			return out
+		}
+		out.Records++
+	}
+}
+
+// writeReport writes rep as indented JSON to path, replacing any earlier
+// report only once the new one is complete.
+func writeReport(path string, rep *runReport) error {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode run report: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create report directory: %w", err)
+	}
+	// A unique temp name keeps concurrent runs sharing a report path from
+	// writing into each other's temp file.
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create run report temp file: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err == nil {
+		err = f.Chmod(0o644) // CreateTemp opens it 0600; keep the report readable
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("write run report: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("publish run report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/scraper"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// maxJobRequestBytes bounds the size of a POST /jobs body.
+const maxJobRequestBytes = 1 << 20
+
+// serveCommand runs the crawl control API until the context is cancelled:
+//
+//	POST /jobs                      queue a crawl; the body is a JSON object of config overrides
+//	GET  /jobs                      list jobs
+//	GET  /jobs/{id}                 job status with live ScraperResult and PipelineStats
+//	POST /jobs/{id}/cancel          cancel a queued or running job
+//	GET  /jobs/{id}/outputs         list the files a finished job wrote
+//	GET  /jobs/{id}/outputs/{name}  download one of them
+//	GET  /metrics                   Prometheus metrics shared by every job
+//	GET  /healthz, /readyz          liveness and readiness probes
+//	GET  /debug/pprof/              profiles, with -pprof
+func serveCommand(_ *flag.FlagSet) runFunc {
+	return func(ctx context.Context, inv *invocation) int {
+		if err := inv.cfg.Validate(); err != nil {
+			slog.Error("invalid configuration", slog.Any("error", err))
+			return exitConfig
+		}
+
+		metrics := scraper.NewMetrics()
+		metrics.Registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		jobs := newJobManager(ctx, inv.cfg, metrics)
+
+		srv := &http.Server{
+			Addr:              inv.cfg.ServeAddr,
+			Handler:           newServeMux(jobs, metrics, endpoints{pprof: inv.cfg.Pprof}),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		code := serveUntilDone(ctx, srv)
+		jobs.wait()
+		return code
+	}
+}
+
+// newServeMux routes the control API and the operational routes of e.
+func newServeMux(jobs *jobManager, metrics *scraper.Metrics, e endpoints) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+	e.register(mux)
+
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		override := map[string]any{}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJobRequestBytes))
+		decoder.UseNumber()
+		if err := decoder.Decode(&override); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "decode job request: "+err.Error())
+			return
+		}
+		j, err := jobs.submit(override)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+j.id)
+		writeJSON(w, http.StatusAccepted, j.status())
+	})
+
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, _ *http.Request) {
+		list := jobs.list()
+		statuses := make([]jobStatus, 0, len(list))
+		for _, j := range list {
+			statuses = append(statuses, j.status())
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"jobs": statuses})
+	})
+
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		j, err := jobs.get(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, j.status())
+	})
+
+	mux.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		j, err := jobs.cancel(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, j.status())
+	})
+
+	mux.HandleFunc("GET /jobs/{id}/outputs", func(w http.ResponseWriter, r *http.Request) {
+		j, ok := finishedJob(w, jobs, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		outputs := j.outputs()
+		if outputs == nil {
+			outputs = []jobOutput{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"outputs": outputs})
+	})
+
+	mux.HandleFunc("GET /jobs/{id}/outputs/{name}", func(w http.ResponseWriter, r *http.Request) {
+		j, ok := finishedJob(w, jobs, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		path, err := j.outputPath(r.PathValue("name"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+r.PathValue("name")+`"`)
+		http.ServeFile(w, r, path)
+	})
+	return mux
+}
+
+// finishedJob looks up a job whose outputs may be read, writing the error
+// response itself when there is none.
+func finishedJob(w http.ResponseWriter, jobs *jobManager, id string) (*job, bool) {
+	j, err := jobs.get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	}
+	if st := j.status().State; st == jobQueued || st == jobRunning {
+		writeError(w, http.StatusConflict, "job "+id+" is still "+string(st))
+		return nil, false
+	}
+	return j, true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("encode response", slog.Any("error", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// serveUntilDone runs srv until ctx is cancelled and then shuts it down
+// gracefully.
+func serveUntilDone(ctx context.Context, srv *http.Server) int {
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	slog.Info("server listening", slog.String("addr", srv.Addr))
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server failed", slog.Any("error", err))
+			return 1
+		}
+		return 0
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutdown signal received, stopping server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server shutdown failed", slog.Any("error", err))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"github.com/aluiziolira/go-scrape-books/scraper"
+)
+
+// newTestAPI starts the control API over a job manager rooted in a temp dir.
+func newTestAPI(t *testing.T, maxJobs int) (*httptest.Server, *jobManager) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RespectRobotsTxt = false
+	cfg.MaxRetries = 0
+	cfg.MaxPages = 1
+	cfg.JobsDir = t.TempDir()
+	cfg.MaxConcurrentJobs = maxJobs
+
+	ctx, cancel := context.WithCancel(context.Background())
+	metrics := scraper.NewMetrics()
+	jobs := newJobManager(ctx, cfg, metrics)
+	api := httptest.NewServer(newServeMux(jobs, metrics, endpoints{}))
+	t.Cleanup(func() {
+		api.Close()
+		cancel()
+		jobs.wait()
+	})
+	return api, jobs
+}
+
+func doJSON(t *testing.T, method, url, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func waitForState(t *testing.T, api *httptest.Server, id string, want jobState) jobStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var st jobStatus
+		doJSON(t, http.MethodGet, api.URL+"/jobs/"+id, "", &st)
+		if st.State == want {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s state = %q, want %q (error: %s)", id, st.State, want, st.Error)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestServe_JobLifecycle(t *testing.T) {
+	target := catalogServer(t, 3, false)
+	defer target.Close()
+	api, _ := newTestAPI(t, 1)
+
+	var created jobStatus
+	if code := doJSON(t, http.MethodPost, api.URL+"/jobs", `{"base_url":"`+target.URL+`","format":"json","batch_size":1}`, &created); code != http.StatusAccepted {
+		t.Fatalf("POST /jobs = %d, want 202", code)
+	}
+	st := waitForState(t, api, created.ID, jobSucceeded)
+	if st.Result == nil || st.Result.RequestCount != 1 || st.Pipeline == nil || st.Pipeline.Processed != 3 {
+		t.Fatalf("unexpected progress: result=%+v pipeline=%+v", st.Result, st.Pipeline)
+	}
+	if len(st.Outputs) != 2 || st.Outputs[0].Name != "books.jsonl" || st.Outputs[1].Name != "report.json" {
+		t.Fatalf("outputs = %+v, want books.jsonl and report.json", st.Outputs)
+	}
+	var rep runReport
+	if code := doJSON(t, http.MethodGet, api.URL+"/jobs/"+created.ID+"/outputs/report.json", "", &rep); code != http.StatusOK {
+		t.Fatalf("download report = %d", code)
+	}
+	if rep.ExitCode != 0 || len(rep.Outputs) != 1 || rep.Outputs[0].Records != 3 {
+		t.Fatalf("job report = %+v", rep)
+	}
+
+	resp, err := http.Get(api.URL + "/jobs/" + created.ID + "/outputs/books.jsonl")
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Count(string(data), "\n") != 3 {
+		t.Fatalf("download status=%d body=%q", resp.StatusCode, data)
+	}
+	if code := doJSON(t, http.MethodGet, api.URL+"/jobs/"+created.ID+"/outputs/..%2Fbooks.jsonl", "", nil); code != http.StatusNotFound {
+		t.Fatalf("path traversal status = %d, want 404", code)
+	}
+
+	var list struct{ Jobs []jobStatus }
+	doJSON(t, http.MethodGet, api.URL+"/jobs", "", &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != created.ID {
+		t.Fatalf("GET /jobs = %+v", list.Jobs)
+	}
+
+	resp, err = http.Get(api.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	data, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(data), "scraper_items_scraped_total") {
+		t.Fatal("metrics endpoint does not expose the shared scraper registry")
+	}
+	if !strings.Contains(string(data), "pipeline_records_processed_total 3") {
+		t.Fatal("metrics endpoint does not expose the pipeline collectors")
+	}
+}
+
+func TestServe_QueueAndCancel(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	api, _ := newTestAPI(t, 1)
+
+	body := `{"base_url":"` + slow.URL + `","timeout":"300ms"}`
+	var first, second jobStatus
+	doJSON(t, http.MethodPost, api.URL+"/jobs", body, &first)
+	waitForState(t, api, first.ID, jobRunning)
+	doJSON(t, http.MethodPost, api.URL+"/jobs", body, &second)
+	if second.State != jobQueued {
+		t.Fatalf("second job state = %q, want queued behind the concurrency limit", second.State)
+	}
+	if code := doJSON(t, http.MethodGet, api.URL+"/jobs/"+second.ID+"/outputs", "", nil); code != http.StatusConflict {
+		t.Fatalf("outputs of a queued job = %d, want 409", code)
+	}
+
+	if code := doJSON(t, http.MethodPost, api.URL+"/jobs/"+second.ID+"/cancel", "", nil); code != http.StatusAccepted {
+		t.Fatalf("cancel = %d, want 202", code)
+	}
+	waitForState(t, api, second.ID, jobCancelled)
+	doJSON(t, http.MethodPost, api.URL+"/jobs/"+first.ID+"/cancel", "", nil)
+	waitForState(t, api, first.ID, jobCancelled)
+}
+
+func TestServe_RejectsBadJobs(t *testing.T) {
+	api, _ := newTestAPI(t, 1)
+	for _, body := range []string{
+		`{"pages":"many"}`,
+		`{"output":"/etc/passwd"}`,
+		`{"publish":true}`,
+		`{"compress":"gzip","retain":1}`,
+		`{"nope":1}`,
+		`not json`,
+	} {
+		var resp map[string]string
+		if code := doJSON(t, http.MethodPost, api.URL+"/jobs", body, &resp); code != http.StatusBadRequest || resp["error"] == "" {
+			t.Fatalf("POST %s = %d %v, want 400 with an error", body, code, resp)
+		}
+	}
+	var resp map[string]string
+	doJSON(t, http.MethodPost, api.URL+"/jobs", `{"pages":1,"publish":true}`, &resp)
+	if !strings.Contains(resp["error"], `setting "publish" cannot be overridden per job`) {
+		t.Fatalf("publish override error = %q", resp["error"])
+	}
+	if code := doJSON(t, http.MethodGet, api.URL+"/jobs/missing", "", nil); code != http.StatusNotFound {
+		t.Fatalf("GET unknown job = %d, want 404", code)
+	}
+}
+
+func TestServe_JobsKeepSinksInTheirOwnDirectory(t *testing.T) {
+	target := catalogServer(t, 3, false)
+	defer target.Close()
+	_, jobs := newTestAPI(t, 2)
+	shared := t.TempDir()
+	jobs.base.Sinks = []config.SinkConfig{
+		{Format: "csv", Path: filepath.Join(shared, "books.csv")},
+		{Format: "json", Path: filepath.Join(shared, "books.jsonl")},
+	}
+	jobs.base.Publish = true
+	jobs.base.HealthBaseline = filepath.Join(shared, "baseline.json")
+	jobs.base.UpdateHealthBaseline = true
+
+	var submitted []*job
+	for range 2 {
+		j, err := jobs.submit(map[string]any{"base_url": target.URL})
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		submitted = append(submitted, j)
+	}
+	jobs.wait()
+
+	for _, j := range submitted {
+		if st := j.status(); st.State != jobSucceeded {
+			t.Fatalf("job %s state = %q (error: %s)", j.id, st.State, st.Error)
+		}
+		if j.cfg.Publish || j.cfg.UpdateHealthBaseline {
+			t.Errorf("job %s publishes or updates the baseline", j.id)
+		}
+		for _, name := range []string{"books.csv", "books.jsonl"} {
+			books, err := pipeline.ReadAll(filepath.Join(j.dir, name))
+			if err != nil || len(books) != 3 {
+				t.Fatalf("job %s %s: %d books, %v", j.id, name, len(books), err)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(shared); len(entries) != 0 {
+		t.Fatalf("shared directory written by jobs: %v", entries)
+	}
+}
+
+func TestJobManager_PrunesFinishedJobs(t *testing.T) {
+	target := catalogServer(t, 1, false)
+	defer target.Close()
+	_, jobs := newTestAPI(t, 1)
+	jobs.keep = 2
+
+	var ids []string
+	for range 4 {
+		j, err := jobs.submit(map[string]any{"base_url": target.URL})
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		ids = append(ids, j.id)
+	}
+	jobs.wait()
+
+	list := jobs.list()
+	if len(list) != 2 || list[0].id != ids[2] || list[1].id != ids[3] {
+		t.Fatalf("remembered jobs = %d, want the newest 2", len(list))
+	}
+	if _, err := jobs.get(ids[0]); err != errJobNotFound {
+		t.Fatalf("oldest job: err = %v, want errJobNotFound", err)
+	}
+}
@@ -1,13 +1,22 @@
 package config
 
 import (
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"net/url"
-	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
 )
 
+// DefaultProfile names the extraction profile used when a site does not pick one.
+const DefaultProfile = "books.toscrape"
+
 // Config holds scraper configuration.
 type Config struct {
 	BaseURL            string
@@ -20,7 +29,9 @@ type Config struct {
 	RetryBackoff       time.Duration
 	RetryBackoffMax    time.Duration
 	OutputFile         string
-	OutputFormat       string // csv, json, or dual
+	OutputFormat       string // csv, json, arrow, parquet, avro, xlsx, html, template, or dual
+	TemplateFile       string // text/template file the template format renders
+	Compression        string // gzip or zstd; empty follows the OutputFile extension (.gz, .zst)
 	UserAgent          string
 	Verbose            bool
 	RespectRobotsTxt   bool
@@ -28,6 +39,115 @@ type Config struct {
 	BatchSize          int
 	DedupeMaxSize      int
 	MetricsAddr        string
+	Sites              []SiteConfig
+
+	// Sinks, when set, replace OutputFile and OutputFormat: every record is
+	// written to each sink concurrently. The dual format is shorthand for a
+	// CSV sink at OutputFile and a JSON sink next to it.
+	Sinks []SinkConfig
+
+	// Fields and ExcludeFields select the fields of every output record, as
+	// comma separated field names: Fields picks and orders them (default:
+	// every field, in models.Book order) and ExcludeFields drops some.
+	Fields        string
+	ExcludeFields string
+
+	// Output rotation: split the output into shards of RotateRecords records
+	// or RotateBytes bytes, and/or one set of shards per value of the
+	// PartitionBy field, listed in a manifest next to them.
+	RotateRecords int
+	RotateBytes   int
+	PartitionBy   string
+
+	// HTTP sinks: how batches are POSTed to sinks of the http format. The
+	// token is sent as a bearer token; headers are name=value pairs, comma
+	// separated with CSV quoting. Retries back off like crawl retries.
+	HTTPToken   string
+	HTTPHeaders string
+	HTTPBody    string // ndjson or json
+	HTTPGzip    bool
+	HTTPRetries int
+
+	// Publish stages every output of a run in a directory of its own and,
+	// if the run succeeds, publishes them together by atomically repointing
+	// the outputs' directory, a symlink, at it.
+	Publish bool
+
+	// ProgressInterval is how often a crawl logs a progress event when stdout
+	// is not a terminal. On a terminal a live dashboard is shown instead. 0
+	// disables both.
+	ProgressInterval time.Duration
+
+	// Pprof serves the net/http/pprof profiles under /debug/pprof/ on the
+	// metrics server (and the serve command's API). Off by default because
+	// profiles expose internals.
+	Pprof bool
+
+	// Extraction health: compare each run against a stored baseline and
+	// optionally fail when items or field fill rates drift below it.
+	HealthBaseline       string
+	HealthTolerance      float64
+	FailOnDrift          bool
+	UpdateHealthBaseline bool
+
+	// Server mode: where the control API listens, how many crawl jobs run at
+	// once, and where job outputs are written.
+	ServeAddr         string
+	MaxConcurrentJobs int
+	JobsDir           string
+
+	// Daemon mode: crawl on a cron schedule, keeping the newest Retain
+	// outputs (0 keeps all). OutputFile may then be a text/template such as
+	// "output/books-{{.Date}}.csv".
+	Schedule string
+	Retain   int
+
+	// Tracing: where OpenTelemetry spans are exported ("none", "stdout" or
+	// "file", the latter writing JSON to TraceFile).
+	TraceExporter string
+	TraceFile     string
+
+	// ReportFile, when set, receives a JSON report of each run. Like
+	// OutputFile it may be a template.
+	ReportFile string
+
+	// Failure thresholds: a run that finishes with more than MaxErrorRate of
+	// its requests failed, or fewer than MinItems items, fails.
+	MaxErrorRate float64
+	MinItems     int
+}
+
+// Rotates reports whether the output is split into shards.
+func (c *Config) Rotates() bool {
+	return c.RotateRecords > 0 || c.RotateBytes > 0 || c.PartitionBy != ""
+}
+
+// SiteConfig describes one crawl target. Zero-valued fields inherit the
+// matching top-level Config value, so a site only needs to spell out what is
+// different about it.
+type SiteConfig struct {
+	Name             string // label for Book.Source and metrics; defaults to the host
+	BaseURL          string
+	MaxPages         int
+	Parallelism      int
+	Delay            time.Duration
+	RandomDelay      time.Duration
+	UserAgent        string
+	RespectRobotsTxt *bool // nil inherits Config.RespectRobotsTxt
+	Profile          string
+	// StructuredData overrides the profile's schema.org handling: "off",
+	// "fallback" (fill fields CSS extraction left empty) or "primary".
+	StructuredData string
+}
+
+// SinkConfig is one output of a run.
+type SinkConfig struct {
+	Format string // csv, json, arrow, parquet, avro, xlsx, html, template or http; a .gz or .zst Path is compressed
+	Path   string // the file, or the URL of an http sink
+	// OnError decides what a failing sink does to the run: "fail-fast" (the
+	// default) fails it, "best-effort" drops the sink and carries on, and
+	// "quarantine" diverts the failed batches to a JSONL file next to Path.
+	OnError string
 }
 
 // DefaultConfig returns conservative defaults for the demo target.
@@ -51,87 +171,502 @@ func DefaultConfig() *Config {
 		BatchSize:          64,
 		DedupeMaxSize:      100000,
 		MetricsAddr:        "",
+		ProgressInterval:   10 * time.Second,
+		HealthTolerance:    0.1,
+		ServeAddr:          ":8080",
+		MaxConcurrentJobs:  1,
+		JobsDir:            "output/jobs",
+		TraceExporter:      "none",
+		MaxErrorRate:       1,
+		HTTPBody:           "ndjson",
+		HTTPRetries:        3,
 	}
 }
 
-// Validate ensures all configuration values are coherent.
-func (c *Config) Validate() error { //nolint:gocyclo // inherent branchiness from validating ~17 independent fields
-	if c.BaseURL == "" {
-		return fmt.Errorf("base URL cannot be empty")
+// Validate ensures all configuration values are coherent. It reports every
+// problem found, joined into one error, rather than stopping at the first.
+func (c *Config) Validate() error { //nolint:gocyclo // inherent branchiness from validating ~20 independent fields
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
 	}
 
-	parsedURL, err := url.Parse(c.BaseURL)
-	if err != nil {
-		return fmt.Errorf("invalid base URL: %w", err)
-	}
-	if parsedURL.Host == "" {
-		return fmt.Errorf("base URL must include a host")
+	if len(c.Sites) == 0 {
+		if c.BaseURL == "" {
+			add("base URL cannot be empty")
+		} else if parsedURL, err := url.Parse(c.BaseURL); err != nil {
+			add("invalid base URL: %w", err)
+		} else if parsedURL.Host == "" {
+			add("base URL must include a host")
+		}
 	}
 
 	if c.MaxPages <= 0 {
-		return fmt.Errorf("max pages must be positive")
+		add("max pages must be positive")
 	}
 	if c.Parallelism <= 0 {
-		return fmt.Errorf("parallelism must be positive")
+		add("parallelism must be positive")
 	}
 	if c.Delay < 0 {
-		return fmt.Errorf("delay cannot be negative")
+		add("delay cannot be negative")
 	}
 	if c.RandomDelay < 0 {
-		return fmt.Errorf("random delay cannot be negative")
+		add("random delay cannot be negative")
 	}
 	if c.Timeout <= 0 {
-		return fmt.Errorf("timeout must be positive")
+		add("timeout must be positive")
 	}
 	if c.MaxRetries < 0 {
-		return fmt.Errorf("max retries cannot be negative")
+		add("max retries cannot be negative")
 	}
 	if c.RetryBackoff < 0 {
-		return fmt.Errorf("retry backoff cannot be negative")
+		add("retry backoff cannot be negative")
 	}
 	if c.RetryBackoffMax < 0 {
-		return fmt.Errorf("retry backoff max cannot be negative")
+		add("retry backoff max cannot be negative")
 	}
 	if c.RetryBackoffMax > 0 && c.RetryBackoff > c.RetryBackoffMax {
-		return fmt.Errorf("retry backoff (%s) cannot exceed retry backoff max (%s)", c.RetryBackoff, c.RetryBackoffMax)
+		add("retry backoff (%s) cannot exceed retry backoff max (%s)", c.RetryBackoff, c.RetryBackoffMax)
 	}
 	if c.OutputFile == "" {
-		return fmt.Errorf("output file cannot be empty")
+		add("output file cannot be empty")
+	} else if _, err := template.New("output").Option("missingkey=error").Parse(c.OutputFile); err != nil {
+		add("invalid output path template: %w", err)
+	}
+	if _, err := template.New("report").Option("missingkey=error").Parse(c.ReportFile); err != nil {
+		add("invalid report path template: %w", err)
+	}
+	if !isFileFormat(c.OutputFormat) && c.OutputFormat != "dual" {
+		add("output format must be csv, json, arrow, parquet, avro, xlsx, html, template, or dual")
+	}
+	if c.usesFormat("template") && c.TemplateFile == "" {
+		add("the template format requires a template file")
 	}
-	if c.OutputFormat != "csv" && c.OutputFormat != "json" && c.OutputFormat != "dual" {
-		return fmt.Errorf("output format must be csv, json, or dual")
+	if c.RotateRecords < 0 || c.RotateBytes < 0 {
+		add("rotation limits cannot be negative")
+	}
+	switch c.PartitionBy {
+	case "", "rating", "source", "availability", "currency", "date":
+	default:
+		add("partition by must be one of rating, source, availability, currency or date")
+	}
+	switch c.Compression {
+	case "":
+	case "gzip", "zstd":
+		for codec, ext := range map[string]string{"gzip": ".gz", "zstd": ".zst"} {
+			if codec != c.Compression && strings.HasSuffix(strings.ToLower(c.OutputFile), ext) {
+				add("compression %s conflicts with the %s extension of the output path", c.Compression, ext)
+			}
+		}
+	default:
+		add("compression must be gzip or zstd")
 	}
 	if c.UserAgent == "" {
-		return fmt.Errorf("user agent cannot be empty")
+		add("user agent cannot be empty")
 	}
 	if c.PipelineBufferSize < 0 {
-		return fmt.Errorf("pipeline buffer size must be >= 0")
+		add("pipeline buffer size must be >= 0")
 	}
 	if c.BatchSize < 0 {
-		return fmt.Errorf("batch size must be >= 0")
+		add("batch size must be >= 0")
 	}
 	if c.DedupeMaxSize < 0 {
-		return fmt.Errorf("dedupe max size must be >= 0")
+		add("dedupe max size must be >= 0")
+	}
+	if c.HealthTolerance < 0 || c.HealthTolerance > 1 {
+		add("health tolerance must be between 0 and 1")
+	}
+	if c.MaxErrorRate < 0 || c.MaxErrorRate > 1 {
+		add("max error rate must be between 0 and 1")
+	}
+	if c.ProgressInterval < 0 {
+		add("progress interval cannot be negative")
+	}
+	if c.MinItems < 0 {
+		add("min items cannot be negative")
+	}
+	if c.UpdateHealthBaseline && c.HealthBaseline == "" {
+		add("updating the health baseline requires a baseline path")
+	}
+	if c.Retain < 0 {
+		add("retain cannot be negative")
+	}
+	if c.MaxConcurrentJobs <= 0 {
+		add("max concurrent jobs must be positive")
+	}
+	switch c.TraceExporter {
+	case "", "none", "stdout":
+	case "file":
+		if c.TraceFile == "" {
+			add("the file trace exporter requires a trace file")
+		}
+	default:
+		add("trace exporter must be none, stdout, or file")
+	}
+
+	if c.StreamsToStdout() {
+		errs = append(errs, c.validateStream()...)
+	} else if c.Publish {
+		errs = append(errs, c.validatePublish()...)
+	}
+
+	if _, err := c.OutputFields(); err != nil {
+		add("invalid output fields: %w", err)
+	}
+
+	if c.HTTPBody != "ndjson" && c.HTTPBody != "json" {
+		add("http body must be ndjson or json")
+	}
+	if c.HTTPRetries < 0 {
+		add("http retries cannot be negative")
+	}
+	if _, err := c.ParseHTTPHeaders(); err != nil {
+		add("invalid http headers: %w", err)
+	}
+
+	paths := make(map[string]bool, len(c.Sinks))
+	for i, sink := range c.Sinks {
+		errs = append(errs, sink.validate(i)...)
+		if paths[sink.Path] {
+			add("sinks[%d]: duplicate path %q", i, sink.Path)
+		}
+		paths[sink.Path] = true
+	}
+
+	names := make(map[string]bool, len(c.Sites))
+	for _, site := range c.ResolvedSites() {
+		errs = append(errs, site.validate()...)
+		if names[site.Name] {
+			add("duplicate site name %q", site.Name)
+		}
+		names[site.Name] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// ResolvedSites returns the sites to crawl with inherited values filled in.
+// When no sites are configured, BaseURL and the top-level settings form the
+// only site.
+func (c *Config) ResolvedSites() []SiteConfig {
+	sites := c.Sites
+	if len(sites) == 0 {
+		sites = []SiteConfig{{BaseURL: c.BaseURL}}
+	}
+
+	out := make([]SiteConfig, 0, len(sites))
+	for _, site := range sites {
+		if site.Name == "" {
+			if parsed, err := url.Parse(site.BaseURL); err == nil {
+				site.Name = parsed.Hostname()
+			}
+		}
+		if site.MaxPages == 0 {
+			site.MaxPages = c.MaxPages
+		}
+		if site.Parallelism == 0 {
+			site.Parallelism = c.Parallelism
+		}
+		if site.Delay == 0 {
+			site.Delay = c.Delay
+		}
+		if site.RandomDelay == 0 {
+			site.RandomDelay = c.RandomDelay
+		}
+		if site.UserAgent == "" {
+			site.UserAgent = c.UserAgent
+		}
+		if site.RespectRobotsTxt == nil {
+			respect := c.RespectRobotsTxt
+			site.RespectRobotsTxt = &respect
+		}
+		if site.Profile == "" {
+			site.Profile = DefaultProfile
+		}
+		out = append(out, site)
+	}
+	return out
+}
+
+func (s SiteConfig) validate() []error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("site %q: "+format, append([]any{s.Name}, args...)...))
+	}
+
+	if s.BaseURL == "" {
+		add("base URL cannot be empty")
+	} else if parsedURL, err := url.Parse(s.BaseURL); err != nil {
+		add("invalid base URL: %w", err)
+	} else if parsedURL.Host == "" {
+		add("base URL must include a host")
+	}
+	if s.MaxPages <= 0 {
+		add("max pages must be positive")
+	}
+	if s.Parallelism <= 0 {
+		add("parallelism must be positive")
+	}
+	if s.Delay < 0 || s.RandomDelay < 0 {
+		add("delays cannot be negative")
+	}
+	switch s.StructuredData {
+	case "", "off", "fallback", "primary":
+	default:
+		add("structured data mode must be off, fallback, or primary")
+	}
+	return errs
+}
+
+// IsFile reports whether the sink writes a file, as opposed to streaming to
+// a URL.
+func (s SinkConfig) IsFile() bool {
+	return s.Format != "http"
+}
+
+// OutputFields returns the fields every output writes, as selected by
+// Fields and ExcludeFields.
+func (c *Config) OutputFields() ([]models.Field, error) {
+	return models.SelectFields(models.ParseFieldList(c.Fields), models.ParseFieldList(c.ExcludeFields))
+}
+
+// usesFormat reports whether the output or one of the sinks is in format.
+func (c *Config) usesFormat(format string) bool {
+	if len(c.Sinks) == 0 {
+		return c.OutputFormat == format
+	}
+	for _, sink := range c.Sinks {
+		if sink.Format == format {
+			return true
+		}
+	}
+	return false
+}
+
+// isFileFormat reports whether format names one of the file writers.
+func isFileFormat(format string) bool {
+	switch format {
+	case "csv", "json", "arrow", "parquet", "avro", "xlsx", "html", "template":
+		return true
+	}
+	return false
+}
+
+// ParseHTTPHeaders parses HTTPHeaders, "name=value" pairs separated by
+// commas with CSV quoting, into a header map.
+func (c *Config) ParseHTTPHeaders() (map[string][]string, error) {
+	headers := make(map[string][]string)
+	if strings.TrimSpace(c.HTTPHeaders) == "" {
+		return headers, nil
+	}
+	reader := csv.NewReader(strings.NewReader(c.HTTPHeaders))
+	reader.TrimLeadingSpace = true
+	fields, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("header %q is not name=value", field)
+		}
+		headers[name] = append(headers[name], strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// StdoutPath is the OutputFile that streams records to stdout.
+const StdoutPath = "-"
+
+// StreamsToStdout reports whether records go to stdout (-output -) rather
+// than to files; logs then go to stderr.
+func (c *Config) StreamsToStdout() bool {
+	return len(c.Sinks) == 0 && c.OutputFile == StdoutPath
+}
+
+// validateStream checks the settings output to stdout cannot honour: records
+// go straight to the stream, so there is no file to compress, shard or
+// publish.
+func (c *Config) validateStream() []error {
+	var errs []error
+	if c.OutputFormat != "csv" && c.OutputFormat != "json" {
+		errs = append(errs, errors.New("output to stdout must be in the csv or json format"))
+	}
+	if c.Compression != "" {
+		errs = append(errs, errors.New("output to stdout cannot be compressed; pipe it through gzip or zstd instead"))
 	}
+	if c.Rotates() {
+		errs = append(errs, errors.New("output to stdout cannot be rotated or partitioned"))
+	}
+	if c.Publish {
+		errs = append(errs, errors.New("output to stdout cannot be published"))
+	}
+	return errs
+}
 
+// validatePublish checks that the outputs share the directory Publish swaps.
+func (c *Config) validatePublish() []error {
+	outputs := []string{c.OutputFile}
+	if len(c.Sinks) > 0 {
+		outputs = outputs[:0]
+		for _, sink := range c.Sinks {
+			if sink.IsFile() {
+				outputs = append(outputs, sink.Path)
+			}
+		}
+		if len(outputs) == 0 {
+			return []error{errors.New("publish needs at least one file output")}
+		}
+	}
+	dir := filepath.Dir(outputs[0])
+	if dir == "." || dir == string(filepath.Separator) {
+		return []error{errors.New("publish needs the outputs in a directory of their own, e.g. output/latest/books.csv")}
+	}
+	for _, output := range outputs[1:] {
+		if filepath.Dir(output) != dir {
+			return []error{fmt.Errorf("publish needs every output in one directory, but %s is not in %s", output, dir)}
+		}
+	}
 	return nil
 }
 
-// EnvInt looks up an integer environment variable.
-func EnvInt(key string) (int, bool, error) {
-	value, ok := os.LookupEnv(key)
+func (s SinkConfig) validate(i int) []error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("sinks[%d]: "+format, append([]any{i}, args...)...))
+	}
+
+	if !isFileFormat(s.Format) && s.Format != "http" {
+		add("format must be csv, json, arrow, parquet, avro, xlsx, html, template, or http")
+	}
+	switch {
+	case s.Path == "":
+		add("path cannot be empty")
+	case s.Path == StdoutPath:
+		add("cannot write to stdout; use -output - instead of sinks")
+	case strings.Contains(s.Path, "{{"):
+		add("path cannot be a template")
+	case !s.IsFile():
+		if u, err := url.Parse(s.Path); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("an http sink needs an http or https URL")
+		}
+	}
+	switch s.OnError {
+	case "", "fail-fast", "best-effort", "quarantine":
+	default:
+		add("on error must be fail-fast, best-effort, or quarantine")
+	}
+	return errs
+}
+
+// set parses one sink option. Keys may use dashes or underscores, like site
+// options.
+func (s *SinkConfig) set(key, value string) error {
+	key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+	value = strings.TrimSpace(value)
+	switch key {
+	case "format":
+		s.Format = strings.ToLower(value)
+	case "path":
+		s.Path = value
+	case "on-error":
+		s.OnError = value
+	default:
+		return fmt.Errorf("unknown sink option %q", key)
+	}
+	return nil
+}
+
+// ParseSinkSpec parses a -sink flag value of the form
+// "format:path[,key=value...]". The only option is on-error. Like -site
+// specs the part after the colon is comma separated with CSV quoting, so a
+// path containing commas can be wrapped in double quotes.
+func ParseSinkSpec(spec string) (SinkConfig, error) {
+	format, rest, ok := strings.Cut(spec, ":")
 	if !ok {
-		return 0, false, nil
+		return SinkConfig{}, fmt.Errorf("parse sink %q: want format:path", spec)
+	}
+	reader := csv.NewReader(strings.NewReader(rest))
+	reader.TrimLeadingSpace = true
+	fields, err := reader.Read()
+	if err != nil {
+		return SinkConfig{}, fmt.Errorf("parse sink %q: %w", spec, err)
+	}
+
+	sink := SinkConfig{Format: strings.ToLower(strings.TrimSpace(format)), Path: strings.TrimSpace(fields[0])}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return SinkConfig{}, fmt.Errorf("parse sink %q: option %q is not key=value", spec, field)
+		}
+		if err := sink.set(key, value); err != nil {
+			return SinkConfig{}, fmt.Errorf("parse sink %q: %w", spec, err)
+		}
+	}
+	return sink, nil
+}
+
+// set parses one site option. Keys may use dashes or underscores, so the same
+// names work in -site specs and config files.
+func (s *SiteConfig) set(key, value string) error {
+	key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+	value = strings.TrimSpace(value)
+	var err error
+	switch key {
+	case "name":
+		s.Name = value
+	case "url", "base-url":
+		s.BaseURL = value
+	case "pages":
+		s.MaxPages, err = strconv.Atoi(value)
+	case "parallel":
+		s.Parallelism, err = strconv.Atoi(value)
+	case "delay":
+		s.Delay, err = ParseDuration(value)
+	case "random-delay":
+		s.RandomDelay, err = ParseDuration(value)
+	case "user-agent":
+		s.UserAgent = value
+	case "robots", "respect-robots":
+		var respect bool
+		respect, err = strconv.ParseBool(value)
+		s.RespectRobotsTxt = &respect
+	case "profile":
+		s.Profile = value
+	case "structured":
+		s.StructuredData = value
+	default:
+		return fmt.Errorf("unknown site option %q", key)
 	}
-	parsed, err := strconv.Atoi(value)
 	if err != nil {
-		return 0, true, fmt.Errorf("invalid %s: %w", key, err)
+		return fmt.Errorf("invalid %s: %w", key, err)
 	}
-	return parsed, true, nil
+	return nil
 }
 
-// EnvString looks up a string environment variable.
-func EnvString(key string) (string, bool) {
-	value, ok := os.LookupEnv(key)
-	return value, ok
+// ParseSiteSpec parses a -site flag value of the form
+// "url[,key=value...]". Recognised keys are name, pages, parallel, delay,
+// random-delay, user-agent, robots, profile and structured. Fields are comma
+// separated with CSV quoting, so values containing commas (user agents
+// usually do) can be wrapped in double quotes.
+func ParseSiteSpec(spec string) (SiteConfig, error) {
+	reader := csv.NewReader(strings.NewReader(spec))
+	reader.TrimLeadingSpace = true
+	fields, err := reader.Read()
+	if err != nil {
+		return SiteConfig{}, fmt.Errorf("parse site %q: %w", spec, err)
+	}
+
+	site := SiteConfig{BaseURL: strings.TrimSpace(fields[0])}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return SiteConfig{}, fmt.Errorf("parse site %q: option %q is not key=value", spec, field)
+		}
+		if err := site.set(key, value); err != nil {
+			return SiteConfig{}, fmt.Errorf("parse site %q: %w", spec, err)
+		}
+	}
+	return site, nil
 }
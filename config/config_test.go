@@ -47,6 +47,55 @@ func TestConfigValidate(t *testing.T) {
 			},
 			wantErr: "timeout",
 		},
+		{
+			name: "unsupported http body",
+			mutate: func(cfg *Config) {
+				cfg.HTTPBody = "xml"
+			},
+			wantErr: "http body",
+		},
+		{
+			name: "malformed http header",
+			mutate: func(cfg *Config) {
+				cfg.HTTPHeaders = "X-Team"
+			},
+			wantErr: "http headers",
+		},
+		{
+			name: "unknown output field",
+			mutate: func(cfg *Config) {
+				cfg.ExcludeFields = "isbn,author"
+			},
+			wantErr: `unknown field "author"`,
+		},
+		{
+			name: "template sink without template file",
+			mutate: func(cfg *Config) {
+				cfg.Sinks = []SinkConfig{{Format: "template", Path: "out/books.md"}}
+			},
+			wantErr: "requires a template file",
+		},
+		{
+			name: "stdout output in xlsx",
+			mutate: func(cfg *Config) {
+				cfg.OutputFile, cfg.OutputFormat = StdoutPath, "xlsx"
+			},
+			wantErr: "csv or json format",
+		},
+		{
+			name: "rotated stdout output",
+			mutate: func(cfg *Config) {
+				cfg.OutputFile, cfg.RotateRecords = StdoutPath, 100
+			},
+			wantErr: "cannot be rotated",
+		},
+		{
+			name: "stdout sink",
+			mutate: func(cfg *Config) {
+				cfg.Sinks = []SinkConfig{{Format: "json", Path: StdoutPath}}
+			},
+			wantErr: "use -output - instead",
+		},
 	}
 
 	for _, tt := range tests {
@@ -66,3 +115,129 @@ func TestDefaultConfigValid(t *testing.T) {
 		t.Fatalf("default config should validate, got %v", err)
 	}
 }
+
+func TestResolvedSitesInheritance(t *testing.T) {
+	cfg := DefaultConfig()
+	robots := false
+	cfg.Sites = []SiteConfig{
+		{BaseURL: "https://a.example/catalog"},
+		{Name: "b", BaseURL: "https://b.example", Parallelism: 2, RespectRobotsTxt: &robots, Profile: "custom"},
+	}
+
+	sites := cfg.ResolvedSites()
+	if len(sites) != 2 {
+		t.Fatalf("sites = %d, want 2", len(sites))
+	}
+	a, b := sites[0], sites[1]
+	if a.Name != "a.example" || a.Parallelism != cfg.Parallelism || a.UserAgent != cfg.UserAgent || a.Profile != DefaultProfile {
+		t.Fatalf("site a did not inherit defaults: %+v", a)
+	}
+	if a.RespectRobotsTxt == nil || !*a.RespectRobotsTxt {
+		t.Fatalf("site a should inherit robots policy")
+	}
+	if b.Name != "b" || b.Parallelism != 2 || *b.RespectRobotsTxt || b.Profile != "custom" {
+		t.Fatalf("site b overrides lost: %+v", b)
+	}
+}
+
+func TestResolvedSitesDefaultsToBaseURL(t *testing.T) {
+	cfg := DefaultConfig()
+	sites := cfg.ResolvedSites()
+	if len(sites) != 1 || sites[0].BaseURL != cfg.BaseURL || sites[0].Name != "books.toscrape.com" {
+		t.Fatalf("unexpected sites: %+v", sites)
+	}
+}
+
+func TestValidateSites(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Sites = []SiteConfig{{BaseURL: "https://a.example"}, {BaseURL: "https://a.example/other"}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "duplicate site") {
+		t.Fatalf("expected duplicate site error, got %v", err)
+	}
+
+	cfg.Sites = []SiteConfig{{Name: "x", BaseURL: "not a url"}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `site "x"`) {
+		t.Fatalf("expected site error, got %v", err)
+	}
+}
+
+func TestValidateSinks(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Sinks = []SinkConfig{
+		{Format: "csv", Path: "books.csv"},
+		{Format: "json", Path: "books.csv"},
+		{Format: "xml", Path: "books-{{.Date}}.xml", OnError: "retry"},
+		{Format: "http", Path: "books.jsonl"},
+	}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{`sinks[1]: duplicate path "books.csv"`, "sinks[2]: format", "sinks[2]: path cannot be a template", "sinks[2]: on error", "sinks[3]: an http sink needs an http or https URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q missing %q", err, want)
+		}
+	}
+}
+
+func TestValidatePublish(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Publish = true
+	cfg.OutputFile = "books.csv"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "directory of their own") {
+		t.Fatalf("expected an error for an output in the working directory, got %v", err)
+	}
+	cfg.Sinks = []SinkConfig{{Format: "csv", Path: "out/books.csv"}, {Format: "json", Path: "other/books.jsonl"}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "every output in one directory") {
+		t.Fatalf("expected an error for sinks in different directories, got %v", err)
+	}
+	cfg.Sinks[1].Path = "out/books.jsonl"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	cfg.Sinks = append(cfg.Sinks, SinkConfig{Format: "http", Path: "https://ingest.example/books"})
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("an http sink should not count as an output to publish: %v", err)
+	}
+	cfg.Sinks = cfg.Sinks[2:]
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "at least one file output") {
+		t.Fatalf("expected an error for nothing to publish, got %v", err)
+	}
+}
+
+func TestParseSinkSpec(t *testing.T) {
+	sink, err := ParseSinkSpec(`JSON:"out/a,b.jsonl.gz",on-error=quarantine`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if sink != (SinkConfig{Format: "json", Path: "out/a,b.jsonl.gz", OnError: "quarantine"}) {
+		t.Fatalf("unexpected sink: %+v", sink)
+	}
+	for _, bad := range []string{"books.csv", "csv:books.csv,bogus=1", "csv:books.csv,on-error"} {
+		if _, err := ParseSinkSpec(bad); err == nil {
+			t.Errorf("ParseSinkSpec(%q) expected error", bad)
+		}
+	}
+}
+
+func TestParseSiteSpec(t *testing.T) {
+	site, err := ParseSiteSpec(`https://a.example,name=a,pages=3,parallel=2,delay=150ms,robots=false,profile=p,"user-agent=Mozilla/5.0 (KHTML, like Gecko)"`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if site.BaseURL != "https://a.example" || site.Name != "a" || site.MaxPages != 3 || site.Parallelism != 2 {
+		t.Fatalf("unexpected site: %+v", site)
+	}
+	if site.Delay != 150*time.Millisecond || site.RespectRobotsTxt == nil || *site.RespectRobotsTxt {
+		t.Fatalf("unexpected delay/robots: %+v", site)
+	}
+	if site.Profile != "p" || site.UserAgent != "Mozilla/5.0 (KHTML, like Gecko)" {
+		t.Fatalf("unexpected profile/user agent: %+v", site)
+	}
+
+	for _, bad := range []string{"https://a.example,pages=x", "https://a.example,bogus=1", "https://a.example,name"} {
+		if _, err := ParseSiteSpec(bad); err == nil {
+			t.Errorf("ParseSiteSpec(%q) expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Source records where an effective configuration value came from.
+type Source string
+
+// Configuration sources in increasing order of precedence.
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Sources maps field keys (and "sites" and "sinks") to the source of their
+// value.
+type Sources map[string]Source
+
+// EnvPrefix prefixes the environment variable of every field.
+const EnvPrefix = "SCRAPER_"
+
+// Field describes one scalar Config setting and the names it goes by in a
+// config file, the environment and on the command line.
+type Field struct {
+	Key   string // config file key, e.g. "max_retries"
+	Flag  string // command-line flag name, e.g. "max-retries"
+	Env   string // environment variable, e.g. "SCRAPER_MAX_RETRIES"
+	Usage string
+	// Secret fields hold credentials; Redacted and Print mask their values.
+	Secret bool
+	ptr    func(*Config) any
+}
+
+// IsBool reports whether the field is a boolean (so its flag needs no value).
+func (f Field) IsBool() bool {
+	_, ok := f.ptr(&Config{}).(*bool)
+	return ok
+}
+
+func field(key, flagName, usage string, ptr func(*Config) any) Field {
+	if flagName == "" {
+		flagName = strings.ReplaceAll(key, "_", "-")
+	}
+	return Field{
+		Key:   key,
+		Flag:  flagName,
+		Env:   EnvPrefix + strings.ToUpper(key),
+		Usage: usage,
+		ptr:   ptr,
+	}
+}
+
+// secret marks f as holding a credential.
+func secret(f Field) Field {
+	f.Secret = true
+	return f
+}
+
+var fields = []Field{
+	field("base_url", "", "Base URL to crawl", func(c *Config) any { return &c.BaseURL }),
+	field("pages", "", "Maximum catalog pages to scrape", func(c *Config) any { return &c.MaxPages }),
+	field("parallel", "", "Number of concurrent requests", func(c *Config) any { return &c.Parallelism }),
+	field("delay", "", "Delay between requests (duration; bare numbers are milliseconds)", func(c *Config) any { return &c.Delay }),
+	field("random_delay", "", "Random jitter added to delay (duration; bare numbers are milliseconds)", func(c *Config) any { return &c.RandomDelay }),
+	field("timeout", "", "HTTP request timeout (duration; bare numbers are milliseconds)", func(c *Config) any { return &c.Timeout }),
+	field("max_retries", "", "Maximum retry attempts per URL", func(c *Config) any { return &c.MaxRetries }),
+	field("retry_backoff", "", "Initial retry backoff (duration; bare numbers are milliseconds)", func(c *Config) any { return &c.RetryBackoff }),
+	field("retry_backoff_max", "", "Maximum retry backoff (duration; bare numbers are milliseconds)", func(c *Config) any { return &c.RetryBackoffMax }),
+	field("respect_robots", "", "Respect robots.txt directives (enabled by default; pass -respect-robots=false to disable)", func(c *Config) any { return &c.RespectRobotsTxt }),
+	field("user_agent", "", "User-Agent header sent with every request", func(c *Config) any { return &c.UserAgent }),
+	field("output", "", "Output file path, or - to stream csv or json records to stdout (logs then go to stderr); may be a template using {{.Date}}, {{.Time}}, {{.Timestamp}} and {{.Run}}", func(c *Config) any { return &c.OutputFile }),
+	field("format", "", "Output format: csv, json, arrow, parquet, avro, xlsx, html, template, or dual", func(c *Config) any { return &c.OutputFormat }),
+	field("template", "", "text/template file the template format renders, defining row and optionally header and footer templates", func(c *Config) any { return &c.TemplateFile }),
+	field("compress", "", "Compress outputs with gzip or zstd, adding .gz or .zst to the output path (default: from the output extension)", func(c *Config) any { return &c.Compression }),
+	field("fields", "", "Output fields to write, in this order, comma separated (default: every field; see the schema command)", func(c *Config) any { return &c.Fields }),
+	field("exclude_fields", "", "Output fields to leave out, comma separated", func(c *Config) any { return &c.ExcludeFields }),
+	field("rotate_records", "", "Start a new output shard after this many records (0: no limit)", func(c *Config) any { return &c.RotateRecords }),
+	field("rotate_bytes", "", "Start a new output shard once one reaches this many bytes (0: no limit)", func(c *Config) any { return &c.RotateBytes }),
+	field("partition_by", "", "Write separate output shards per value of this field: rating, source, availability, currency or date", func(c *Config) any { return &c.PartitionBy }),
+	field("http_body", "", "Request body of http sinks: ndjson (one record per line) or json (an array per batch)", func(c *Config) any { return &c.HTTPBody }),
+	secret(field("http_token", "", "Bearer token http sinks authenticate with", func(c *Config) any { return &c.HTTPToken })),
+	secret(field("http_headers", "", "Extra headers for http sinks as name=value pairs, comma separated", func(c *Config) any { return &c.HTTPHeaders })),
+	field("http_gzip", "", "Gzip the request bodies of http sinks", func(c *Config) any { return &c.HTTPGzip }),
+	field("http_retries", "", "Retries per batch when an http sink fails with a network error, 429 or 5xx", func(c *Config) any { return &c.HTTPRetries }),
+	field("publish", "", "Stage each run's outputs in a new directory and, if the run succeeds, publish them together by swapping the symlink at the outputs' directory", func(c *Config) any { return &c.Publish }),
+	field("pipeline_buffer_size", "", "Pipeline channel capacity", func(c *Config) any { return &c.PipelineBufferSize }),
+	field("batch_size", "", "Records per writer batch", func(c *Config) any { return &c.BatchSize }),
+	field("dedupe_max_size", "", "Maximum URLs remembered for de-duplication", func(c *Config) any { return &c.DedupeMaxSize }),
+	field("verbose", "v", "Enable verbose logging", func(c *Config) any { return &c.Verbose }),
+	field("metrics_addr", "", "Prometheus metrics listen address (e.g. :9090)", func(c *Config) any { return &c.MetricsAddr }),
+	field("pprof", "", "Serve /debug/pprof/ profiles on the metrics server and the serve API", func(c *Config) any { return &c.Pprof }),
+	field("progress_interval", "", "How often progress is logged when stdout is not a terminal; 0 also disables the terminal dashboard (duration; bare numbers are milliseconds)", func(c *Config) any { return &c.ProgressInterval }),
+	field("health_baseline", "", "Extraction health baseline file to compare the run against", func(c *Config) any { return &c.HealthBaseline }),
+	field("health_tolerance", "", "Allowed drop below the baseline for items per page and field fill rates (fraction)", func(c *Config) any { return &c.HealthTolerance }),
+	field("fail_on_drift", "", "Exit non-zero when extraction health warnings are raised", func(c *Config) any { return &c.FailOnDrift }),
+	field("update_baseline", "", "Record this run's extraction statistics in the health baseline file if it succeeds", func(c *Config) any { return &c.UpdateHealthBaseline }),
+	field("max_error_rate", "", "Fail the run when more than this fraction of requests fail (1 never fails)", func(c *Config) any { return &c.MaxErrorRate }),
+	field("min_items", "", "Fail the run when fewer items than this are written", func(c *Config) any { return &c.MinItems }),
+	field("serve_addr", "", "Listen address of the serve command's HTTP API", func(c *Config) any { return &c.ServeAddr }),
+	field("max_jobs", "", "Crawl jobs the serve command runs at once; further jobs queue", func(c *Config) any { return &c.MaxConcurrentJobs }),
+	field("jobs_dir", "", "Directory the serve command writes job outputs to", func(c *Config) any { return &c.JobsDir }),
+	field("schedule", "", "Cron schedule for the daemon command, e.g. \"0 6 * * *\" or \"@hourly\"", func(c *Config) any { return &c.Schedule }),
+	field("retain", "", "Outputs the daemon command keeps, newest first (0 keeps all)", func(c *Config) any { return &c.Retain }),
+	field("report", "", "Write a JSON run report to this path; may use the same templates as output", func(c *Config) any { return &c.ReportFile }),
+	field("trace_exporter", "", "OpenTelemetry span exporter: none, stdout, or file", func(c *Config) any { return &c.TraceExporter }),
+	field("trace_file", "", "File the file trace exporter writes spans to (JSON, one span per line)", func(c *Config) any { return &c.TraceFile }),
+}
+
+// Fields returns every scalar setting in display order.
+func Fields() []Field {
+	out := make([]Field, len(fields))
+	copy(out, fields)
+	return out
+}
+
+func lookupField(key string) (Field, bool) {
+	for _, f := range fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Set parses value into the field named key.
+func (c *Config) Set(key, value string) error {
+	f, ok := lookupField(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return setValue(f.ptr(c), value)
+}
+
+// Get formats the current value of the field named key.
+func (c *Config) Get(key string) string {
+	f, ok := lookupField(key)
+	if !ok {
+		return ""
+	}
+	return formatValue(f.ptr(c))
+}
+
+func setValue(ptr any, value string) error {
+	value = strings.TrimSpace(value)
+	var err error
+	switch p := ptr.(type) {
+	case *string:
+		*p = value
+	case *int:
+		*p, err = strconv.Atoi(value)
+	case *bool:
+		*p, err = strconv.ParseBool(value)
+	case *float64:
+		*p, err = strconv.ParseFloat(value, 64)
+	case *time.Duration:
+		*p, err = ParseDuration(value)
+	default:
+		err = fmt.Errorf("unsupported setting type %T", ptr)
+	}
+	return err
+}
+
+func formatValue(ptr any) string {
+	switch p := ptr.(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *float64:
+		return strconv.FormatFloat(*p, 'g', -1, 64)
+	case *time.Duration:
+		return p.String()
+	}
+	return ""
+}
+
+// ParseDuration accepts Go duration strings ("250ms", "2s") as well as bare
+// integers, which are read as milliseconds for compatibility with the
+// original millisecond-valued flags.
+func ParseDuration(value string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(value); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Load builds a Config from the defaults, the config file at path (skipped
+// when empty) and the environment, in increasing order of precedence. Flags
+// are applied afterwards by the caller with Set. Every problem found is
+// reported, not just the first.
+func Load(path string, lookupEnv func(string) (string, bool)) (*Config, Sources, error) {
+	cfg := DefaultConfig()
+	sources := make(Sources, len(fields)+1)
+	for _, f := range fields {
+		sources[f.Key] = SourceDefault
+	}
+	sources["sites"] = SourceDefault
+	sources["sinks"] = SourceDefault
+
+	var errs []error
+	if path != "" {
+		if err := cfg.loadFile(path, sources); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if lookupEnv != nil {
+		for _, f := range fields {
+			value, ok := lookupEnv(f.Env)
+			if !ok {
+				continue
+			}
+			if err := setValue(f.ptr(cfg), value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", f.Env, err))
+				continue
+			}
+			sources[f.Key] = SourceEnv
+		}
+	}
+	cfg.OutputFormat = strings.ToLower(cfg.OutputFormat)
+	return cfg, sources, errors.Join(errs...)
+}
+
+// loadFile decodes a YAML, TOML or JSON config file (picked by extension)
+// whose top-level keys are field keys plus optional "sites" and "sinks"
+// lists.
+func (c *Config) loadFile(path string, sources Sources) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension (want .yaml, .yml, .toml or .json)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	if err := c.Apply(doc, sources, SourceFile); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Apply sets every entry of values, keyed by field key plus optional "sites"
+// and "sinks" lists, as decoded from YAML, TOML or JSON. Each key applied is
+// recorded in sources (when non-nil) as coming from source. Every invalid
+// entry is reported.
+func (c *Config) Apply(values map[string]any, sources Sources, source Source) error {
+	var errs []error
+	for key, raw := range values {
+		if key == "sites" {
+			sites, err := decodeSites(raw)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			c.Sites = sites
+			if sources != nil {
+				sources["sites"] = source
+			}
+			continue
+		}
+		if key == "sinks" {
+			sinks, err := decodeSinks(raw)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			c.Sinks = sinks
+			if sources != nil {
+				sources["sinks"] = source
+			}
+			continue
+		}
+		f, ok := lookupField(key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %q", key))
+			continue
+		}
+		if err := setValue(f.ptr(c), scalarString(raw)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", key, err))
+			continue
+		}
+		if sources != nil {
+			sources[key] = source
+		}
+	}
+	c.OutputFormat = strings.ToLower(c.OutputFormat)
+	return errors.Join(errs...)
+}
+
+func decodeSites(raw any) ([]SiteConfig, error) {
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("sites must be a list")
+	}
+	sites := make([]SiteConfig, 0, len(list))
+	var errs []error
+	for i, item := range list {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("sites[%d] must be a table of settings", i))
+			continue
+		}
+		var site SiteConfig
+		for key, value := range entry {
+			if err := site.set(key, scalarString(value)); err != nil {
+				errs = append(errs, fmt.Errorf("sites[%d]: %w", i, err))
+			}
+		}
+		sites = append(sites, site)
+	}
+	return sites, errors.Join(errs...)
+}
+
+func decodeSinks(raw any) ([]SinkConfig, error) {
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("sinks must be a list")
+	}
+	sinks := make([]SinkConfig, 0, len(list))
+	var errs []error
+	for i, item := range list {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("sinks[%d] must be a table of settings", i))
+			continue
+		}
+		var sink SinkConfig
+		for key, value := range entry {
+			if err := sink.set(key, scalarString(value)); err != nil {
+				errs = append(errs, fmt.Errorf("sinks[%d]: %w", i, err))
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, errors.Join(errs...)
+}
+
+// scalarString renders a decoded YAML/TOML scalar the way it would be written
+// in an environment variable, so every source shares one set of parsers.
+func scalarString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// Print writes the effective configuration with the source of each value.
+func Print(w io.Writer, cfg *Config, sources Sources) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE\tENV")
+	for _, f := range fields {
+		fmt.Fprintf(tw, "%s\t%q\t%s\t%s\n", f.Key, redact(f, cfg.Get(f.Key)), sourceOf(sources, f.Key), f.Env)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for i, site := range cfg.ResolvedSites() {
+		robots := site.RespectRobotsTxt != nil && *site.RespectRobotsTxt
+		fmt.Fprintf(w, "sites[%d] (%s): name=%s url=%s pages=%d parallel=%d delay=%s random_delay=%s robots=%t profile=%s structured=%s\n",
+			i, sourceOf(sources, "sites"), site.Name, redactURL(site.BaseURL), site.MaxPages, site.Parallelism,
+			site.Delay, site.RandomDelay, robots, site.Profile, site.StructuredData)
+	}
+	for i, sink := range cfg.Sinks {
+		fmt.Fprintf(w, "sinks[%d] (%s): format=%s path=%s on_error=%s\n", i, sourceOf(sources, "sinks"), sink.Format, redactURL(sink.Path), sink.OnError)
+	}
+	return nil
+}
+
+func sourceOf(sources Sources, key string) Source {
+	if s, ok := sources[key]; ok {
+		return s
+	}
+	return SourceDefault
+}
+
+// redactedValue replaces the value of a secret setting.
+const redactedValue = "REDACTED"
+
+// Redacted returns every setting keyed by its config file key, plus the
+// resolved "sites" and the "sinks", in a form safe to log or publish: secret
+// fields are masked and URLs lose their passwords.
+func (c *Config) Redacted() map[string]any {
+	out := make(map[string]any, len(fields)+2)
+	for _, f := range fields {
+		out[f.Key] = redact(f, c.Get(f.Key))
+	}
+	sites := make([]map[string]any, 0, len(c.Sites))
+	for _, site := range c.ResolvedSites() {
+		sites = append(sites, map[string]any{
+			"name":            site.Name,
+			"base_url":        redactURL(site.BaseURL),
+			"pages":           site.MaxPages,
+			"parallel":        site.Parallelism,
+			"delay":           site.Delay.String(),
+			"random_delay":    site.RandomDelay.String(),
+			"user_agent":      site.UserAgent,
+			"respect_robots":  site.RespectRobotsTxt != nil && *site.RespectRobotsTxt,
+			"profile":         site.Profile,
+			"structured_data": site.StructuredData,
+		})
+	}
+	out["sites"] = sites
+	sinks := make([]map[string]any, 0, len(c.Sinks))
+	for _, sink := range c.Sinks {
+		sinks = append(sinks, map[string]any{"format": sink.Format, "path": redactURL(sink.Path), "on_error": sink.OnError})
+	}
+	out["sinks"] = sinks
+	return out
+}
+
+func redact(f Field, value string) string {
+	if f.Secret && value != "" {
+		return redactedValue
+	}
+	return redactURL(value)
+}
+
+// redactURL masks the password of a URL with credentials; anything else is
+// returned unchanged.
+func redactURL(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		u.User = url.User(redactedValue)
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,10 @@
+#!/bin/sh
+# Probes /healthz on the metrics server (crawl, replay, daemon) or on the
+# serve command's API, whichever is listening.
+set -u
+
+for addr in "${SCRAPER_METRICS_ADDR:-}" "${SCRAPER_SERVE_ADDR:-:8080}"; do
+	[ -n "$addr" ] || continue
+	wget -q -O /dev/null "http://127.0.0.1:${addr##*:}/healthz" && exit 0
+done
+exit 1
@@ -3,17 +3,22 @@ package models
 
 import "time"
 
-// Book represents a book item from the scraper.
+// Book represents a book item from the scraper. Field order is the default
+// CSV column order, so new fields go at the end to keep existing columns in
+// place.
 type Book struct {
 	Title         string    `csv:"title" json:"title"`
 	Price         string    `csv:"price" json:"price"`
-	PriceNumeric  float64   `csv:"price_numeric" json:"price_numeric"`
 	RatingText    string    `csv:"rating" json:"rating"`
 	RatingNumeric int       `csv:"rating_numeric" json:"rating_numeric"`
 	Availability  string    `csv:"availability" json:"availability"`
 	ImageURL      string    `csv:"image_url" json:"image_url"`
 	URL           string    `csv:"url" json:"url"`
 	ScrapedAt     time.Time `csv:"scraped_at" json:"scraped_at"`
+	PriceNumeric  float64   `csv:"price_numeric" json:"price_numeric"`
+	Source        string    `csv:"source" json:"source"`
+	Currency      string    `csv:"currency" json:"currency"`
+	ISBN          string    `csv:"isbn" json:"isbn"`
 }
 
 // ScraperResult holds the overall result of a scraping operation
@@ -27,4 +32,61 @@ type ScraperResult struct {
 	RetryCount   int
 	RequestCount int
 	PageCount    int
+	Domains      map[string]DomainResult
+
+	// InFlight and PendingRetries sum the live gauges of every domain.
+	InFlight       int
+	PendingRetries int
+
+	Warnings []ExtractionWarning
+
+	// RequestLatency summarises how long completed requests took, from
+	// sending the request to receiving the response or error.
+	RequestLatency LatencySummary
+}
+
+// LatencySummary is the distribution of a set of request latencies.
+type LatencySummary struct {
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// DomainResult breaks the ScraperResult counters down for one crawled site.
+type DomainResult struct {
+	RequestCount int
+	PageCount    int
+	ItemCount    int
+	ErrorCount   int
+	RetryCount   int
+	FailedURLs   []string
+	ErrorsByType map[string]int
+
+	// Live gauges: requests sent but not yet answered, and retries waiting
+	// for their backoff to elapse. Both are zero once the crawl has finished.
+	InFlight       int
+	PendingRetries int
+
+	// Extraction health: how many HTML pages were scraped, which of them
+	// yielded no items, and the fraction of items with each tracked field.
+	ListingPages  int
+	ZeroItemPages []string
+	ItemsPerPage  float64
+	FillRates     map[string]float64
+}
+
+// ExtractionWarning flags a sign that a site's markup no longer matches its
+// extraction profile.
+type ExtractionWarning struct {
+	Domain   string
+	Kind     string // zero_items, no_items, items_per_page_drop, fill_rate_drop
+	Field    string
+	URL      string
+	Value    float64
+	Baseline float64
+	Message  string
 }
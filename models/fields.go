@@ -0,0 +1,212 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the type of a Book field, which each output format maps to a
+// type of its own.
+type FieldType string
+
+// Field types.
+const (
+	FieldString FieldType = "string"
+	FieldInt    FieldType = "int"
+	FieldFloat  FieldType = "float"
+	FieldTime   FieldType = "timestamp"
+)
+
+// Field is one field of a Book as the output formats store it.
+type Field struct {
+	Name  string // the field's csv tag, which is also its json tag
+	Type  FieldType
+	index int // of the field in the Book struct
+}
+
+// BookFields lists every field of Book, named by its csv tag, in struct
+// order. Writers, readers and schemas are all derived from it, so a tagged
+// field added to Book reaches every output format.
+var BookFields = bookFields()
+
+func bookFields() []Field {
+	typ := reflect.TypeFor[Book]()
+	fields := make([]Field, 0, typ.NumField())
+	for i := range typ.NumField() {
+		sf := typ.Field(i)
+		name := sf.Tag.Get("csv")
+		if name == "" || name == "-" {
+			continue
+		}
+		f := Field{Name: name, index: i}
+		switch sf.Type {
+		case reflect.TypeFor[string]():
+			f.Type = FieldString
+		case reflect.TypeFor[int]():
+			f.Type = FieldInt
+		case reflect.TypeFor[float64]():
+			f.Type = FieldFloat
+		case reflect.TypeFor[time.Time]():
+			f.Type = FieldTime
+		default:
+			panic(fmt.Sprintf("Book field %s has unsupported type %s", sf.Name, sf.Type))
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// LookupField returns the field of BookFields called name.
+func LookupField(name string) (Field, bool) {
+	for _, f := range BookFields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// SelectFields returns the fields named in include, in that order, or every
+// field of BookFields when include is empty, leaving out those named in
+// exclude. Unknown and repeated names are errors, as is a selection without
+// the url field, which identifies records when outputs are read back.
+func SelectFields(include, exclude []string) ([]Field, error) {
+	var errs []error
+	check := func(names []string) map[string]bool {
+		seen := make(map[string]bool, len(names))
+		for _, name := range names {
+			if _, ok := LookupField(name); !ok {
+				errs = append(errs, fmt.Errorf("unknown field %q", name))
+			} else if seen[name] {
+				errs = append(errs, fmt.Errorf("field %q listed twice", name))
+			}
+			seen[name] = true
+		}
+		return seen
+	}
+	check(include)
+	excluded := check(exclude)
+
+	fields := BookFields
+	if len(include) > 0 {
+		fields = make([]Field, 0, len(include))
+		for _, name := range include {
+			if f, ok := LookupField(name); ok {
+				fields = append(fields, f)
+			}
+		}
+	}
+	selected := make([]Field, 0, len(fields))
+	for _, f := range fields {
+		if !excluded[f.Name] && !contains(selected, f.Name) {
+			selected = append(selected, f)
+		}
+	}
+	if !contains(selected, "url") {
+		errs = append(errs, errors.New("the url field cannot be left out"))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return selected, nil
+}
+
+func contains(fields []Field, name string) bool {
+	for _, f := range fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFieldList splits a comma separated list of field names, ignoring
+// spaces and empty entries.
+func ParseFieldList(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (f Field) ptr(b *Book) any {
+	return reflect.ValueOf(b).Elem().Field(f.index).Addr().Interface()
+}
+
+// Value returns the field of b as a string, int64, float64 or time.Time.
+func (f Field) Value(b *Book) any {
+	switch v := f.ptr(b).(type) {
+	case *string:
+		return *v
+	case *int:
+		return int64(*v)
+	case *float64:
+		return *v
+	case *time.Time:
+		return *v
+	}
+	return nil
+}
+
+// SetValue stores v, of the type Value returns, into the field of b.
+func (f Field) SetValue(b *Book, v any) error {
+	ok := false
+	switch p := f.ptr(b).(type) {
+	case *string:
+		*p, ok = v.(string)
+	case *int:
+		var n int64
+		n, ok = v.(int64)
+		*p = int(n)
+	case *float64:
+		*p, ok = v.(float64)
+	case *time.Time:
+		*p, ok = v.(time.Time)
+	}
+	if !ok {
+		return fmt.Errorf("field %s: want a %s, got %T", f.Name, f.Type, v)
+	}
+	return nil
+}
+
+// Text formats the field of b as text, as the CSV writer writes it.
+func (f Field) Text(b *Book) string {
+	switch v := f.ptr(b).(type) {
+	case *string:
+		return *v
+	case *int:
+		return strconv.Itoa(*v)
+	case *float64:
+		return strconv.FormatFloat(*v, 'f', 2, 64)
+	case *time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// SetText parses text, as written by Text, into the field of b. An empty
+// text leaves the field at its zero value.
+func (f Field) SetText(b *Book, text string) error {
+	if text == "" {
+		return nil
+	}
+	var err error
+	switch v := f.ptr(b).(type) {
+	case *string:
+		*v = text
+	case *int:
+		*v, err = strconv.Atoi(text)
+	case *float64:
+		*v, err = strconv.ParseFloat(text, 64)
+	case *time.Time:
+		*v, err = time.Parse(time.RFC3339, text)
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBookFieldsFollowBook(t *testing.T) {
+	typ := reflect.TypeFor[Book]()
+	if len(BookFields) != typ.NumField() {
+		t.Fatalf("BookFields has %d fields, Book %d", len(BookFields), typ.NumField())
+	}
+	for i, f := range BookFields {
+		if tag := typ.Field(i).Tag.Get("csv"); f.Name != tag {
+			t.Errorf("field %d is %s, want %s", i, f.Name, tag)
+		}
+		if tag := typ.Field(i).Tag.Get("json"); f.Name != tag {
+			t.Errorf("field %s has json tag %s", f.Name, tag)
+		}
+	}
+	if f, _ := LookupField("scraped_at"); f.Type != FieldTime {
+		t.Errorf("scraped_at type = %s", f.Type)
+	}
+}
+
+func TestFieldTextRoundTrip(t *testing.T) {
+	book := &Book{Title: "T", RatingNumeric: 4, PriceNumeric: 12.5, ScrapedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	var got Book
+	for _, f := range BookFields {
+		if err := f.SetText(&got, f.Text(book)); err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+	}
+	if got != *book {
+		t.Fatalf("round trip mismatch:\n got  %+v\n want %+v", got, *book)
+	}
+	if f, _ := LookupField("rating_numeric"); f.SetText(&got, "four") == nil {
+		t.Fatal("expected an error for a non-numeric rating")
+	}
+	if f, _ := LookupField("title"); f.SetValue(&got, 3) == nil {
+		t.Fatal("expected an error for a value of the wrong type")
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	names := func(fields []Field) string {
+		out := make([]string, len(fields))
+		for i, f := range fields {
+			out[i] = f.Name
+		}
+		return strings.Join(out, ",")
+	}
+	tests := []struct {
+		include, exclude string
+		want             string
+		wantErr          string
+	}{
+		{include: "url, title ,price", want: "url,title,price"},
+		{include: "url,title,price", exclude: "title", want: "url,price"},
+		{exclude: "image_url,isbn,scraped_at", want: "title,price,rating,rating_numeric,availability,url,price_numeric,source,currency"},
+		{include: "title,author", wantErr: `unknown field "author"`},
+		{include: "url,title,url", wantErr: `field "url" listed twice`},
+		{include: "title", wantErr: "url field cannot be left out"},
+		{exclude: "url", wantErr: "url field cannot be left out"},
+	}
+	for _, tt := range tests {
+		got, err := SelectFields(ParseFieldList(tt.include), ParseFieldList(tt.exclude))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SelectFields(%q, %q) error = %v, want %q", tt.include, tt.exclude, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SelectFields(%q, %q): %v", tt.include, tt.exclude, err)
+		} else if names(got) != tt.want {
+			t.Errorf("SelectFields(%q, %q) = %s, want %s", tt.include, tt.exclude, names(got), tt.want)
+		}
+	}
+	if all, _ := SelectFields(nil, nil); len(all) != len(BookFields) {
+		t.Errorf("no selection gave %d fields, want all %d", len(all), len(BookFields))
+	}
+}
@@ -60,6 +60,21 @@ func NormalizeAvailability(text string) string {
 	return strings.TrimSpace(text)
 }
 
+// NumericToRating converts a numeric rating back to its textual descriptor,
+// rounding to the nearest whole star. Values outside 0-5 yield "".
+func NumericToRating(value float64) string {
+	if value < 0 {
+		return ""
+	}
+	rounded := int(value + 0.5)
+	for word, v := range ratingWordToValue {
+		if v == rounded {
+			return word
+		}
+	}
+	return ""
+}
+
 // RatingToNumeric converts the textual rating to a numeric scale.
 func RatingToNumeric(rating string) int {
 	normalized := strings.TrimSpace(rating)
@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// ArrowWriter writes an Arrow IPC stream with the ArrowSchema of its fields,
+// one record batch per Write. Like the other writers it buffers the stream in
+// a temp file renamed onto the final path by Close.
+type ArrowWriter struct {
+	*atomicFile
+	writer   *ipc.Writer
+	builder  *array.RecordBuilder
+	fields   []models.Field
+	finished bool // end-of-stream written by Validate; no more writes
+	mu       sync.Mutex
+}
+
+// NewArrowWriter initialises the Arrow writer using a temp file in the same
+// directory as filename. The columns are fields, in order, or every field of
+// models.BookFields.
+func NewArrowWriter(filename string, fields ...models.Field) (*ArrowWriter, error) {
+	af, err := createAtomicFile(filename, "arrow")
+	if err != nil {
+		return nil, err
+	}
+	fields = outputFields(fields)
+	schema := ArrowSchema(fields...)
+	return &ArrowWriter{
+		atomicFile: af,
+		writer:     ipc.NewWriter(af, ipc.WithSchema(schema)),
+		builder:    array.NewRecordBuilder(memory.DefaultAllocator, schema),
+		fields:     fields,
+	}, nil
+}
+
+// Write appends books to the stream as one record batch.
+func (aw *ArrowWriter) Write(books []*models.Book) error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.finished {
+		return errors.New("write arrow file: stream already finished by Validate")
+	}
+	if len(books) == 0 {
+		return nil
+	}
+
+	batch := newRecordBatch(aw.builder, aw.fields, books)
+	defer batch.Release()
+	if err := aw.writer.Write(batch); err != nil {
+		return fmt.Errorf("write arrow record batch: %w", err)
+	}
+	return nil
+}
+
+// newRecordBatch builds a record batch of books with the columns of fields,
+// the schema of builder. The caller releases it.
+func newRecordBatch(builder *array.RecordBuilder, fields []models.Field, books []*models.Book) arrow.RecordBatch {
+	for i, f := range fields {
+		column := builder.Field(i)
+		for _, book := range books {
+			switch v := f.Value(book).(type) {
+			case string:
+				column.(*array.StringBuilder).Append(v)
+			case int64:
+				column.(*array.Int64Builder).Append(v)
+			case float64:
+				column.(*array.Float64Builder).Append(v)
+			case time.Time:
+				column.(*array.TimestampBuilder).Append(arrow.Timestamp(v.UnixMicro()))
+			}
+		}
+	}
+	return builder.NewRecordBatch()
+}
+
+// finish writes the end-of-stream marker.
+func (aw *ArrowWriter) finish() error {
+	if aw.finished {
+		return nil
+	}
+	aw.finished = true
+	aw.builder.Release()
+	if err := aw.writer.Close(); err != nil {
+		return fmt.Errorf("finish arrow stream: %w", err)
+	}
+	return nil
+}
+
+// Close finishes the stream, closes the temp file, and atomically renames it
+// onto the final path. On any error the temp file is removed (best-effort)
+// and the final path is left untouched.
+func (aw *ArrowWriter) Close() error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if err := aw.finish(); err != nil {
+		aw.abort()
+		return err
+	}
+	return aw.commit()
+}
+
+// Validate finishes the stream and ensures the temp file has data, so it must
+// come after the last Write.
+func (aw *ArrowWriter) Validate() error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if err := aw.finish(); err != nil {
+		return err
+	}
+	return aw.validate()
+}
+
+// ArrowReader reads Arrow IPC streams written by ArrowWriter, and the record
+// batches of Parquet files for ParquetReader. Columns are matched by name, so
+// files with fewer columns still load.
+type ArrowReader struct {
+	file    io.Closer
+	reader  array.RecordReader
+	columns []int // index in the file schema of each models.BookFields field, or -1
+	batch   arrow.RecordBatch
+	row     int
+}
+
+// NewArrowReader opens filename and reads its schema.
+func NewArrowReader(filename string) (*ArrowReader, error) {
+	f, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open arrow file: %w", err)
+	}
+	reader, err := ipc.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read arrow schema: %w", err)
+	}
+	return newRecordBatchReader(f, reader), nil
+}
+
+// newRecordBatchReader reads books from the batches of reader, closing file
+// once done.
+func newRecordBatchReader(file io.Closer, reader array.RecordReader) *ArrowReader {
+	columns := make([]int, len(models.BookFields))
+	for i, field := range models.BookFields {
+		columns[i] = -1
+		if found := reader.Schema().FieldIndices(field.Name); len(found) > 0 {
+			columns[i] = found[0]
+		}
+	}
+	return &ArrowReader{file: file, reader: reader, columns: columns}
+}
+
+// Read returns the next record.
+func (ar *ArrowReader) Read() (*models.Book, error) {
+	for ar.batch == nil || ar.row >= int(ar.batch.NumRows()) {
+		if !ar.reader.Next() {
+			if err := ar.reader.Err(); err != nil {
+				return nil, fmt.Errorf("read record batch: %w", err)
+			}
+			return nil, io.EOF
+		}
+		ar.batch, ar.row = ar.reader.RecordBatch(), 0
+	}
+
+	book := &models.Book{}
+	for i, f := range models.BookFields {
+		if ar.columns[i] < 0 {
+			continue
+		}
+		var v any
+		switch column := ar.batch.Column(ar.columns[i]).(type) {
+		case *array.String:
+			v = column.Value(ar.row)
+		case *array.Int64:
+			v = column.Value(ar.row)
+		case *array.Float64:
+			v = column.Value(ar.row)
+		case *array.Timestamp:
+			v = time.UnixMicro(int64(column.Value(ar.row))).UTC()
+		}
+		if err := f.SetValue(book, v); err != nil {
+			return nil, fmt.Errorf("arrow record: %w", err)
+		}
+	}
+	ar.row++
+	return book, nil
+}
+
+// Close releases the stream and closes the underlying file.
+func (ar *ArrowReader) Close() error {
+	ar.reader.Release()
+	return ar.file.Close()
+}
@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is an output stream buffered in a temp file in the same
+// directory as its final path (same filesystem => atomic rename) and only
+// renamed into place by commit, so a crash or write error never leaves a
+// half-written file at the final path. When the final path ends in .gz or
+// .zst the data is compressed on the way to the temp file.
+type atomicFile struct {
+	kind       string // csv or json, for error messages
+	finalPath  string
+	tmpPath    string
+	file       *os.File
+	codec      string
+	compressor compressor // nil when uncompressed
+	sealed     bool       // compressor closed by validate; no more writes
+}
+
+func createAtomicFile(filename, kind string) (*atomicFile, error) {
+	if err := ensureDir(filename); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(filename)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create %s temp file: %w", kind, err)
+	}
+	af := &atomicFile{kind: kind, finalPath: filename, tmpPath: f.Name(), file: f, codec: CompressionForPath(filename)}
+	if af.codec != CompressionNone {
+		if af.compressor, err = newCompressor(f, af.codec); err != nil {
+			af.abort()
+			return nil, err
+		}
+	}
+	return af, nil
+}
+
+// Write passes p to the compressor, or straight to the temp file.
+func (af *atomicFile) Write(p []byte) (int, error) {
+	if af.sealed {
+		return 0, fmt.Errorf("write %s file: compressed stream already sealed by Validate", af.kind)
+	}
+	if af.compressor != nil {
+		return af.compressor.Write(p)
+	}
+	return af.file.Write(p)
+}
+
+// seal finishes the compressed stream, if any.
+func (af *atomicFile) seal() error {
+	if af.compressor == nil || af.sealed {
+		return nil
+	}
+	af.sealed = true
+	if err := af.compressor.Close(); err != nil {
+		return fmt.Errorf("finish %s compressed stream: %w", af.kind, err)
+	}
+	return nil
+}
+
+// commit seals and closes the temp file and renames it onto the final path.
+// On any error the temp file is removed (best-effort) and the final path is
+// left untouched.
+func (af *atomicFile) commit() error {
+	if err := af.seal(); err != nil {
+		af.abort()
+		return err
+	}
+	if err := af.file.Close(); err != nil {
+		_ = os.Remove(af.tmpPath)
+		return fmt.Errorf("close %s file: %w", af.kind, err)
+	}
+	if err := os.Rename(af.tmpPath, af.finalPath); err != nil {
+		_ = os.Remove(af.tmpPath)
+		return fmt.Errorf("rename %s file: %w", af.kind, err)
+	}
+	return nil
+}
+
+// Abort discards the output: the temp file is closed and removed and the
+// final path is left untouched.
+func (af *atomicFile) Abort() {
+	af.abort()
+}
+
+// abort closes and removes the temp file.
+func (af *atomicFile) abort() {
+	_ = af.file.Close()
+	_ = os.Remove(af.tmpPath)
+}
+
+// validate ensures the temp file has data. A compressed stream is sealed
+// first and then decompressed in full, so a corrupt stream is caught before
+// it reaches the final path; nothing can be written after that.
+func (af *atomicFile) validate() error {
+	if af.compressor == nil {
+		info, err := af.file.Stat()
+		if err != nil {
+			return fmt.Errorf("stat %s file: %w", af.kind, err)
+		}
+		if info.Size() <= 0 {
+			return fmt.Errorf("%s file is empty", af.kind)
+		}
+		return nil
+	}
+
+	if err := af.seal(); err != nil {
+		return err
+	}
+	f, err := os.Open(af.tmpPath)
+	if err != nil {
+		return fmt.Errorf("open %s file: %w", af.kind, err)
+	}
+	defer func() { _ = f.Close() }()
+	dec, err := newDecompressor(f, af.codec)
+	if err != nil {
+		return fmt.Errorf("%s file is not a valid %s stream: %w", af.kind, af.codec, err)
+	}
+	defer func() { _ = dec.Close() }()
+	n, err := io.Copy(io.Discard, dec)
+	if err != nil {
+		return fmt.Errorf("%s file is not a valid %s stream: %w", af.kind, af.codec, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s file is empty", af.kind)
+	}
+	return nil
+}
+
+// Size returns how many bytes have reached the temp file so far; data still
+// buffered by a compressor is not counted.
+func (af *atomicFile) Size() (int64, error) {
+	info, err := af.file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat %s file: %w", af.kind, err)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hamba/avro/v2/ocf"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// AvroWriter writes an Avro object container file with the AvroSchema of its
+// fields embedded in its header, one deflate-compressed block per Write. Like
+// the other writers it buffers the file in a temp file renamed onto the final
+// path by Close.
+type AvroWriter struct {
+	*atomicFile
+	encoder  *ocf.Encoder
+	fields   []models.Field
+	finished bool // last block written by Validate; no more writes
+	mu       sync.Mutex
+}
+
+// NewAvroWriter initialises the Avro writer using a temp file in the same
+// directory as filename. Records hold fields, in order, or every field of
+// models.BookFields.
+func NewAvroWriter(filename string, fields ...models.Field) (*AvroWriter, error) {
+	af, err := createAtomicFile(filename, "avro")
+	if err != nil {
+		return nil, err
+	}
+	fields = outputFields(fields)
+	encoder, err := ocf.NewEncoder(AvroSchema(fields...), af, ocf.WithCodec(ocf.Deflate))
+	if err != nil {
+		af.abort()
+		return nil, fmt.Errorf("write avro header: %w", err)
+	}
+	return &AvroWriter{atomicFile: af, encoder: encoder, fields: fields}, nil
+}
+
+// Write appends books to the file as one block.
+func (vw *AvroWriter) Write(books []*models.Book) error {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	if vw.finished {
+		return errors.New("write avro file: file already finished by Validate")
+	}
+
+	for _, book := range books {
+		record := make(map[string]any, len(vw.fields))
+		for _, f := range vw.fields {
+			record[f.Name] = f.Value(book)
+		}
+		if err := vw.encoder.Encode(record); err != nil {
+			return fmt.Errorf("encode avro record: %w", err)
+		}
+	}
+	if err := vw.encoder.Flush(); err != nil {
+		return fmt.Errorf("flush avro block: %w", err)
+	}
+	return nil
+}
+
+// finish writes any pending block and releases the codec.
+func (vw *AvroWriter) finish() error {
+	if vw.finished {
+		return nil
+	}
+	vw.finished = true
+	if err := vw.encoder.Close(); err != nil {
+		return fmt.Errorf("finish avro file: %w", err)
+	}
+	return nil
+}
+
+// Close finishes the file, closes the temp file, and atomically renames it
+// onto the final path. On any error the temp file is removed (best-effort)
+// and the final path is left untouched.
+func (vw *AvroWriter) Close() error {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	if err := vw.finish(); err != nil {
+		vw.abort()
+		return err
+	}
+	return vw.commit()
+}
+
+// Validate finishes the file and ensures the temp file has data, so it must
+// come after the last Write.
+func (vw *AvroWriter) Validate() error {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	if err := vw.finish(); err != nil {
+		return err
+	}
+	return vw.validate()
+}
+
+// AvroReader reads Avro object container files written by AvroWriter.
+// Fields are matched by name, so files with fewer fields still load.
+type AvroReader struct {
+	file    io.ReadCloser
+	decoder *ocf.Decoder
+}
+
+// NewAvroReader opens filename and reads its header.
+func NewAvroReader(filename string) (*AvroReader, error) {
+	f, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open avro file: %w", err)
+	}
+	decoder, err := ocf.NewDecoder(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read avro header: %w", err)
+	}
+	return &AvroReader{file: f, decoder: decoder}, nil
+}
+
+// Read returns the next record.
+func (vr *AvroReader) Read() (*models.Book, error) {
+	if !vr.decoder.HasNext() {
+		if err := vr.decoder.Error(); err != nil {
+			return nil, fmt.Errorf("read avro block: %w", err)
+		}
+		return nil, io.EOF
+	}
+	var record map[string]any
+	if err := vr.decoder.Decode(&record); err != nil {
+		return nil, fmt.Errorf("decode avro record: %w", err)
+	}
+	book := &models.Book{}
+	for _, f := range models.BookFields {
+		v, ok := record[f.Name]
+		if !ok {
+			continue
+		}
+		if err := f.SetValue(book, v); err != nil {
+			return nil, fmt.Errorf("avro record: %w", err)
+		}
+	}
+	return book, nil
+}
+
+// Close releases the decoder and closes the underlying file.
+func (vr *AvroReader) Close() error {
+	_ = vr.decoder.Close()
+	return vr.file.Close()
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collectors exports pipeline activity to Prometheus. One Collectors is
+// registered per registry and shared by every pipeline recording into it;
+// queue depth and capacity are summed over the pipelines currently running.
+// A nil *Collectors records nothing.
+type Collectors struct {
+	ProcessedTotal  prometheus.Counter
+	RejectedTotal   *prometheus.CounterVec
+	ValidationTotal *prometheus.CounterVec
+	BatchSize       prometheus.Histogram
+	FlushDuration   prometheus.Histogram
+	WorkerBusyTotal prometheus.Counter
+	queueDepthDesc  *prometheus.Desc
+	queueCapDesc    *prometheus.Desc
+	activeMu        sync.Mutex
+	activePipelines map[*Pipeline]struct{}
+}
+
+// rejectionReasons are the validation kinds that drop a record; other kinds
+// (such as an unparseable price) are recorded but the record is still written.
+var rejectionReasons = map[string]bool{"invalid_record": true, "duplicate_url": true}
+
+// NewCollectors creates the pipeline collectors and registers them on reg.
+func NewCollectors(reg prometheus.Registerer) *Collectors {
+	c := &Collectors{
+		ProcessedTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pipeline_records_processed_total",
+			Help: "Records that passed validation and de-duplication.",
+		}),
+		RejectedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pipeline_records_rejected_total",
+			Help: "Records dropped by the pipeline, by reason.",
+		}, []string{"reason"}),
+		ValidationTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pipeline_validation_errors_total",
+			Help: "Validation problems found by the pipeline, by kind (mirrors PipelineStats.ValidationErrors).",
+		}, []string{"kind"}),
+		BatchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pipeline_batch_size",
+			Help:    "Records per writer batch.",
+			Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128, 256},
+		}),
+		FlushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pipeline_writer_flush_duration_seconds",
+			Help:    "Time spent writing one batch to the output writer.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}),
+		WorkerBusyTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pipeline_worker_busy_seconds_total",
+			Help: "Time pipeline workers spent preparing and writing records rather than waiting for input.",
+		}),
+		queueDepthDesc: prometheus.NewDesc(
+			"pipeline_queue_depth",
+			"Records buffered in the pipeline channel waiting for a worker.",
+			nil, nil,
+		),
+		queueCapDesc: prometheus.NewDesc(
+			"pipeline_queue_capacity",
+			"Capacity of the pipeline channel.",
+			nil, nil,
+		),
+		activePipelines: make(map[*Pipeline]struct{}),
+	}
+	reg.MustRegister(c.ProcessedTotal, c.RejectedTotal, c.ValidationTotal, c.BatchSize, c.FlushDuration, c.WorkerBusyTotal, c)
+	return c
+}
+
+// Describe implements prometheus.Collector for the queue gauges.
+func (c *Collectors) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueDepthDesc
+	ch <- c.queueCapDesc
+}
+
+// Collect implements prometheus.Collector for the queue gauges.
+func (c *Collectors) Collect(ch chan<- prometheus.Metric) {
+	c.activeMu.Lock()
+	depth, capacity := 0, 0
+	for p := range c.activePipelines {
+		n, size := p.QueueFill()
+		depth += n
+		capacity += size
+	}
+	c.activeMu.Unlock()
+	ch <- prometheus.MustNewConstMetric(c.queueDepthDesc, prometheus.GaugeValue, float64(depth))
+	ch <- prometheus.MustNewConstMetric(c.queueCapDesc, prometheus.GaugeValue, float64(capacity))
+}
+
+func (c *Collectors) attach(p *Pipeline) {
+	if c == nil {
+		return
+	}
+	c.activeMu.Lock()
+	c.activePipelines[p] = struct{}{}
+	c.activeMu.Unlock()
+}
+
+func (c *Collectors) detach(p *Pipeline) {
+	if c == nil {
+		return
+	}
+	c.activeMu.Lock()
+	delete(c.activePipelines, p)
+	c.activeMu.Unlock()
+}
+
+func (c *Collectors) incProcessed() {
+	if c != nil {
+		c.ProcessedTotal.Inc()
+	}
+}
+
+func (c *Collectors) addValidation(kind string) {
+	if c == nil {
+		return
+	}
+	c.ValidationTotal.WithLabelValues(kind).Inc()
+	if rejectionReasons[kind] {
+		c.RejectedTotal.WithLabelValues(kind).Inc()
+	}
+}
+
+func (c *Collectors) observeFlush(records int, d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.BatchSize.Observe(float64(records))
+	c.FlushDuration.Observe(d.Seconds())
+}
+
+func (c *Collectors) addBusy(d time.Duration) {
+	if c != nil {
+		c.WorkerBusyTotal.Add(d.Seconds())
+	}
+}
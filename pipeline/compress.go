@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs. Writers and readers pick one from the file extension:
+// .gz for gzip, .zst for zstd, anything else is uncompressed.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var compressionExts = map[string]string{
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+// CompressionForPath returns the codec implied by the extension of filename.
+func CompressionForPath(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for codec, codecExt := range compressionExts {
+		if ext == codecExt {
+			return codec
+		}
+	}
+	return CompressionNone
+}
+
+// CompressionExt returns the file extension of codec, or "" for none.
+func CompressionExt(codec string) string {
+	return compressionExts[codec]
+}
+
+// TrimCompressionExt strips a compression extension from filename, leaving
+// the extension of the format underneath: books.jsonl.gz becomes books.jsonl.
+func TrimCompressionExt(filename string) string {
+	if CompressionForPath(filename) == CompressionNone {
+		return filename
+	}
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// compressor is the part of gzip.Writer and zstd.Encoder the writers use.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func newCompressor(w io.Writer, codec string) (compressor, error) {
+	switch codec {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("create zstd encoder: %w", err)
+		}
+		return enc, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", codec)
+	}
+}
+
+// newDecompressor wraps r in a reader for codec. Closing it does not close r.
+func newDecompressor(r io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip stream: %w", err)
+		}
+		return zr, nil
+	case CompressionZstd:
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("open zstd stream: %w", err)
+		}
+		return zstdReadCloser{dec}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", codec)
+	}
+}
+
+type zstdReadCloser struct{ *zstd.Decoder }
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
+
+// compressedFile is an input file read through the decompressor its
+// extension calls for.
+type compressedFile struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (f *compressedFile) Close() error {
+	var err error
+	for _, c := range f.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openInput opens filename for reading, decompressing it if its extension
+// names a codec.
+func openInput(filename string) (io.ReadCloser, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	codec := CompressionForPath(filename)
+	if codec == CompressionNone {
+		return f, nil
+	}
+	dec, err := newDecompressor(f, codec)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &compressedFile{Reader: dec, closers: []io.Closer{dec, f}}, nil
+}
+
+// UncompressedSize returns how many bytes filename holds once decompressed,
+// reading the whole stream and so also checking it is well-formed.
+func UncompressedSize(filename string) (int64, error) {
+	in, err := openInput(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = in.Close() }()
+	return io.Copy(io.Discard, in)
+}
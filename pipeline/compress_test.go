@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+func TestCompressionPaths(t *testing.T) {
+	tests := []struct {
+		path, codec, trimmed string
+	}{
+		{"books.csv", CompressionNone, "books.csv"},
+		{"books.jsonl.gz", CompressionGzip, "books.jsonl"},
+		{"out/books.CSV.ZST", CompressionZstd, "out/books.CSV"},
+	}
+	for _, tt := range tests {
+		if got := CompressionForPath(tt.path); got != tt.codec {
+			t.Fatalf("CompressionForPath(%q) = %q, want %q", tt.path, got, tt.codec)
+		}
+		if got := TrimCompressionExt(tt.path); got != tt.trimmed {
+			t.Fatalf("TrimCompressionExt(%q) = %q, want %q", tt.path, got, tt.trimmed)
+		}
+	}
+}
+
+func TestCompressedWriterOutput(t *testing.T) {
+	magic := map[string][]byte{
+		"books.jsonl.gz":  {0x1f, 0x8b},
+		"books.jsonl.zst": {0x28, 0xb5, 0x2f, 0xfd},
+	}
+	for name, want := range magic {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			writer, err := NewJSONWriter(path)
+			if err != nil {
+				t.Fatalf("create writer: %v", err)
+			}
+			books := make([]*models.Book, 50)
+			for i := range books {
+				books[i] = &models.Book{Title: "Book", URL: "http://example.test/" + strings.Repeat("x", i)}
+			}
+			if err := writer.Write(books); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := writer.Validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !bytes.HasPrefix(data, want) {
+				t.Fatalf("output starts with % x, want % x", data[:min(len(data), 4)], want)
+			}
+			raw, err := UncompressedSize(path)
+			if err != nil {
+				t.Fatalf("uncompressed size: %v", err)
+			}
+			if raw <= int64(len(data)) {
+				t.Fatalf("raw size %d should exceed compressed size %d", raw, len(data))
+			}
+		})
+	}
+}
+
+func TestCompressedWriterValidateDetectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.csv.gz")
+	writer, err := NewCSVWriter(path)
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	if err := writer.Write([]*models.Book{{Title: "Book", URL: "http://example.test/1"}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(writer.tmpPath, []byte("not gzip"), 0o644); err != nil {
+		t.Fatalf("corrupt temp file: %v", err)
+	}
+	if err := writer.Validate(); err == nil || !strings.Contains(err.Error(), "not a valid gzip stream") {
+		t.Fatalf("Validate error = %v, want an invalid gzip stream", err)
+	}
+	_ = writer.Close()
+}
+
+func TestCompressedWriterRejectsWritesAfterValidate(t *testing.T) {
+	writer, err := NewJSONWriter(filepath.Join(t.TempDir(), "books.jsonl.zst"))
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	book := &models.Book{Title: "Book", URL: "http://example.test/1"}
+	if err := writer.Write([]*models.Book{book}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writer.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := writer.Write([]*models.Book{book}); err == nil {
+		t.Fatal("expected an error writing after Validate sealed the stream")
+	}
+	_ = writer.Close()
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// Format is a file format of the writers: its name, as -format and -sink
+// take it, the extensions of its files, and how to write and read them back.
+type Format struct {
+	Name      string
+	Exts      []string // the first is the one new outputs get
+	NewWriter func(filename string, fields ...models.Field) (OutputWriter, error)
+	NewReader func(filename string) (BookReader, error) // nil when files cannot be read back
+}
+
+// Formats lists every format whose files need nothing but a path to write.
+// The template format, which also needs a template file, and the http sink
+// are not among them.
+var Formats = []Format{
+	{"csv", []string{".csv"}, writerOf(NewCSVWriter), readerOf(NewCSVReader)},
+	{"json", []string{".jsonl", ".json"}, writerOf(NewJSONWriter), readerOf(NewJSONReader)},
+	{"arrow", []string{".arrow"}, writerOf(NewArrowWriter), readerOf(NewArrowReader)},
+	{"parquet", []string{".parquet"}, writerOf(NewParquetWriter), readerOf(NewParquetReader)},
+	{"avro", []string{".avro"}, writerOf(NewAvroWriter), readerOf(NewAvroReader)},
+	{"xlsx", []string{".xlsx"}, writerOf(NewXLSXWriter), readerOf(NewXLSXReader)},
+	{"html", []string{".html"}, writerOf(NewHTMLWriter), readerOf(NewHTMLReader)},
+}
+
+// writerOf and readerOf adapt the constructors of the writers and readers,
+// so a failed one returns a nil interface rather than a typed nil.
+func writerOf[W OutputWriter](newWriter func(string, ...models.Field) (W, error)) func(string, ...models.Field) (OutputWriter, error) {
+	return func(filename string, fields ...models.Field) (OutputWriter, error) {
+		w, err := newWriter(filename, fields...)
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+}
+
+func readerOf[R BookReader](newReader func(string) (R, error)) func(string) (BookReader, error) {
+	return func(filename string) (BookReader, error) {
+		r, err := newReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+}
+
+// LookupFormat returns the format called name.
+func LookupFormat(name string) (Format, bool) {
+	for _, f := range Formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// FormatForPath returns the format of filename from its extension, ignoring
+// a trailing .gz or .zst.
+func FormatForPath(filename string) (Format, bool) {
+	ext := strings.ToLower(filepath.Ext(TrimCompressionExt(filename)))
+	for _, f := range Formats {
+		for _, e := range f.Exts {
+			if e == ext {
+				return f, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// readableExts lists the extensions OpenReader reads, for error messages.
+func readableExts() string {
+	var exts []string
+	for _, f := range Formats {
+		if f.NewReader != nil {
+			exts = append(exts, f.Exts...)
+		}
+	}
+	return strings.Join(exts, ", ")
+}
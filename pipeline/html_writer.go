@@ -0,0 +1,340 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// HTMLWriter writes a self-contained HTML catalog page: a table of books with
+// cover thumbnails, prices, rating stars and availability that the page's own
+// script sorts and filters, without any external stylesheet or script. Rows
+// are written as they come; given a RunSummary before Validate, the page also
+// shows the run summary, which the stylesheet moves above the table.
+//
+// Each row carries its record, the JSON object of the writer's fields, in a
+// data-record attribute. The script sorts and filters on it and HTMLReader
+// reads it back, so the page round-trips like the other formats.
+type HTMLWriter struct {
+	*atomicFile
+	fields   []models.Field
+	show     map[string]bool // names of fields, for the columns shown
+	summary  *RunSummary
+	finished bool // summary and footer written by Validate; no more writes
+	mu       sync.Mutex
+}
+
+// htmlRow is one book as the rows template renders it.
+type htmlRow struct {
+	Book   *models.Book
+	Record string
+}
+
+// NewHTMLWriter initialises the HTML writer and writes the top of the page.
+// Records hold fields, in order, or every field of models.BookFields; the
+// table shows the cover, title, price, rating and availability among them.
+func NewHTMLWriter(filename string, fields ...models.Field) (*HTMLWriter, error) {
+	af, err := createAtomicFile(filename, "html")
+	if err != nil {
+		return nil, err
+	}
+	hw := &HTMLWriter{atomicFile: af, fields: outputFields(fields), show: map[string]bool{}}
+	for _, f := range hw.fields {
+		hw.show[f.Name] = true
+	}
+	if err := htmlTemplates.ExecuteTemplate(af, "head", hw.show); err != nil {
+		af.abort()
+		return nil, fmt.Errorf("write html header: %w", err)
+	}
+	return hw, nil
+}
+
+// Write appends one table row per book.
+func (hw *HTMLWriter) Write(books []*models.Book) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if hw.finished {
+		return errors.New("write html file: page already finished by Validate")
+	}
+	if len(books) == 0 {
+		return nil
+	}
+
+	rows := make([]htmlRow, len(books))
+	var buf bytes.Buffer
+	for i, book := range books {
+		buf.Reset()
+		if err := appendJSONRecord(&buf, book, hw.fields); err != nil {
+			return fmt.Errorf("encode html record: %w", err)
+		}
+		rows[i] = htmlRow{Book: book, Record: buf.String()}
+	}
+	if err := htmlTemplates.ExecuteTemplate(hw.atomicFile, "rows", map[string]any{"Show": hw.show, "Rows": rows}); err != nil {
+		return fmt.Errorf("write html rows: %w", err)
+	}
+	return nil
+}
+
+// SetSummary records the run summary shown at the top of the page.
+func (hw *HTMLWriter) SetSummary(s RunSummary) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.summary = &s
+}
+
+// finish writes the summary and the end of the page.
+func (hw *HTMLWriter) finish() error {
+	if hw.finished {
+		return nil
+	}
+	hw.finished = true
+	var data any
+	if hw.summary != nil {
+		data = map[string]any{"Metrics": hw.summary.metrics(), "Sites": hw.summary.sites()}
+	}
+	if err := htmlTemplates.ExecuteTemplate(hw.atomicFile, "foot", data); err != nil {
+		return fmt.Errorf("finish html page: %w", err)
+	}
+	return nil
+}
+
+// Close finishes the page, closes the temp file, and atomically renames it
+// onto the final path. On any error the temp file is removed (best-effort)
+// and the final path is left untouched.
+func (hw *HTMLWriter) Close() error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if err := hw.finish(); err != nil {
+		hw.abort()
+		return err
+	}
+	return hw.commit()
+}
+
+// Validate finishes the page and ensures the temp file has data, so it must
+// come after the last Write and SetSummary.
+func (hw *HTMLWriter) Validate() error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if err := hw.finish(); err != nil {
+		return err
+	}
+	return hw.validate()
+}
+
+// HTMLReader reads the records of pages written by HTMLWriter from the
+// data-record attributes of their rows.
+type HTMLReader struct {
+	file      io.ReadCloser
+	tokenizer *html.Tokenizer
+	row       int
+}
+
+// NewHTMLReader opens filename for reading.
+func NewHTMLReader(filename string) (*HTMLReader, error) {
+	f, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open html file: %w", err)
+	}
+	return &HTMLReader{file: f, tokenizer: html.NewTokenizer(f)}, nil
+}
+
+// Read returns the next record.
+func (hr *HTMLReader) Read() (*models.Book, error) {
+	for {
+		switch hr.tokenizer.Next() {
+		case html.ErrorToken:
+			if err := hr.tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("read html file: %w", err)
+			}
+			return nil, io.EOF
+		case html.StartTagToken:
+			name, hasAttr := hr.tokenizer.TagName()
+			if string(name) != "tr" || !hasAttr {
+				continue
+			}
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = hr.tokenizer.TagAttr()
+				if string(key) != "data-record" {
+					continue
+				}
+				hr.row++
+				var book models.Book
+				if err := json.Unmarshal(value, &book); err != nil {
+					return nil, fmt.Errorf("html row %d: decode record: %w", hr.row, err)
+				}
+				return &book, nil
+			}
+		}
+	}
+}
+
+// Close closes the underlying file and decompressor.
+func (hr *HTMLReader) Close() error {
+	return hr.file.Close()
+}
+
+var htmlTemplates = template.Must(template.New("html").Funcs(template.FuncMap{
+	"stars": func(rating int) string {
+		rating = min(max(rating, 0), 5)
+		return strings.Repeat("★", rating) + strings.Repeat("☆", 5-rating)
+	},
+	"metric": func(v any) string {
+		switch v := v.(type) {
+		case time.Time:
+			return v.Format("2006-01-02 15:04:05 MST")
+		case float64:
+			return fmt.Sprintf("%.1f", v)
+		default:
+			return fmt.Sprint(v)
+		}
+	},
+}).Parse(htmlPage))
+
+// htmlPage holds the templates of the page: head, written by NewHTMLWriter,
+// rows, written by each Write, and foot, which closes the table and adds the
+// summary.
+const htmlPage = `
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Book catalog</title>
+<style>
+body { margin: 0; font: 14px/1.4 system-ui, sans-serif; color: #222; background: #f6f7f9; }
+main { display: flex; flex-direction: column; gap: 16px; max-width: 1100px; margin: 0 auto; padding: 24px; }
+h1 { margin: 0; font-size: 22px; }
+#summary { order: -1; background: #fff; border: 1px solid #dde1e6; border-radius: 6px; padding: 12px 16px; }
+#summary h2 { margin: 0 0 8px; font-size: 16px; }
+#summary dl { display: grid; grid-template-columns: repeat(auto-fill, minmax(160px, 1fr)); gap: 8px; margin: 0; }
+#summary dt { color: #667; font-size: 12px; }
+#summary dd { margin: 0; font-weight: 600; }
+.controls { display: flex; flex-wrap: wrap; gap: 8px; align-items: center; }
+.controls input, .controls select { padding: 6px 8px; border: 1px solid #c8ccd2; border-radius: 4px; font: inherit; }
+#count { color: #667; }
+table { width: 100%; border-collapse: collapse; background: #fff; border: 1px solid #dde1e6; }
+th, td { padding: 8px; border-bottom: 1px solid #eceef1; text-align: left; vertical-align: middle; }
+th { background: #eef1f5; position: sticky; top: 0; white-space: nowrap; }
+th[data-sort] { cursor: pointer; user-select: none; }
+th[data-dir="asc"]::after { content: " ▲"; }
+th[data-dir="desc"]::after { content: " ▼"; }
+td.num { text-align: right; white-space: nowrap; }
+.cover { width: 48px; height: 64px; object-fit: cover; border-radius: 2px; background: #eceef1; }
+.stars { color: #e0a100; letter-spacing: 1px; white-space: nowrap; }
+a { color: #0b5cad; text-decoration: none; }
+a:hover { text-decoration: underline; }
+</style>
+</head>
+<body>
+<main>
+<h1>Book catalog</h1>
+<div class="controls">
+<input id="search" type="search" placeholder="Filter by title" aria-label="Filter by title">
+{{if .availability}}<select id="availability" aria-label="Availability"><option value="">Any availability</option></select>{{end}}
+{{if .rating_numeric}}<select id="rating" aria-label="Minimum rating"><option value="0">Any rating</option><option value="1">1+ stars</option><option value="2">2+ stars</option><option value="3">3+ stars</option><option value="4">4+ stars</option><option value="5">5 stars</option></select>{{end}}
+<span id="count"></span>
+</div>
+<table id="books">
+<thead><tr>
+{{if .image_url}}<th>Cover</th>{{end}}
+{{if .title}}<th data-sort="title">Title</th>{{end}}
+{{if .price_numeric}}<th data-sort="price_numeric">Price</th>{{else if .price}}<th data-sort="price">Price</th>{{end}}
+{{if .rating_numeric}}<th data-sort="rating_numeric">Rating</th>{{end}}
+{{if .availability}}<th data-sort="availability">Availability</th>{{end}}
+</tr></thead>
+<tbody>
+{{end}}
+
+{{define "rows"}}{{$show := .Show}}{{range .Rows}}<tr data-record="{{.Record}}">
+{{- if $show.image_url}}<td>{{if .Book.ImageURL}}<img class="cover" src="{{.Book.ImageURL}}" alt="" loading="lazy">{{end}}</td>{{end}}
+{{- if $show.title}}<td><a href="{{.Book.URL}}">{{.Book.Title}}</a></td>{{end}}
+{{- if $show.price_numeric}}<td class="num">{{if .Book.Price}}{{.Book.Price}}{{else}}{{printf "%.2f" .Book.PriceNumeric}} {{.Book.Currency}}{{end}}</td>{{else if $show.price}}<td class="num">{{.Book.Price}}</td>{{end}}
+{{- if $show.rating_numeric}}<td class="stars" aria-label="{{.Book.RatingNumeric}} of 5">{{stars .Book.RatingNumeric}}</td>{{end}}
+{{- if $show.availability}}<td>{{.Book.Availability}}</td>{{end -}}
+</tr>
+{{end}}{{end}}
+
+{{define "foot"}}</tbody>
+</table>
+{{with .}}<section id="summary">
+<h2>Run summary</h2>
+<dl>
+{{range .Metrics}}<div><dt>{{.Name}}</dt><dd>{{metric .Value}}</dd></div>
+{{end}}</dl>
+{{with .Sites}}<table>
+<thead><tr><th>Site</th><th>Pages</th><th>Requests</th><th>Books</th><th>Errors</th><th>Retries</th></tr></thead>
+<tbody>
+{{range .}}<tr><td>{{.Name}}</td><td class="num">{{.PageCount}}</td><td class="num">{{.RequestCount}}</td><td class="num">{{.ItemCount}}</td><td class="num">{{.ErrorCount}}</td><td class="num">{{.RetryCount}}</td></tr>
+{{end}}</tbody>
+</table>{{end}}
+</section>{{end}}
+</main>
+<script>
+(function () {
+  var body = document.querySelector("#books tbody");
+  var rows = Array.prototype.slice.call(body.rows).map(function (tr) {
+    return { tr: tr, record: JSON.parse(tr.getAttribute("data-record")) };
+  });
+  var search = document.getElementById("search");
+  var availability = document.getElementById("availability");
+  var rating = document.getElementById("rating");
+  var count = document.getElementById("count");
+
+  if (availability) {
+    var seen = {};
+    rows.forEach(function (row) { seen[row.record.availability] = true; });
+    Object.keys(seen).sort().forEach(function (value) {
+      var option = document.createElement("option");
+      option.value = option.textContent = value;
+      availability.appendChild(option);
+    });
+  }
+
+  function filter() {
+    var text = search.value.trim().toLowerCase();
+    var shown = 0;
+    rows.forEach(function (row) {
+      var r = row.record;
+      var ok = (!text || String(r.title || r.url).toLowerCase().indexOf(text) >= 0) &&
+        (!availability || !availability.value || r.availability === availability.value) &&
+        (!rating || (r.rating_numeric || 0) >= Number(rating.value));
+      row.tr.hidden = !ok;
+      if (ok) shown++;
+    });
+    count.textContent = shown + " of " + rows.length + " books";
+  }
+
+  document.querySelectorAll("#books th[data-sort]").forEach(function (th) {
+    th.addEventListener("click", function () {
+      var key = th.getAttribute("data-sort");
+      var dir = th.getAttribute("data-dir") === "asc" ? "desc" : "asc";
+      document.querySelectorAll("#books th[data-sort]").forEach(function (other) { other.removeAttribute("data-dir"); });
+      th.setAttribute("data-dir", dir);
+      rows.sort(function (a, b) {
+        var x = a.record[key], y = b.record[key];
+        var c = typeof x === "number" && typeof y === "number" ? x - y : String(x).localeCompare(String(y));
+        return dir === "asc" ? c : -c;
+      });
+      rows.forEach(function (row) { body.appendChild(row.tr); });
+    });
+  });
+
+  [search, availability, rating].forEach(function (el) { if (el) el.addEventListener("input", filter); });
+  filter();
+})();
+</script>
+</body>
+</html>
+{{end}}`
@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+func TestHTMLWriter_Page(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.html")
+	writer, err := NewHTMLWriter(path)
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	book := &models.Book{
+		Title:         `<script>alert("x")</script>`,
+		Price:         "£12.50",
+		PriceNumeric:  12.5,
+		RatingNumeric: 4,
+		Availability:  "In stock",
+		ImageURL:      "http://example.test/cover.jpg",
+		URL:           "http://example.test/book",
+	}
+	if err := writer.Write([]*models.Book{book}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	writer.SetSummary(RunSummary{
+		Result: &models.ScraperResult{
+			StartTime: start,
+			EndTime:   start.Add(time.Minute),
+			PageCount: 3,
+			Domains:   map[string]models.DomainResult{"example.test": {PageCount: 3, ItemCount: 1}},
+		},
+		Stats: PipelineStats{Processed: 1},
+	})
+	if err := writer.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := writer.Write([]*models.Book{book}); err == nil {
+		t.Error("write after validate succeeded, want an error")
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read page: %v", err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		`<img class="cover" src="http://example.test/cover.jpg"`,
+		`&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;`,
+		`★★★★☆`,
+		`<section id="summary">`,
+		`<dt>Pages</dt><dd>3</dd>`,
+		`<td>example.test</td>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %s", want)
+		}
+	}
+	if strings.Contains(page, `<script>alert`) {
+		t.Error("page holds the title unescaped")
+	}
+	for _, external := range []string{`<link `, `<script src`} {
+		if strings.Contains(page, external) {
+			t.Errorf("page loads %s, want it self-contained", external)
+		}
+	}
+
+	books, err := ReadAll(path)
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if len(books) != 1 || *books[0] != *book {
+		t.Fatalf("read back %+v, want %+v", books, book)
+	}
+}
+
+func TestHTMLWriter_SelectedFields(t *testing.T) {
+	fields, err := models.SelectFields([]string{"url", "title", "price"}, nil)
+	if err != nil {
+		t.Fatalf("select fields: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "books.html")
+	writer, err := NewHTMLWriter(path, fields...)
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	if err := writer.Write([]*models.Book{{Title: "One", Price: "£1.00", RatingNumeric: 5, URL: "http://example.test/one"}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writer.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read page: %v", err)
+	}
+	page := string(data)
+	if !strings.Contains(page, `<th data-sort="price">Price</th>`) {
+		t.Error("page lacks the price column")
+	}
+	for _, unwanted := range []string{"<th>Cover</th>", "★", `id="rating"`, `id="summary"`} {
+		if strings.Contains(page, unwanted) {
+			t.Errorf("page holds %s, which was not selected", unwanted)
+		}
+	}
+	books, err := ReadAll(path)
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if len(books) != 1 || books[0].RatingNumeric != 0 || books[0].Title != "One" {
+		t.Errorf("read back %+v, want only the selected fields", books)
+	}
+}
@@ -0,0 +1,285 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// HTTP body encodings.
+const (
+	HTTPBodyNDJSON = "ndjson" // one JSON record per line
+	HTTPBodyJSON   = "json"   // one JSON array per batch
+)
+
+// HTTPWriterConfig configures an HTTPWriter.
+type HTTPWriterConfig struct {
+	URL     string
+	Body    string         // HTTPBodyNDJSON (the default) or HTTPBodyJSON
+	Headers http.Header    // added to every request
+	Token   string         // sent as a bearer token when set
+	Gzip    bool           // gzip request bodies
+	Fields  []models.Field // of each record; nil sends every field
+
+	// A batch is retried up to MaxRetries times on network errors, 429 and
+	// 5xx responses, waiting Backoff, then twice as long each time up to
+	// BackoffMax (defaultHTTPBackoffMax when zero), or what Retry-After asks
+	// for.
+	MaxRetries int
+	Backoff    time.Duration
+	BackoffMax time.Duration
+
+	Client *http.Client // nil uses a client with a 30s timeout
+}
+
+// defaultHTTPBackoffMax caps retry backoff when BackoffMax is not set.
+const defaultHTTPBackoffMax = time.Minute
+
+// HTTPWriter streams records to an HTTP endpoint, POSTing each batch as it
+// is written. Batches written concurrently are posted concurrently. Every
+// batch carries an Idempotency-Key header, unique to the
+// writer and the batch and kept across retries, so the receiver can drop
+// duplicates of a batch it already accepted.
+type HTTPWriter struct {
+	cfg    HTTPWriterConfig
+	client *http.Client
+	run    string // prefix of the idempotency keys
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	batches  int // batches sent so far
+	acked    int // batches the server accepted
+	records  int // records in acknowledged batches
+	firstErr error
+}
+
+// NewHTTPWriter returns a writer posting to cfg.URL.
+func NewHTTPWriter(cfg HTTPWriterConfig) (*HTTPWriter, error) {
+	switch cfg.Body {
+	case "":
+		cfg.Body = HTTPBodyNDJSON
+	case HTTPBodyNDJSON, HTTPBodyJSON:
+	default:
+		return nil, fmt.Errorf("unsupported HTTP body %q: want %s or %s", cfg.Body, HTTPBodyNDJSON, HTTPBodyJSON)
+	}
+	if _, err := http.NewRequest(http.MethodPost, cfg.URL, nil); err != nil {
+		return nil, fmt.Errorf("invalid HTTP sink URL: %w", err)
+	}
+	cfg.Fields = outputFields(cfg.Fields)
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("generate idempotency key: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HTTPWriter{cfg: cfg, client: client, run: hex.EncodeToString(id), ctx: ctx, cancel: cancel}, nil
+}
+
+// Write POSTs books as one batch, retrying as configured, and fails if the
+// server does not accept it.
+func (hw *HTTPWriter) Write(books []*models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+	body, err := hw.encode(books)
+	if err != nil {
+		return err
+	}
+
+	// The lock only covers the counters, so one slow POST, with its retries,
+	// does not hold up batches from other workers.
+	hw.mu.Lock()
+	hw.batches++
+	key := fmt.Sprintf("%s-%d", hw.run, hw.batches)
+	hw.mu.Unlock()
+
+	err = hw.send(body, key)
+
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if err != nil {
+		err = fmt.Errorf("post batch %s: %w", key, err)
+		if hw.firstErr == nil {
+			hw.firstErr = err
+		}
+		return err
+	}
+	hw.acked++
+	hw.records += len(books)
+	return nil
+}
+
+// encode renders books as the request body.
+func (hw *HTTPWriter) encode(books []*models.Book) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if hw.cfg.Gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	array := hw.cfg.Body == HTTPBodyJSON
+	var record bytes.Buffer
+	for i, book := range books {
+		record.Reset()
+		switch {
+		case array && i == 0:
+			record.WriteByte('[')
+		case array:
+			record.WriteByte(',')
+		}
+		if err := appendJSONRecord(&record, book, hw.cfg.Fields); err != nil {
+			return nil, fmt.Errorf("encode batch: %w", err)
+		}
+		if !array {
+			record.WriteByte('\n')
+		}
+		if _, err := w.Write(record.Bytes()); err != nil {
+			return nil, fmt.Errorf("encode batch: %w", err)
+		}
+	}
+	if array {
+		if _, err := io.WriteString(w, "]\n"); err != nil {
+			return nil, fmt.Errorf("encode batch: %w", err)
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("compress batch: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// send POSTs body until it is accepted, a permanent error occurs or the
+// retries run out.
+func (hw *HTTPWriter) send(body []byte, key string) error {
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := hw.post(body, key)
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= hw.cfg.MaxRetries {
+			return err
+		}
+		delay := max(retryAfter, hw.backoff(attempt+1))
+		select {
+		case <-time.After(delay):
+		case <-hw.ctx.Done():
+			return fmt.Errorf("%w (writer closed while waiting to retry)", err)
+		}
+	}
+}
+
+// permanentError is a response retrying will not fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// post makes one attempt, returning how long the server asked to wait before
+// the next one, if it did.
+func (hw *HTTPWriter) post(body []byte, key string) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(hw.ctx, http.MethodPost, hw.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, &permanentError{err}
+	}
+	for name, values := range hw.cfg.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if hw.cfg.Body == HTTPBodyJSON {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if hw.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if hw.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+hw.cfg.Token)
+	}
+	req.Header.Set("Idempotency-Key", key)
+
+	resp, err := hw.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		err := fmt.Errorf("server responded %s", resp.Status)
+		if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && secs > 0 {
+			return time.Duration(secs) * time.Second, err
+		}
+		return 0, err
+	default:
+		return 0, &permanentError{fmt.Errorf("server responded %s", resp.Status)}
+	}
+}
+
+func (hw *HTTPWriter) backoff(attempt int) time.Duration {
+	base := hw.cfg.Backoff
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	limit := hw.cfg.BackoffMax
+	if limit <= 0 {
+		limit = defaultHTTPBackoffMax
+	}
+	// Doubling stops at the limit, so no attempt count overflows.
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// Validate confirms the server acknowledged every batch sent, and that there
+// was at least one.
+func (hw *HTTPWriter) Validate() error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	switch {
+	case hw.acked < hw.batches:
+		return fmt.Errorf("server acknowledged %d of %d batches: %w", hw.acked, hw.batches, hw.firstErr)
+	case hw.batches == 0:
+		return errors.New("no batches sent")
+	}
+	return nil
+}
+
+// Close abandons any retry still waiting and releases idle connections.
+func (hw *HTTPWriter) Close() error {
+	hw.cancel()
+	hw.client.CloseIdleConnections()
+	return nil
+}
+
+// Acknowledged returns the number of batches and records the server accepted.
+func (hw *HTTPWriter) Acknowledged() (batches, records int) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	return hw.acked, hw.records
+}
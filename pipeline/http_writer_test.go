@@ -0,0 +1,271 @@
+package pipeline
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// batchRecorder is an endpoint recording the requests it receives, answering
+// with the statuses in replies first and 200 OK afterwards.
+type batchRecorder struct {
+	mu       sync.Mutex
+	replies  []int
+	requests []recordedRequest
+}
+
+type recordedRequest struct {
+	header http.Header
+	books  []*models.Book
+}
+
+func (br *batchRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	var books []*models.Book
+	if r.Header.Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(body).Decode(&books); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		sc := bufio.NewScanner(body)
+		for sc.Scan() {
+			var book models.Book
+			if err := json.Unmarshal(sc.Bytes(), &book); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			books = append(books, &book)
+		}
+	}
+
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.requests = append(br.requests, recordedRequest{header: r.Header.Clone(), books: books})
+	if len(br.replies) > 0 {
+		status := br.replies[0]
+		br.replies = br.replies[1:]
+		w.WriteHeader(status)
+	}
+}
+
+func newTestHTTPWriter(t *testing.T, cfg HTTPWriterConfig) *HTTPWriter {
+	t.Helper()
+	cfg.Backoff = time.Millisecond
+	hw, err := NewHTTPWriter(cfg)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	t.Cleanup(func() { _ = hw.Close() })
+	return hw
+}
+
+func TestHTTPWriter_Bodies(t *testing.T) {
+	for _, tc := range []struct {
+		body        string
+		gzip        bool
+		contentType string
+	}{
+		{body: HTTPBodyNDJSON, contentType: "application/x-ndjson"},
+		{body: HTTPBodyJSON, contentType: "application/json"},
+		{body: HTTPBodyNDJSON, gzip: true, contentType: "application/x-ndjson"},
+		{body: HTTPBodyJSON, gzip: true, contentType: "application/json"},
+	} {
+		rec := &batchRecorder{}
+		srv := httptest.NewServer(rec)
+		hw := newTestHTTPWriter(t, HTTPWriterConfig{
+			URL:     srv.URL,
+			Body:    tc.body,
+			Gzip:    tc.gzip,
+			Headers: http.Header{"X-Source": {"scraper"}},
+			Token:   "s3cret",
+		})
+		if err := hw.Write(rotationBooks(3)); err != nil {
+			t.Fatalf("%s gzip=%v: write: %v", tc.body, tc.gzip, err)
+		}
+		if err := hw.Write(rotationBooks(2)); err != nil {
+			t.Fatalf("%s gzip=%v: write: %v", tc.body, tc.gzip, err)
+		}
+		if err := hw.Validate(); err != nil {
+			t.Errorf("%s gzip=%v: validate: %v", tc.body, tc.gzip, err)
+		}
+		srv.Close()
+
+		if len(rec.requests) != 2 {
+			t.Fatalf("%s gzip=%v: got %d requests, want 2", tc.body, tc.gzip, len(rec.requests))
+		}
+		req := rec.requests[0]
+		if len(req.books) != 3 || req.books[2].URL != rotationBooks(3)[2].URL {
+			t.Errorf("%s gzip=%v: first batch decoded as %d books", tc.body, tc.gzip, len(req.books))
+		}
+		if got := req.header.Get("Content-Type"); got != tc.contentType {
+			t.Errorf("%s gzip=%v: Content-Type = %q, want %q", tc.body, tc.gzip, got, tc.contentType)
+		}
+		if got := req.header.Get("Authorization"); got != "Bearer s3cret" {
+			t.Errorf("%s gzip=%v: Authorization = %q", tc.body, tc.gzip, got)
+		}
+		if got := req.header.Get("X-Source"); got != "scraper" {
+			t.Errorf("%s gzip=%v: X-Source = %q", tc.body, tc.gzip, got)
+		}
+		if rec.requests[0].header.Get("Idempotency-Key") == rec.requests[1].header.Get("Idempotency-Key") {
+			t.Errorf("%s gzip=%v: batches share an idempotency key", tc.body, tc.gzip)
+		}
+		if batches, records := hw.Acknowledged(); batches != 2 || records != 5 {
+			t.Errorf("%s gzip=%v: acknowledged %d batches, %d records, want 2, 5", tc.body, tc.gzip, batches, records)
+		}
+	}
+}
+
+func TestHTTPWriter_RetriesKeepIdempotencyKey(t *testing.T) {
+	rec := &batchRecorder{replies: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	hw := newTestHTTPWriter(t, HTTPWriterConfig{URL: srv.URL, MaxRetries: 2})
+
+	if err := hw.Write(rotationBooks(1)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := hw.Validate(); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+	if len(rec.requests) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(rec.requests))
+	}
+	key := rec.requests[0].header.Get("Idempotency-Key")
+	if key == "" {
+		t.Fatal("no idempotency key sent")
+	}
+	for i, req := range rec.requests {
+		if got := req.header.Get("Idempotency-Key"); got != key {
+			t.Errorf("attempt %d: idempotency key %q, want %q", i+1, got, key)
+		}
+	}
+}
+
+func TestHTTPWriter_Failures(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		replies  []int
+		attempts int
+	}{
+		{name: "client error is not retried", replies: []int{http.StatusBadRequest}, attempts: 1},
+		{name: "retries run out", replies: []int{500, 502, 503, 504}, attempts: 3},
+	} {
+		rec := &batchRecorder{replies: tc.replies}
+		srv := httptest.NewServer(rec)
+		hw := newTestHTTPWriter(t, HTTPWriterConfig{URL: srv.URL, MaxRetries: 2})
+
+		if err := hw.Write(rotationBooks(1)); err == nil {
+			t.Errorf("%s: write succeeded", tc.name)
+		}
+		if len(rec.requests) != tc.attempts {
+			t.Errorf("%s: got %d attempts, want %d", tc.name, len(rec.requests), tc.attempts)
+		}
+		err := hw.Validate()
+		if err == nil || !strings.Contains(err.Error(), "acknowledged 0 of 1 batches") {
+			t.Errorf("%s: validate = %v, want unacknowledged batch", tc.name, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestHTTPWriter_RetryAfter(t *testing.T) {
+	var calls int
+	var first time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		if calls == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if waited := time.Since(first); waited < 900*time.Millisecond {
+			t.Errorf("retried after %v, want at least the 1s Retry-After", waited)
+		}
+	}))
+	defer srv.Close()
+	hw := newTestHTTPWriter(t, HTTPWriterConfig{URL: srv.URL, MaxRetries: 1})
+
+	if err := hw.Write(rotationBooks(1)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestHTTPWriter_ValidateWithoutBatches(t *testing.T) {
+	hw := newTestHTTPWriter(t, HTTPWriterConfig{URL: "http://127.0.0.1:1/"})
+	if err := hw.Validate(); err == nil {
+		t.Error("validate succeeded without any batch sent")
+	}
+	if _, err := NewHTTPWriter(HTTPWriterConfig{URL: "http://example.com", Body: "xml"}); err == nil {
+		t.Error("accepted an unsupported body")
+	}
+}
+
+func TestHTTPWriter_PostsConcurrently(t *testing.T) {
+	// The first request is held until a second one arrives, which only
+	// happens if the writer does not serialize its POSTs.
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	hw := newTestHTTPWriter(t, HTTPWriterConfig{URL: srv.URL})
+
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() { errs <- hw.Write(rotationBooks(1)) }()
+	}
+	for range 2 {
+		select {
+		case <-arrived:
+		case <-time.After(2 * time.Second):
+			close(release)
+			t.Fatal("batches were posted one after the other")
+		}
+	}
+	close(release)
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := hw.Validate(); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+}
+
+func TestHTTPWriter_BackoffIsCapped(t *testing.T) {
+	hw := newTestHTTPWriter(t, HTTPWriterConfig{URL: "http://127.0.0.1:1/"})
+	if got := hw.backoff(3); got != 4*time.Millisecond {
+		t.Errorf("backoff(3) = %v, want 4ms", got)
+	}
+	for _, attempt := range []int{64, 1000} {
+		if got := hw.backoff(attempt); got != defaultHTTPBackoffMax {
+			t.Errorf("backoff(%d) = %v, want the %v default cap", attempt, got, defaultHTTPBackoffMax)
+		}
+	}
+	hw.cfg.BackoffMax = 10 * time.Millisecond
+	if got := hw.backoff(1000); got != 10*time.Millisecond {
+		t.Errorf("backoff(1000) = %v, want BackoffMax", got)
+	}
+}
@@ -0,0 +1,375 @@
+package pipeline
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// ErrorPolicy decides what a failing sink of a MultiWriter does to the run.
+type ErrorPolicy string
+
+// Error policies.
+const (
+	// FailFast returns the sink's error, failing the run. It is the default.
+	FailFast ErrorPolicy = "fail-fast"
+	// BestEffort logs the error and drops the sink, whose incomplete output
+	// is discarded; the others carry on.
+	BestEffort ErrorPolicy = "best-effort"
+	// Quarantine writes the batches the sink failed to a JSONL side file
+	// and keeps offering it later batches. The batches it accepted are
+	// journaled too, so if the sink's output is lost in the end, as when a
+	// file writer fails and removes its temp file, they join the side file
+	// and nothing is lost.
+	Quarantine ErrorPolicy = "quarantine"
+)
+
+// Sink is one output of a MultiWriter.
+type Sink struct {
+	Name   string // identifies the sink in errors and logs, usually its path
+	Writer OutputWriter
+	Policy ErrorPolicy // "" means FailFast
+	// QuarantinePath receives the failed batches of a Quarantine sink;
+	// QuarantinePathFor(Name) when empty.
+	QuarantinePath string
+}
+
+// QuarantinePathFor names the quarantine file of a sink writing filename:
+// books.csv.gz gives books.quarantine.jsonl.
+func QuarantinePathFor(filename string) string {
+	stem, _ := splitShardExt(filename)
+	return stem + ".quarantine.jsonl"
+}
+
+// sinkState is a Sink and what has gone wrong with it so far.
+type sinkState struct {
+	Sink
+	failed      error       // set once the sink is dropped
+	journal     *JSONWriter // batches a Quarantine sink accepted; never published
+	quarantine  *JSONWriter
+	quarantined int
+}
+
+// MultiWriter fans every batch out to several sinks at once, so a slow sink
+// does not hold the others up, and applies each sink's ErrorPolicy to its
+// failures. Pipeline workers may call Write concurrently; mu serializes the
+// calls, so each batch reaches every sink before the next starts.
+type MultiWriter struct {
+	mu    sync.Mutex
+	sinks []*sinkState
+}
+
+// NewMultiWriter returns a writer over sinks, which must not be empty.
+func NewMultiWriter(sinks ...Sink) (*MultiWriter, error) {
+	if len(sinks) == 0 {
+		return nil, errors.New("multi writer needs at least one sink")
+	}
+	mw := &MultiWriter{sinks: make([]*sinkState, len(sinks))}
+	for i, s := range sinks {
+		switch s.Policy {
+		case "":
+			s.Policy = FailFast
+		case FailFast, BestEffort, Quarantine:
+		default:
+			return nil, fmt.Errorf("sink %s: unknown error policy %q", s.Name, s.Policy)
+		}
+		if s.Policy == Quarantine && s.QuarantinePath == "" {
+			s.QuarantinePath = QuarantinePathFor(s.Name)
+		}
+		mw.sinks[i] = &sinkState{Sink: s}
+	}
+	return mw, nil
+}
+
+// live returns the sinks that have not been dropped.
+func (mw *MultiWriter) live() []*sinkState {
+	live := make([]*sinkState, 0, len(mw.sinks))
+	for _, s := range mw.sinks {
+		if s.failed == nil {
+			live = append(live, s)
+		}
+	}
+	return live
+}
+
+// each runs fn on every live sink concurrently and returns the errors by
+// sink.
+func (mw *MultiWriter) each(fn func(s *sinkState) error) map[*sinkState]error {
+	live := mw.live()
+	errs := make([]error, len(live))
+	var wg sync.WaitGroup
+	for i, s := range live {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(s)
+		}()
+	}
+	wg.Wait()
+
+	failed := make(map[*sinkState]error)
+	for i, err := range errs {
+		if err != nil {
+			failed[live[i]] = err
+		}
+	}
+	return failed
+}
+
+// Write writes books to every live sink.
+func (mw *MultiWriter) Write(books []*models.Book) error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	failed := mw.each(func(s *sinkState) error {
+		if err := s.Writer.Write(books); err != nil {
+			return err
+		}
+		return s.journalBatch(books)
+	})
+	var errs []error
+	for _, s := range mw.sinks {
+		err, ok := failed[s]
+		if !ok {
+			continue
+		}
+		switch s.Policy {
+		case BestEffort:
+			mw.drop(s, err)
+		case Quarantine:
+			if qerr := s.quarantineBatch(books, err); qerr != nil {
+				errs = append(errs, qerr)
+			}
+		default:
+			errs = append(errs, fmt.Errorf("sink %s: %w", s.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// drop stops writing to a BestEffort sink after err.
+func (mw *MultiWriter) drop(s *sinkState, err error) {
+	s.failed = err
+	slog.Warn("output sink failed, continuing without it", slog.String("sink", s.Name), slog.Any("error", err))
+}
+
+// journalBatch records books, which a Quarantine sink accepted, in its
+// journal.
+func (s *sinkState) journalBatch(books []*models.Book) error {
+	if s.Policy != Quarantine {
+		return nil
+	}
+	if s.journal == nil {
+		j, err := NewJSONWriter(s.QuarantinePath + ".journal")
+		if err != nil {
+			return fmt.Errorf("journal: %w", err)
+		}
+		s.journal = j
+	}
+	if err := s.journal.Write(books); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	return nil
+}
+
+// discardJournal removes the journal of a sink whose output was published
+// or aborted.
+func (s *sinkState) discardJournal() {
+	if s.journal != nil {
+		s.journal.abort()
+		s.journal = nil
+	}
+}
+
+// rescueJournal moves the batches a Quarantine sink accepted before its
+// output was lost with err into its quarantine file.
+func (s *sinkState) rescueJournal(err error) error {
+	if s.journal == nil {
+		return nil
+	}
+	defer s.discardJournal()
+	if ferr := s.journal.writer.Flush(); ferr != nil {
+		return fmt.Errorf("sink %s: %w (journal: %w)", s.Name, err, ferr)
+	}
+	reader, rerr := NewJSONReader(s.journal.tmpPath)
+	if rerr != nil {
+		return fmt.Errorf("sink %s: %w (journal: %w)", s.Name, err, rerr)
+	}
+	defer func() { _ = reader.Close() }()
+
+	batch := make([]*models.Book, 0, journalBatchSize)
+	for {
+		book, rerr := reader.Read()
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return fmt.Errorf("sink %s: %w (journal: %w)", s.Name, err, rerr)
+		}
+		if batch = append(batch, book); len(batch) == journalBatchSize {
+			if qerr := s.quarantineBatch(batch, err); qerr != nil {
+				return qerr
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return s.quarantineBatch(batch, err)
+}
+
+// journalBatchSize is how many journaled records rescueJournal quarantines
+// at a time.
+const journalBatchSize = 1000
+
+// quarantineBatch diverts books, which s failed to write with err, to its
+// quarantine file.
+func (s *sinkState) quarantineBatch(books []*models.Book, err error) error {
+	if s.quarantine == nil {
+		q, qerr := NewJSONWriter(s.QuarantinePath)
+		if qerr != nil {
+			return fmt.Errorf("sink %s: %w (quarantine: %w)", s.Name, err, qerr)
+		}
+		s.quarantine = q
+	}
+	if qerr := s.quarantine.Write(books); qerr != nil {
+		return fmt.Errorf("sink %s: %w (quarantine: %w)", s.Name, err, qerr)
+	}
+	s.quarantined += len(books)
+	slog.Warn("output sink failed, batch quarantined",
+		slog.String("sink", s.Name),
+		slog.String("quarantine", s.QuarantinePath),
+		slog.Int("records", len(books)),
+		slog.Any("error", err),
+	)
+	return nil
+}
+
+// Validate validates every live sink and any quarantine file. A sink that
+// fails validation is dropped unless it is FailFast; if every sink has been
+// dropped, Validate fails.
+func (mw *MultiWriter) Validate() error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	failed := mw.each(func(s *sinkState) error { return s.Writer.Validate() })
+	var errs []error
+	for _, s := range mw.sinks {
+		if err, ok := failed[s]; ok {
+			if s.Policy == FailFast {
+				errs = append(errs, fmt.Errorf("sink %s: %w", s.Name, err))
+			} else {
+				mw.drop(s, err)
+			}
+		}
+		if s.quarantine != nil {
+			if err := s.quarantine.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("sink %s quarantine: %w", s.Name, err))
+			}
+		}
+	}
+	if len(mw.live()) == 0 {
+		errs = append(errs, errors.New("every output sink failed"))
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink. Each sink publishes its file independently, so if
+// one fails after another succeeded the successful file is already in place;
+// stage the sinks with a Publisher to publish them together.
+// Dropped sinks are aborted instead, so their incomplete output is not
+// published, and their errors are only logged.
+func (mw *MultiWriter) Close() error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	var errs []error
+	for _, s := range mw.sinks {
+		var err error
+		if s.failed != nil {
+			err = Abort(s.Writer)
+		} else {
+			err = s.Writer.Close()
+		}
+		if s.Policy == Quarantine {
+			if lost := cmp.Or(err, s.failed); lost != nil {
+				// The sink's output is gone, so what it accepted joins the
+				// quarantine file.
+				if qerr := s.rescueJournal(lost); qerr != nil {
+					errs = append(errs, qerr)
+				}
+				err = nil
+			}
+			s.discardJournal()
+		}
+		if err != nil {
+			if s.failed != nil {
+				slog.Debug("closing failed output sink", slog.String("sink", s.Name), slog.Any("error", err))
+			} else {
+				errs = append(errs, fmt.Errorf("sink %s: %w", s.Name, err))
+			}
+		}
+		if s.quarantine == nil {
+			continue
+		}
+		if err := s.quarantine.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s quarantine: %w", s.Name, err))
+			continue
+		}
+		slog.Warn("records quarantined", slog.String("sink", s.Name), slog.String("quarantine", s.QuarantinePath), slog.Int("records", s.quarantined))
+	}
+	return errors.Join(errs...)
+}
+
+// Abort discards the output of every sink and its quarantine file. Sinks
+// that cannot abort are closed, and their errors only logged.
+func (mw *MultiWriter) Abort() {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	for _, s := range mw.sinks {
+		if err := Abort(s.Writer); err != nil {
+			slog.Debug("closing aborted output sink", slog.String("sink", s.Name), slog.Any("error", err))
+		}
+		s.discardJournal()
+		if s.quarantine != nil {
+			s.quarantine.Abort()
+		}
+	}
+}
+
+// SetSummary hands the run summary to every live sink that reports one.
+func (mw *MultiWriter) SetSummary(summary RunSummary) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	for _, s := range mw.live() {
+		SetSummary(s.Writer, summary)
+	}
+}
+
+// Size returns the size of the largest live sink so far. Sinks that cannot
+// report a size are skipped.
+func (mw *MultiWriter) Size() (int64, error) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	var largest int64
+	for _, s := range mw.live() {
+		sz, ok := s.Writer.(sizer)
+		if !ok {
+			continue
+		}
+		size, err := sz.Size()
+		if err != nil {
+			return 0, fmt.Errorf("sink %s: %w", s.Name, err)
+		}
+		largest = max(largest, size)
+	}
+	return largest, nil
+}
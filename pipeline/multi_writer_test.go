@@ -0,0 +1,263 @@
+package pipeline
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// failingWriter fails every Write with err, when set.
+type failingWriter struct {
+	mockWriter
+	err error
+}
+
+func (fw *failingWriter) Write(books []*models.Book) error {
+	if fw.err != nil {
+		return fw.err
+	}
+	return fw.mockWriter.Write(books)
+}
+
+// abortableWriter is a failingWriter that records being aborted.
+type abortableWriter struct {
+	failingWriter
+	aborted bool
+}
+
+func (aw *abortableWriter) Abort() {
+	aw.aborted = true
+}
+
+// rendezvousWriter waits in Write until its peer has started writing too.
+type rendezvousWriter struct {
+	mockWriter
+	started, peer chan struct{}
+}
+
+func (rw *rendezvousWriter) Write(books []*models.Book) error {
+	close(rw.started)
+	<-rw.peer
+	return rw.mockWriter.Write(books)
+}
+
+func TestMultiWriter_WritesSinksConcurrently(t *testing.T) {
+	a, b := make(chan struct{}), make(chan struct{})
+	mw, err := NewMultiWriter(
+		Sink{Name: "a", Writer: &rendezvousWriter{started: a, peer: b}},
+		Sink{Name: "b", Writer: &rendezvousWriter{started: b, peer: a}},
+	)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- mw.Write(rotationBooks(1)) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("sinks were written one after the other")
+	}
+}
+
+func TestMultiWriter_FailFast(t *testing.T) {
+	ok := &mockWriter{}
+	mw, err := NewMultiWriter(
+		Sink{Name: "ok", Writer: ok},
+		Sink{Name: "broken", Writer: &failingWriter{err: errors.New("disk full")}},
+	)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	err = mw.Write(rotationBooks(2))
+	if err == nil || !strings.Contains(err.Error(), "sink broken: disk full") {
+		t.Fatalf("write error = %v, want the failing sink named", err)
+	}
+	if ok.totalWritten() != 2 {
+		t.Fatalf("healthy sink got %d records, want 2", ok.totalWritten())
+	}
+}
+
+func TestMultiWriter_BestEffort(t *testing.T) {
+	ok := &mockWriter{}
+	broken := &abortableWriter{failingWriter: failingWriter{err: errors.New("disk full")}}
+	mw, err := NewMultiWriter(
+		Sink{Name: "ok", Writer: ok},
+		Sink{Name: "broken", Writer: broken, Policy: BestEffort},
+	)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for range 2 {
+		if err := mw.Write(rotationBooks(2)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	broken.err = nil
+	if err := mw.Write(rotationBooks(1)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if ok.totalWritten() != 5 || broken.totalWritten() != 0 {
+		t.Fatalf("records written = %d and %d, want 5 and a dropped sink", ok.totalWritten(), broken.totalWritten())
+	}
+	if err := mw.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !broken.aborted || broken.closed {
+		t.Fatal("dropped sink was published instead of aborted")
+	}
+
+	only, err := NewMultiWriter(Sink{Name: "broken", Writer: &failingWriter{err: errors.New("disk full")}, Policy: BestEffort})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := only.Write(rotationBooks(1)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := only.Validate(); err == nil {
+		t.Fatal("expected Validate to fail once every sink has been dropped")
+	}
+}
+
+func TestMultiWriter_Quarantine(t *testing.T) {
+	dir := t.TempDir()
+	broken := &failingWriter{err: errors.New("disk full")}
+	mw, err := NewMultiWriter(Sink{Name: filepath.Join(dir, "books.csv.gz"), Writer: broken, Policy: Quarantine})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := mw.Write(rotationBooks(2)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	broken.err = nil
+	if err := mw.Write(rotationBooks(1)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := mw.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	quarantined, err := ReadAll(filepath.Join(dir, "books.quarantine.jsonl"))
+	if err != nil || len(quarantined) != 2 {
+		t.Fatalf("quarantine holds %d records (err %v), want the 2 of the failed batch", len(quarantined), err)
+	}
+	if broken.totalWritten() != 1 {
+		t.Fatalf("sink got %d records after recovering, want 1", broken.totalWritten())
+	}
+}
+
+func TestMultiWriter_QuarantineKeepsBatchesOfALostSink(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.csv")
+	csvSink, err := NewCSVWriter(path)
+	if err != nil {
+		t.Fatalf("new csv writer: %v", err)
+	}
+	mw, err := NewMultiWriter(
+		Sink{Name: "ok", Writer: &mockWriter{}},
+		Sink{Name: path, Writer: csvSink, Policy: Quarantine},
+	)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+
+	books := rotationBooks(6)
+	if err := mw.Write(books[:2]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// The disk goes away: the second batch fails and the CSV writer removes
+	// its temp file, taking the first batch with it.
+	_ = csvSink.file.Close()
+	for _, batch := range [][]*models.Book{books[2:4], books[4:]} {
+		if err := mw.Write(batch); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := mw.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	kept := make(map[string]bool)
+	if written, err := ReadAll(path); err == nil {
+		for _, b := range written {
+			kept[b.URL] = true
+		}
+	}
+	quarantined, err := ReadAll(filepath.Join(dir, "books.quarantine.jsonl"))
+	if err != nil {
+		t.Fatalf("read quarantine: %v", err)
+	}
+	for _, b := range quarantined {
+		kept[b.URL] = true
+	}
+	for _, b := range books {
+		if !kept[b.URL] {
+			t.Errorf("record %s is in neither the output nor the quarantine file", b.URL)
+		}
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*")); len(leftovers) != 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+}
+
+func TestMultiWriter_Abort(t *testing.T) {
+	dir := t.TempDir()
+	csvPath, xlsxPath := filepath.Join(dir, "books.csv"), filepath.Join(dir, "books.xlsx")
+	csvSink, err := NewCSVWriter(csvPath)
+	if err != nil {
+		t.Fatalf("csv writer: %v", err)
+	}
+	xlsxSink, err := NewXLSXWriter(xlsxPath)
+	if err != nil {
+		t.Fatalf("xlsx writer: %v", err)
+	}
+	plain := &mockWriter{}
+	mw, err := NewMultiWriter(
+		Sink{Name: csvPath, Writer: csvSink, Policy: Quarantine},
+		Sink{Name: xlsxPath, Writer: xlsxSink},
+		Sink{Name: "plain", Writer: plain},
+	)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := mw.Write(rotationBooks(3)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if err := Abort(mw); err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+	if !plain.closed {
+		t.Error("sink without Abort was not closed")
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*")); len(entries) != 0 {
+		t.Errorf("files left behind: %v", entries)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*")); len(leftovers) != 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+}
+
+func TestNewMultiWriter_Errors(t *testing.T) {
+	if _, err := NewMultiWriter(); err == nil {
+		t.Fatal("expected an error without sinks")
+	}
+	if _, err := NewMultiWriter(Sink{Name: "x", Writer: &mockWriter{}, Policy: "retry"}); err == nil {
+		t.Fatal("expected an error for an unknown policy")
+	}
+}
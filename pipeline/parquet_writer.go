@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// parquetRowGroupRows caps the rows buffered in memory before a row group is
+// written, so large crawls do not hold the whole file.
+const parquetRowGroupRows = 64 * 1024
+
+// ParquetWriter writes a Snappy-compressed Parquet file with the ArrowSchema
+// of its fields, stored in the file metadata so readers get the same Arrow
+// types back. Batches are buffered into row groups of up to
+// parquetRowGroupRows rows rather than one row group per Write. Like the
+// other writers it buffers the file in a temp file renamed onto the final
+// path by Close.
+type ParquetWriter struct {
+	*atomicFile
+	writer   *pqarrow.FileWriter
+	builder  *array.RecordBuilder
+	fields   []models.Field
+	finished bool // footer written by Validate; no more writes
+	mu       sync.Mutex
+}
+
+// NewParquetWriter initialises the Parquet writer using a temp file in the
+// same directory as filename. The columns are fields, in order, or every
+// field of models.BookFields.
+func NewParquetWriter(filename string, fields ...models.Field) (*ParquetWriter, error) {
+	af, err := createAtomicFile(filename, "parquet")
+	if err != nil {
+		return nil, err
+	}
+	fields = outputFields(fields)
+	schema := ArrowSchema(fields...)
+	writer, err := pqarrow.NewFileWriter(schema, af,
+		parquet.NewWriterProperties(
+			parquet.WithCompression(compress.Codecs.Snappy),
+			parquet.WithMaxRowGroupLength(parquetRowGroupRows),
+		),
+		pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()),
+	)
+	if err != nil {
+		af.abort()
+		return nil, fmt.Errorf("create parquet writer: %w", err)
+	}
+	return &ParquetWriter{
+		atomicFile: af,
+		writer:     writer,
+		builder:    array.NewRecordBuilder(memory.DefaultAllocator, schema),
+		fields:     fields,
+	}, nil
+}
+
+// Write appends books to the current row group.
+func (pw *ParquetWriter) Write(books []*models.Book) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.finished {
+		return errors.New("write parquet file: file already finished by Validate")
+	}
+	if len(books) == 0 {
+		return nil
+	}
+
+	batch := newRecordBatch(pw.builder, pw.fields, books)
+	defer batch.Release()
+	if err := pw.writer.WriteBuffered(batch); err != nil {
+		return fmt.Errorf("write parquet rows: %w", err)
+	}
+	return nil
+}
+
+// finish writes the last row group and the footer.
+func (pw *ParquetWriter) finish() error {
+	if pw.finished {
+		return nil
+	}
+	pw.finished = true
+	pw.builder.Release()
+	if err := pw.writer.Close(); err != nil {
+		return fmt.Errorf("finish parquet file: %w", err)
+	}
+	return nil
+}
+
+// Close finishes the file, closes the temp file, and atomically renames it
+// onto the final path. On any error the temp file is removed (best-effort)
+// and the final path is left untouched.
+func (pw *ParquetWriter) Close() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if err := pw.finish(); err != nil {
+		pw.abort()
+		return err
+	}
+	return pw.commit()
+}
+
+// Abort discards the file, leaving the final path untouched.
+func (pw *ParquetWriter) Abort() {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if !pw.finished {
+		pw.finished = true
+		pw.builder.Release()
+	}
+	pw.abort()
+}
+
+// Validate finishes the file and ensures the temp file has data, so it must
+// come after the last Write.
+func (pw *ParquetWriter) Validate() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if err := pw.finish(); err != nil {
+		return err
+	}
+	return pw.validate()
+}
+
+// NewParquetReader opens a Parquet file, such as ParquetWriter writes, and
+// reads it as Arrow record batches. Parquet needs random access to read its
+// footer, so a compressed file is decompressed into memory first.
+func NewParquetReader(filename string) (*ArrowReader, error) {
+	var input parquet.ReaderAtSeeker
+	if CompressionForPath(filename) == CompressionNone {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("open parquet file: %w", err)
+		}
+		input = f
+	} else {
+		in, err := openInput(filename)
+		if err != nil {
+			return nil, fmt.Errorf("open parquet file: %w", err)
+		}
+		data, err := io.ReadAll(in)
+		_ = in.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decompress parquet file: %w", err)
+		}
+		input = bytes.NewReader(data)
+	}
+
+	pf, err := file.NewParquetReader(input)
+	if err != nil {
+		if c, ok := input.(io.Closer); ok {
+			_ = c.Close()
+		}
+		return nil, fmt.Errorf("read parquet footer: %w", err)
+	}
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 1024}, memory.DefaultAllocator)
+	if err != nil {
+		_ = pf.Close()
+		return nil, fmt.Errorf("read parquet schema: %w", err)
+	}
+	reader, err := fr.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		_ = pf.Close()
+		return nil, fmt.Errorf("read parquet row groups: %w", err)
+	}
+	return newRecordBatchReader(pf, reader), nil
+}
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/parquet/file"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+func TestParquetWriter_RowGroups(t *testing.T) {
+	fields, err := models.SelectFields([]string{"url", "title", "price_numeric"}, nil)
+	if err != nil {
+		t.Fatalf("select fields: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "books.parquet")
+	writer, err := NewParquetWriter(path, fields...)
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	// Small batches are buffered into one row group, not one each.
+	for i := range 3 {
+		book := &models.Book{URL: "http://example.test/" + string(rune('a'+i)), Title: "Book", PriceNumeric: float64(i)}
+		if err := writer.Write([]*models.Book{book}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := writer.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := writer.Write(nil); err == nil {
+		t.Error("write after validate succeeded, want an error")
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf, err := file.NewParquetReader(f)
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	defer func() { _ = pf.Close() }()
+	if got := pf.NumRowGroups(); got != 1 {
+		t.Errorf("row groups = %d, want 1", got)
+	}
+	if got := pf.NumRows(); got != 3 {
+		t.Errorf("rows = %d, want 3", got)
+	}
+	if got := pf.MetaData().Schema.NumColumns(); got != len(fields) {
+		t.Errorf("columns = %d, want %d", got, len(fields))
+	}
+
+	books, err := ReadAll(path)
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if len(books) != 3 || books[2].PriceNumeric != 2 || books[2].URL != "http://example.test/c" {
+		t.Errorf("read back %+v", books)
+	}
+}
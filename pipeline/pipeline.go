@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -12,16 +14,29 @@ import (
 	"github.com/aluiziolira/go-scrape-books/models"
 	"github.com/aluiziolira/go-scrape-books/parser"
 	lru "github.com/hashicorp/golang-lru/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	// ErrPipelineClosed is returned when Process is called after shutdown.
 	ErrPipelineClosed       = errors.New("pipeline: closed")
 	ErrPipelineCloseTimeout = errors.New("pipeline: close timeout")
+	// ErrWriteBatch wraps the error of an OutputWriter that failed to write
+	// a batch, telling writer failures apart from other pipeline errors.
+	ErrWriteBatch = errors.New("pipeline: write batch")
 
 	drainTimeout = 30 * time.Second
 )
 
+// tracer returns the pipeline's tracer from the global tracer provider, which
+// is a no-op unless tracing has been configured.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/aluiziolira/go-scrape-books/pipeline")
+}
+
 // OutputWriter defines the interface for data output.
 type OutputWriter interface {
 	Write(books []*models.Book) error
@@ -29,6 +44,88 @@ type OutputWriter interface {
 	Validate() error
 }
 
+// RunSummary describes a finished crawl.
+type RunSummary struct {
+	Result *models.ScraperResult
+	Stats  PipelineStats
+}
+
+// Summarizer is implemented by writers that report the run alongside its
+// records, like the summary sheet of XLSXWriter. SetSummary must come before
+// Validate.
+type Summarizer interface {
+	SetSummary(s RunSummary)
+}
+
+// summaryMetric is one line of a RunSummary as reports show it.
+type summaryMetric struct {
+	Name  string
+	Value any // an int, int64, float64 or time.Time
+}
+
+// metrics lists the counts of the run, in the order reports show them.
+func (s RunSummary) metrics() []summaryMetric {
+	var metrics []summaryMetric
+	if r := s.Result; r != nil {
+		metrics = append(metrics,
+			summaryMetric{"Started", r.StartTime.UTC()},
+			summaryMetric{"Finished", r.EndTime.UTC()},
+			summaryMetric{"Duration (s)", r.EndTime.Sub(r.StartTime).Seconds()},
+			summaryMetric{"Pages", r.PageCount},
+			summaryMetric{"Requests", r.RequestCount},
+			summaryMetric{"Errors", r.ErrorCount},
+			summaryMetric{"Retries", r.RetryCount},
+			summaryMetric{"Failed URLs", len(r.FailedURLs)},
+		)
+	}
+	metrics = append(metrics, summaryMetric{"Books written", s.Stats.Processed})
+	for _, kind := range slices.Sorted(maps.Keys(s.Stats.ValidationErrors)) {
+		metrics = append(metrics, summaryMetric{"Rejected: " + kind, s.Stats.ValidationErrors[kind]})
+	}
+	return metrics
+}
+
+// siteSummary is the result of one site of the run.
+type siteSummary struct {
+	Name string
+	models.DomainResult
+}
+
+// sites lists the result of every site of the run, by name.
+func (s RunSummary) sites() []siteSummary {
+	if s.Result == nil {
+		return nil
+	}
+	sites := make([]siteSummary, 0, len(s.Result.Domains))
+	for _, name := range slices.Sorted(maps.Keys(s.Result.Domains)) {
+		sites = append(sites, siteSummary{name, s.Result.Domains[name]})
+	}
+	return sites
+}
+
+// Aborter is an OutputWriter that can discard its output instead of
+// publishing it, leaving the final path untouched. Abort must not race Write.
+type Aborter interface {
+	Abort()
+}
+
+// Abort discards the output of writer if it is an Aborter and closes it
+// otherwise.
+func Abort(writer OutputWriter) error {
+	if aw, ok := writer.(Aborter); ok {
+		aw.Abort()
+		return nil
+	}
+	return writer.Close()
+}
+
+// SetSummary hands s to writer if it is a Summarizer.
+func SetSummary(writer OutputWriter, s RunSummary) {
+	if sw, ok := writer.(Summarizer); ok {
+		sw.SetSummary(s)
+	}
+}
+
 // Pipeline coordinates validation, de-duplication, and output writing.
 type Pipeline struct {
 	ctx context.Context
@@ -44,7 +141,8 @@ type Pipeline struct {
 	dedupeMaxSize int
 	dedupeWarned  bool
 
-	metrics metrics
+	metrics    metrics
+	collectors *Collectors
 
 	mu     sync.Mutex // guards closed/err
 	closed bool
@@ -57,6 +155,12 @@ type Pipeline struct {
 
 // NewPipeline builds a pipeline with a modest in-memory buffer.
 func NewPipeline(ctx context.Context, writer OutputWriter, cfg *config.Config) *Pipeline {
+	return NewPipelineWithCollectors(ctx, writer, cfg, nil)
+}
+
+// NewPipelineWithCollectors builds a pipeline that also records into the
+// given Prometheus collectors, which may be shared with other pipelines.
+func NewPipelineWithCollectors(ctx context.Context, writer OutputWriter, cfg *config.Config, collectors *Collectors) *Pipeline {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -88,6 +192,7 @@ func NewPipeline(ctx context.Context, writer OutputWriter, cfg *config.Config) *
 		seen:          seen,
 		dedupeMaxSize: dedupeMaxSize,
 		metrics:       newMetrics(),
+		collectors:    collectors,
 		shutdown:      make(chan struct{}),
 	}
 }
@@ -105,14 +210,28 @@ func (p *Pipeline) Start(workers int) {
 	}
 	p.mu.Unlock()
 
+	p.collectors.attach(p)
 	for i := 0; i < workers; i++ {
 		p.wg.Add(1)
 		go p.worker()
 	}
+	if p.collectors != nil {
+		go func() {
+			p.wg.Wait()
+			p.collectors.detach(p)
+		}()
+	}
 }
 
 // Process enqueues books for downstream processing.
 func (p *Pipeline) Process(books ...*models.Book) error {
+	return p.ProcessContext(p.ctx, books...)
+}
+
+// ProcessContext is Process with the time spent waiting for room in the
+// queue traced as a child of ctx. Cancellation still follows the pipeline's
+// own context.
+func (p *Pipeline) ProcessContext(ctx context.Context, books ...*models.Book) error {
 	if len(books) == 0 {
 		return nil
 	}
@@ -129,7 +248,7 @@ func (p *Pipeline) Process(books ...*models.Book) error {
 		if book == nil {
 			continue
 		}
-		if err := p.enqueue(book); err != nil {
+		if err := p.enqueue(ctx, book); err != nil {
 			return err
 		}
 	}
@@ -176,6 +295,12 @@ func (p *Pipeline) GetMetrics() PipelineStats {
 	return p.metrics.snapshot()
 }
 
+// QueueFill returns how many books are buffered between Process and the
+// workers, and how many the buffer holds.
+func (p *Pipeline) QueueFill() (depth, capacity int) {
+	return len(p.bookCh), cap(p.bookCh)
+}
+
 // StartMetricsReporting emits periodic progress logs.
 func (p *Pipeline) StartMetricsReporting(interval time.Duration) {
 	if interval <= 0 {
@@ -207,56 +332,83 @@ func (p *Pipeline) worker() {
 	defer p.wg.Done()
 
 	batch := make([]*models.Book, 0, p.batchSize)
+	// prepareSpan covers a batch from its first record until it is flushed.
+	var prepareSpan trace.Span
+	rejected := 0
 	flush := func() error {
+		if prepareSpan != nil {
+			prepareSpan.SetAttributes(
+				attribute.Int("pipeline.batch.records", len(batch)),
+				attribute.Int("pipeline.batch.rejected", rejected),
+			)
+			prepareSpan.End()
+			prepareSpan, rejected = nil, 0
+		}
 		if len(batch) == 0 {
 			return nil
 		}
+		_, span := tracer().Start(p.ctx, "pipeline.flush", trace.WithAttributes(attribute.Int("pipeline.batch.records", len(batch))))
+		defer span.End()
+		start := time.Now()
 		if err := p.writer.Write(batch); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 			return err
 		}
+		p.collectors.observeFlush(len(batch), time.Since(start))
 		batch = batch[:0]
 		return nil
 	}
+	// finalFlush writes the last partial batch on shutdown, counting it as
+	// busy time like any other flush.
+	finalFlush := func() {
+		busy := time.Now()
+		if err := flush(); err != nil {
+			p.setErr(fmt.Errorf("%w: %w", ErrWriteBatch, err))
+		}
+		p.collectors.addBusy(time.Since(busy))
+	}
 
 	for {
 		select {
 		case <-p.ctx.Done():
-			if err := flush(); err != nil {
-				p.setErr(fmt.Errorf("write batch: %w", err))
-			}
+			finalFlush()
 			return
 		case book, ok := <-p.bookCh:
 			if !ok {
-				if err := flush(); err != nil {
-					p.setErr(fmt.Errorf("write batch: %w", err))
-				}
+				finalFlush()
 				return
 			}
-			prepared := p.prepare(book)
-			if prepared == nil {
-				continue
+			busy := time.Now()
+			if prepareSpan == nil {
+				_, prepareSpan = tracer().Start(p.ctx, "pipeline.prepare")
+			}
+			if prepared := p.prepare(book); prepared != nil {
+				batch = append(batch, prepared)
+			} else {
+				rejected++
 			}
-			batch = append(batch, prepared)
 			if len(batch) >= p.batchSize {
 				if err := flush(); err != nil {
-					p.setErr(fmt.Errorf("write batch: %w", err))
+					p.setErr(fmt.Errorf("%w: %w", ErrWriteBatch, err))
 					return
 				}
 			}
+			p.collectors.addBusy(time.Since(busy))
 		}
 	}
 }
 
 func (p *Pipeline) prepare(book *models.Book) *models.Book {
 	if err := parser.ValidateBook(book); err != nil {
-		p.metrics.addValidation("invalid_record")
+		p.addValidation("invalid_record")
 		return nil
 	}
 
 	p.seenMu.Lock()
 	if _, ok := p.seen.Get(book.URL); ok {
 		p.seenMu.Unlock()
-		p.metrics.addValidation("duplicate_url")
+		p.addValidation("duplicate_url")
 		return nil
 	}
 	evicted := p.seen.Add(book.URL, struct{}{})
@@ -266,25 +418,55 @@ func (p *Pipeline) prepare(book *models.Book) *models.Book {
 	}
 	p.seenMu.Unlock()
 
+	if err := NormalizeBook(book); err != nil {
+		p.addValidation("unparseable_price")
+	}
+
+	p.metrics.incrementProcessed()
+	p.collectors.incProcessed()
+	return book
+}
+
+// NormalizeBook normalizes book in place as the pipeline does before writing
+// it: the price loses its currency symbol and sets PriceNumeric, availability
+// is trimmed and the rating text sets RatingNumeric. Empty price and rating
+// texts, as in outputs without those columns, are left alone. An unparseable
+// price is returned as an error, with the rest of book still normalized.
+func NormalizeBook(book *models.Book) error {
+	book.Availability = parser.NormalizeAvailability(book.Availability)
+	if book.RatingText != "" {
+		book.RatingNumeric = parser.RatingToNumeric(book.RatingText)
+	}
+	if book.Price == "" {
+		return nil
+	}
 	book.Price = parser.NormalizePrice(book.Price)
 	priceNumeric, err := parser.ParsePrice(book.Price)
 	if err != nil {
-		p.metrics.addValidation("unparseable_price")
-	} else {
-		book.PriceNumeric = priceNumeric
+		return fmt.Errorf("unparseable price %q: %w", book.Price, err)
 	}
-	book.Availability = parser.NormalizeAvailability(book.Availability)
-	book.RatingNumeric = parser.RatingToNumeric(book.RatingText)
+	book.PriceNumeric = priceNumeric
+	return nil
+}
 
-	p.metrics.incrementProcessed()
-	return book
+func (p *Pipeline) addValidation(kind string) {
+	p.metrics.addValidation(kind)
+	p.collectors.addValidation(kind)
 }
 
-func (p *Pipeline) enqueue(book *models.Book) (err error) {
+func (p *Pipeline) enqueue(ctx context.Context, book *models.Book) (err error) {
+	_, span := tracer().Start(ctx, "pipeline.enqueue", trace.WithAttributes(
+		attribute.String("url.full", book.URL),
+		attribute.Int("pipeline.queue.depth", len(p.bookCh)),
+	))
 	defer func() {
 		if r := recover(); r != nil {
 			err = ErrPipelineClosed
 		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
 	}()
 
 	select {
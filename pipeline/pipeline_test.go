@@ -3,6 +3,7 @@ package pipeline
 import (
 	"context"
 	"errors"
+	"slices"
 	"strconv"
 	"sync"
 	"testing"
@@ -10,6 +11,11 @@ import (
 
 	"github.com/aluiziolira/go-scrape-books/config"
 	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type mockWriter struct {
@@ -129,6 +135,27 @@ func TestPipelineProcessValidationAndDedup(t *testing.T) {
 	}
 }
 
+func TestNormalizeBook(t *testing.T) {
+	book := &models.Book{Price: " £1,234.50 ", RatingText: "Four", Availability: "  In stock \n"}
+	if err := NormalizeBook(book); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if book.Price != "1,234.50" || book.PriceNumeric != 1234.5 || book.RatingNumeric != 4 || book.Availability != "In stock" {
+		t.Errorf("normalized book = %+v", book)
+	}
+
+	// Outputs without price or rating text columns keep their numeric values.
+	partial := &models.Book{PriceNumeric: 3, RatingNumeric: 2}
+	if err := NormalizeBook(partial); err != nil || partial.PriceNumeric != 3 || partial.RatingNumeric != 2 {
+		t.Errorf("partial book = %+v, err = %v", partial, err)
+	}
+
+	bad := &models.Book{Price: "free", RatingText: "One"}
+	if err := NormalizeBook(bad); err == nil || bad.RatingNumeric != 1 {
+		t.Errorf("unparseable price: book = %+v, err = %v", bad, err)
+	}
+}
+
 func TestPipelineBatchFlushThreshold(t *testing.T) {
 	cfg := config.DefaultConfig()
 	cfg.BatchSize = 64
@@ -223,3 +250,177 @@ func TestPipelineCloseTimeout(t *testing.T) {
 		t.Fatalf("expected close timeout error, got %v", err)
 	}
 }
+
+func TestPipelineCollectors(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.BatchSize = 1
+	cfg.PipelineBufferSize = 4
+	reg := prometheus.NewRegistry()
+	collectors := NewCollectors(reg)
+
+	writer := &blockingWriter{blockCh: make(chan struct{})}
+	p := NewPipelineWithCollectors(context.Background(), writer, cfg, collectors)
+	p.Start(1)
+
+	book := func(i int) *models.Book {
+		return &models.Book{
+			Title:        "Book",
+			Price:        "12.00",
+			RatingText:   "Three",
+			Availability: "In stock",
+			URL:          "http://example.test/book/" + strconv.Itoa(i),
+			ScrapedAt:    time.Now(),
+		}
+	}
+	if err := p.Process(book(1), book(2), book(3), book(3), &models.Book{URL: "http://example.test/bad"}); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	// The worker blocks writing the first book, so the rest back up.
+	waitForGauge(t, reg, "pipeline_queue_depth", 4)
+	waitForGauge(t, reg, "pipeline_queue_capacity", 4)
+
+	close(writer.blockCh)
+	if err := p.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if got := gatherMetric(t, reg, "pipeline_records_processed_total", "").GetCounter().GetValue(); got != 3 {
+		t.Fatalf("processed = %v, want 3", got)
+	}
+	if got := gatherMetric(t, reg, "pipeline_records_rejected_total", "duplicate_url").GetCounter().GetValue(); got != 1 {
+		t.Fatalf("rejected duplicate_url = %v, want 1", got)
+	}
+	if got := gatherMetric(t, reg, "pipeline_records_rejected_total", "invalid_record").GetCounter().GetValue(); got != 1 {
+		t.Fatalf("rejected invalid_record = %v, want 1", got)
+	}
+	h := gatherMetric(t, reg, "pipeline_batch_size", "").GetHistogram()
+	if h.GetSampleCount() != 3 || h.GetSampleSum() != 3 || h.GetBucket()[0].GetUpperBound() != 1 || h.GetBucket()[0].GetCumulativeCount() != 3 {
+		t.Fatalf("batch size histogram = %v, want 3 batches of 1", h)
+	}
+	if gatherMetric(t, reg, "pipeline_worker_busy_seconds_total", "").GetCounter().GetValue() <= 0 {
+		t.Fatal("expected worker busy time to be recorded")
+	}
+	waitForGauge(t, reg, "pipeline_queue_capacity", 0)
+}
+
+// slowWriter is a mockWriter that takes delay to write each batch.
+type slowWriter struct {
+	mockWriter
+	delay time.Duration
+}
+
+func (sw *slowWriter) Write(books []*models.Book) error {
+	time.Sleep(sw.delay)
+	return sw.mockWriter.Write(books)
+}
+
+func TestPipelineCollectors_FinalFlushIsBusyTime(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.BatchSize = 100
+	reg := prometheus.NewRegistry()
+	p := NewPipelineWithCollectors(context.Background(), &slowWriter{delay: 50 * time.Millisecond}, cfg, NewCollectors(reg))
+	p.Start(1)
+	book := &models.Book{Title: "Book", Price: "12.00", RatingText: "Three", Availability: "In stock", URL: "http://example.test/book/1", ScrapedAt: time.Now()}
+	if err := p.Process(book); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	// The only batch is flushed on shutdown, so its write is the busy time.
+	if got := gatherMetric(t, reg, "pipeline_worker_busy_seconds_total", "").GetCounter().GetValue(); got < 0.05 {
+		t.Fatalf("worker busy = %vs, want at least the 0.05s final flush", got)
+	}
+}
+
+// gatherMetric gathers reg and returns the named metric, the one with a label
+// set to label when label is not empty, or nil when there is none.
+func gatherMetric(t *testing.T, reg *prometheus.Registry, name, label string) *dto.Metric {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if label == "" || slices.ContainsFunc(m.GetLabel(), func(l *dto.LabelPair) bool { return l.GetValue() == label }) {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// waitForGauge polls reg until the named unlabelled gauge reaches want.
+func waitForGauge(t *testing.T, reg *prometheus.Registry, name string, want float64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := gatherMetric(t, reg, name, "").GetGauge().GetValue()
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %v, want %v", name, got, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPipelineTracesBatches(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	cfg := config.DefaultConfig()
+	cfg.BatchSize = 2
+	p := NewPipeline(context.Background(), &mockWriter{}, cfg)
+	p.Start(1)
+	for i := 0; i < 3; i++ {
+		book := &models.Book{
+			Title:        "Book",
+			Price:        "12.00",
+			RatingText:   "Three",
+			Availability: "In stock",
+			URL:          "http://example.test/book/" + strconv.Itoa(i),
+			ScrapedAt:    time.Now(),
+		}
+		if err := p.Process(book); err != nil {
+			t.Fatalf("process: %v", err)
+		}
+	}
+	if err := p.Process(&models.Book{URL: "http://example.test/invalid"}); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	counts := map[string]int{}
+	var records, rejected int64
+	for _, span := range recorder.Ended() {
+		counts[span.Name()]++
+		if span.Name() != "pipeline.prepare" {
+			continue
+		}
+		for _, kv := range span.Attributes() {
+			switch kv.Key {
+			case "pipeline.batch.records":
+				records += kv.Value.AsInt64()
+			case "pipeline.batch.rejected":
+				rejected += kv.Value.AsInt64()
+			}
+		}
+	}
+	if counts["pipeline.enqueue"] != 4 || counts["pipeline.prepare"] != 2 || counts["pipeline.flush"] != 2 {
+		t.Fatalf("span counts = %v, want 4 enqueue, 2 prepare, 2 flush", counts)
+	}
+	if records != 3 || rejected != 1 {
+		t.Fatalf("prepared records = %d rejected = %d, want 3 and 1", records, rejected)
+	}
+}
@@ -0,0 +1,206 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PublishManifestName is the manifest Publish writes into every published
+// run directory.
+const PublishManifestName = "_manifest.json"
+
+// Publisher coordinates the outputs of a run so they are published together:
+// every output is written into a staging directory of its own, and Publish
+// fsyncs them, writes a manifest, and atomically repoints a symlink at the
+// directory. A reader going through the link therefore never sees a CSV from
+// one run beside a JSON from another.
+//
+// For outputs configured in output/latest, output/latest is the link and
+// runs are staged in output/.latest.runs/<run>/.
+type Publisher struct {
+	link string // the published directory, a symlink to the current run
+	runs string // where the staged runs live
+	dir  string // this run's staging directory
+	keep int
+}
+
+// NewPublisher stages a new run for link, keeping the newest keep staged
+// runs (at least 2: the current one and the one before it, which readers may
+// still have open) when pruning. link must be a symlink, an empty directory
+// or not exist yet.
+func NewPublisher(link string, keep int) (*Publisher, error) {
+	link = filepath.Clean(link)
+	if info, err := os.Lstat(link); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		if !info.IsDir() || os.Remove(link) != nil {
+			return nil, fmt.Errorf("publish directory %s exists and is not a symlink; give the outputs a directory of their own", link)
+		}
+	}
+	runs := filepath.Join(filepath.Dir(link), "."+filepath.Base(link)+".runs")
+	if err := os.MkdirAll(runs, 0o755); err != nil {
+		return nil, fmt.Errorf("create run directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(runs, time.Now().UTC().Format("20060102-150405.000000000-"))
+	if err != nil {
+		return nil, fmt.Errorf("create run directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0o755); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("create run directory: %w", err)
+	}
+	return &Publisher{link: link, runs: runs, dir: dir, keep: max(keep, 2)}, nil
+}
+
+// Path returns where to stage the output that is published as path, which
+// must be in the published directory.
+func (p *Publisher) Path(path string) string {
+	return filepath.Join(p.dir, filepath.Base(path))
+}
+
+// Dir returns the staging directory of the run.
+func (p *Publisher) Dir() string {
+	return p.dir
+}
+
+// PublishManifest lists the files of a published run.
+type PublishManifest struct {
+	Run         string          `json:"run"`
+	PublishedAt time.Time       `json:"published_at"`
+	Files       []PublishedFile `json:"files"`
+}
+
+// PublishedFile is one file of a published run, relative to its directory.
+type PublishedFile struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// Publish makes the staged run the current one. Every staged file and the
+// manifest are fsynced before the link is swapped, so a crash leaves either
+// the previous run or this one published, never a mix.
+func (p *Publisher) Publish() error {
+	if err := p.writeManifest(); err != nil {
+		return err
+	}
+	if err := p.swapLink(); err != nil {
+		return fmt.Errorf("publish %s: %w", p.link, err)
+	}
+	return p.prune()
+}
+
+// writeManifest fsyncs every staged file and lists them in the manifest.
+func (p *Publisher) writeManifest() error {
+	m := PublishManifest{Run: filepath.Base(p.dir), PublishedAt: time.Now().UTC(), Files: []PublishedFile{}}
+	err := filepath.WalkDir(p.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		if err := syncPath(path); err != nil {
+			return err
+		}
+		size, sum, err := checksumFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(p.dir, path)
+		m.Files = append(m.Files, PublishedFile{Path: filepath.ToSlash(rel), Bytes: size, SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("stage outputs: %w", err)
+	}
+	if len(m.Files) == 0 {
+		return errors.New("nothing to publish")
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode publish manifest: %w", err)
+	}
+	manifest := filepath.Join(p.dir, PublishManifestName)
+	if err := os.WriteFile(manifest, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write publish manifest: %w", err)
+	}
+	if err := syncPath(manifest); err != nil {
+		return err
+	}
+	return syncPath(p.dir)
+}
+
+// swapLink atomically points the link at the staged run: a new symlink is
+// created beside it and renamed over it.
+func (p *Publisher) swapLink() error {
+	target, err := filepath.Rel(filepath.Dir(p.link), p.dir)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(p.link), "."+filepath.Base(p.link)+".link.tmp")
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p.link); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncPath(filepath.Dir(p.link))
+}
+
+// Abandon leaves the run unpublished. Its staged outputs stay where they
+// are for inspection until a later Publish prunes them.
+func (p *Publisher) Abandon() {
+	slog.Warn("outputs not published, they stay staged", slog.String("run", p.dir))
+}
+
+// prune keeps the newest keep published runs, the current one included, and
+// removes older runs. Unpublished runs newer than the oldest kept one may
+// still be in progress, or be recent failures worth inspecting, and stay.
+func (p *Publisher) prune() error {
+	entries, err := os.ReadDir(p.runs)
+	if err != nil {
+		return fmt.Errorf("prune runs: %w", err)
+	}
+	// Run directories are named after their UTC start time, so name order is
+	// age order.
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	published := 0
+	for _, name := range names {
+		dir := filepath.Join(p.runs, name)
+		if published >= p.keep {
+			if err := os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("prune runs: %w", err)
+			}
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, PublishManifestName)); err == nil {
+			published++
+		}
+	}
+	return nil
+}
+
+// syncPath fsyncs the file or directory at path.
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("sync %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// stageRun stages a run writing content to books.csv and books.json.
+func stageRun(t *testing.T, link, content string) *Publisher {
+	t.Helper()
+	pub, err := NewPublisher(link, 2)
+	if err != nil {
+		t.Fatalf("new publisher: %v", err)
+	}
+	for _, name := range []string{"books.csv", "books.json"} {
+		if err := os.WriteFile(pub.Path(filepath.Join(link, name)), []byte(content), 0o644); err != nil {
+			t.Fatalf("stage %s: %v", name, err)
+		}
+	}
+	return pub
+}
+
+func readPublished(t *testing.T, link string) string {
+	t.Helper()
+	csv, err := os.ReadFile(filepath.Join(link, "books.csv"))
+	if err != nil {
+		t.Fatalf("read published csv: %v", err)
+	}
+	json, err := os.ReadFile(filepath.Join(link, "books.json"))
+	if err != nil {
+		t.Fatalf("read published json: %v", err)
+	}
+	if string(csv) != string(json) {
+		t.Fatalf("published csv %q and json %q come from different runs", csv, json)
+	}
+	return string(csv)
+}
+
+func TestPublisher_PublishesRunsTogether(t *testing.T) {
+	root := t.TempDir()
+	link := filepath.Join(root, "latest")
+
+	first := stageRun(t, link, "run 1")
+	if _, err := os.Stat(filepath.Join(link, "books.csv")); !os.IsNotExist(err) {
+		t.Fatalf("staged output visible before Publish: %v", err)
+	}
+	if err := first.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got := readPublished(t, link); got != "run 1" {
+		t.Fatalf("published %q, want run 1", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(link, PublishManifestName))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var m PublishManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	if m.Run != filepath.Base(first.Dir()) || len(m.Files) != 2 || m.Files[0].Path != "books.csv" || m.Files[0].Bytes != 5 || m.Files[0].SHA256 == "" {
+		t.Fatalf("manifest = %+v", m)
+	}
+
+	second := stageRun(t, link, "run 2")
+	failed := stageRun(t, link, "run 3")
+	failed.Abandon()
+	if got := readPublished(t, link); got != "run 1" {
+		t.Fatalf("published %q after an abandoned run, want run 1", got)
+	}
+	if err := second.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got := readPublished(t, link); got != "run 2" {
+		t.Fatalf("published %q, want run 2", got)
+	}
+
+	// The two newest published runs are kept, and so is the abandoned run,
+	// which is newer than both.
+	third := stageRun(t, link, "run 4")
+	if err := third.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	runs, err := os.ReadDir(filepath.Join(root, ".latest.runs"))
+	if err != nil {
+		t.Fatalf("read runs: %v", err)
+	}
+	var names []string
+	for _, e := range runs {
+		names = append(names, e.Name())
+	}
+	want := []string{filepath.Base(second.Dir()), filepath.Base(failed.Dir()), filepath.Base(third.Dir())}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("staged runs = %v, want %v", names, want)
+	}
+}
+
+func TestNewPublisher_ExistingDirectory(t *testing.T) {
+	root := t.TempDir()
+	empty := filepath.Join(root, "empty")
+	if err := os.Mkdir(empty, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := stageRun(t, empty, "run 1").Publish(); err != nil {
+		t.Fatalf("publishing over an empty directory: %v", err)
+	}
+
+	full := filepath.Join(root, "full")
+	if err := os.MkdirAll(full, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(full, "keep.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := NewPublisher(full, 2); err == nil {
+		t.Fatal("expected an error for a directory with files in it")
+	}
+}
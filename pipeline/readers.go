@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// BookReader reads back the records of an output file. Read returns io.EOF
+// once every record has been returned.
+type BookReader interface {
+	Read() (*models.Book, error)
+	Close() error
+}
+
+// ErrNoReader is returned by OpenReader for files no writer reads back, like
+// TemplateWriter output.
+var ErrNoReader = errors.New("no reader for this file type")
+
+// OpenReader opens filename with the reader of the format its extension
+// names in Formats, such as .csv for CSVWriter output or .parquet for
+// ParquetWriter output, optionally followed by .gz or .zst for compressed
+// output.
+func OpenReader(filename string) (BookReader, error) {
+	f, ok := FormatForPath(filename)
+	if !ok || f.NewReader == nil {
+		return nil, fmt.Errorf("%w: %s: want a %s file", ErrNoReader, filename, readableExts())
+	}
+	return f.NewReader(filename)
+}
+
+// ReadAll opens filename and returns every record in it.
+func ReadAll(filename string) ([]*models.Book, error) {
+	reader, err := OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	var books []*models.Book
+	for {
+		book, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return books, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+}
+
+// CSVReader reads files written by CSVWriter. Columns are matched by header
+// name, so files from older versions with fewer columns still load.
+type CSVReader struct {
+	file    io.ReadCloser
+	reader  *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+// NewCSVReader opens filename and reads its header row.
+func NewCSVReader(filename string) (*CSVReader, error) {
+	f, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open csv file: %w", err)
+	}
+	reader := csv.NewReader(bufio.NewReader(f))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		_ = f.Close()
+		return nil, fmt.Errorf("csv file %s has no url column", filename)
+	}
+	return &CSVReader{file: f, reader: reader, columns: columns, line: 1}, nil
+}
+
+// Read returns the next record.
+func (cr *CSVReader) Read() (*models.Book, error) {
+	record, err := cr.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	cr.line++
+	if err != nil {
+		return nil, fmt.Errorf("read csv record: %w", err)
+	}
+	book := &models.Book{}
+	for _, f := range models.BookFields {
+		i, ok := cr.columns[f.Name]
+		if !ok || i >= len(record) {
+			continue
+		}
+		if err := f.SetText(book, record[i]); err != nil {
+			return nil, fmt.Errorf("csv line %d: invalid %s: %w", cr.line, f.Name, err)
+		}
+	}
+	return book, nil
+}
+
+// Close closes the underlying file and decompressor.
+func (cr *CSVReader) Close() error {
+	return cr.file.Close()
+}
+
+// JSONReader reads newline-delimited JSON files written by JSONWriter.
+type JSONReader struct {
+	file    io.ReadCloser
+	decoder *json.Decoder
+}
+
+// NewJSONReader opens filename for reading.
+func NewJSONReader(filename string) (*JSONReader, error) {
+	f, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open json file: %w", err)
+	}
+	return &JSONReader{file: f, decoder: json.NewDecoder(bufio.NewReader(f))}, nil
+}
+
+// Read returns the next record.
+func (jr *JSONReader) Read() (*models.Book, error) {
+	var book models.Book
+	if err := jr.decoder.Decode(&book); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("decode json record: %w", err)
+	}
+	return &book, nil
+}
+
+// Close closes the underlying file and decompressor.
+func (jr *JSONReader) Close() error {
+	return jr.file.Close()
+}
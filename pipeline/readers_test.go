@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+func TestReadersRoundTrip(t *testing.T) {
+	book := &models.Book{
+		Title:         "Test Book",
+		Price:         "10.00",
+		PriceNumeric:  10,
+		RatingText:    "Two",
+		RatingNumeric: 2,
+		Availability:  "In stock",
+		ImageURL:      "http://example.test/img.png",
+		URL:           "http://example.test/book",
+		ScrapedAt:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Source:        "example.test",
+		Currency:      "GBP",
+		ISBN:          "9780000000001",
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"books.csv", "books.jsonl", "books.csv.gz", "books.jsonl.zst", "books.arrow", "books.avro", "books.arrow.zst", "books.parquet", "books.parquet.gz", "books.xlsx", "books.html.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			f, ok := FormatForPath(name)
+			if !ok {
+				t.Fatalf("no format for %s", name)
+			}
+			writer, err := f.NewWriter(path)
+			if err != nil {
+				t.Fatalf("create writer: %v", err)
+			}
+			// Two batches, so the columnar formats hold two record batches,
+			// blocks or buffered writes.
+			if err := writer.Write([]*models.Book{book}); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := writer.Write([]*models.Book{book}); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := writer.Validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+
+			books, err := ReadAll(path)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if len(books) != 2 {
+				t.Fatalf("books = %d, want 2", len(books))
+			}
+			for _, got := range books {
+				if *got != *book {
+					t.Fatalf("round trip mismatch:\n got  %+v\n want %+v", *got, *book)
+				}
+			}
+		})
+	}
+}
+
+func TestCSVReaderOlderHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.csv")
+	data := "title,price,rating,url\nOld Book,£5.00,One,http://example.test/old\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	books, err := ReadAll(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(books) != 1 || books[0].Title != "Old Book" || books[0].URL != "http://example.test/old" || books[0].ISBN != "" {
+		t.Fatalf("unexpected books: %+v", books)
+	}
+
+	if _, err := OpenReader(filepath.Join(t.TempDir(), "books.xml")); err == nil {
+		t.Fatal("expected error for unsupported extension")
+	}
+}
+
+func TestFormatsAreConfigurable(t *testing.T) {
+	for _, f := range Formats {
+		cfg := config.DefaultConfig()
+		cfg.OutputFormat = f.Name
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("format %s: %v", f.Name, err)
+		}
+		if got, ok := FormatForPath("books" + f.Exts[0] + ".gz"); !ok || got.Name != f.Name {
+			t.Errorf("FormatForPath(books%s.gz) = %s, want %s", f.Exts[0], got.Name, f.Name)
+		}
+	}
+	if _, ok := LookupFormat("dual"); ok {
+		t.Error(`LookupFormat("dual") found a format, want only file formats`)
+	}
+}
@@ -0,0 +1,500 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// PartitionFields are the book fields RotatingWriter can partition by.
+var PartitionFields = []string{"rating", "source", "availability", "currency", "date"}
+
+// partitionKey returns the value of field for book, as used in shard names.
+func partitionKey(book *models.Book, field string) (string, error) {
+	switch field {
+	case "rating":
+		return strconv.Itoa(book.RatingNumeric), nil
+	case "source":
+		return book.Source, nil
+	case "availability":
+		return book.Availability, nil
+	case "currency":
+		return book.Currency, nil
+	case "date":
+		return book.ScrapedAt.UTC().Format("2006-01-02"), nil
+	default:
+		return "", fmt.Errorf("cannot partition by %q: want one of %s", field, strings.Join(PartitionFields, ", "))
+	}
+}
+
+// WriterFactory creates the OutputWriter for one shard.
+type WriterFactory func(filename string) (OutputWriter, error)
+
+// RotationConfig controls how RotatingWriter splits its output.
+type RotationConfig struct {
+	MaxRecords  int    // records per shard; 0 means no limit
+	MaxBytes    int64  // roll once a shard reaches this size on disk, checked after each batch; 0 means no limit
+	PartitionBy string // one of PartitionFields, or "" for a single partition
+
+	// Files lists the files a shard written to filename consists of, for
+	// writers such as a MultiWriter that write more than one. Nil means just
+	// filename.
+	Files func(filename string) []string
+}
+
+// sizer is implemented by writers that can report how much they have
+// written to disk so far.
+type sizer interface {
+	Size() (int64, error)
+}
+
+// RotatingWriter splits its output into shards: a new shard starts after
+// MaxRecords records or MaxBytes bytes, and every value of PartitionBy gets
+// shards of its own. Shards are named after filename with the partition and
+// a sequence number before the extension, so books.csv yields
+// books-00001.csv or books-rating=5-00001.csv. Close writes a manifest,
+// books.manifest.json, listing every shard with its record count and
+// SHA-256, and removes the shards of earlier runs it does not list. Shards
+// reach their final paths as they rotate out, so until Close succeeds the
+// directory may mix runs; stage the outputs with a Publisher to avoid that.
+type RotatingWriter struct {
+	filename string
+	cfg      RotationConfig
+	create   WriterFactory
+
+	mu         sync.Mutex
+	partitions map[string]*partition
+	shards     []*shard
+}
+
+type partition struct {
+	key     string
+	seq     int
+	current *shard
+}
+
+type shard struct {
+	path      string
+	partition string
+	writer    OutputWriter
+	records   int
+}
+
+// NewRotatingWriter returns a writer that shards filename as cfg describes,
+// creating each shard's writer with create.
+func NewRotatingWriter(filename string, cfg RotationConfig, create WriterFactory) (*RotatingWriter, error) {
+	if cfg.PartitionBy != "" {
+		if _, err := partitionKey(&models.Book{}, cfg.PartitionBy); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MaxRecords < 0 || cfg.MaxBytes < 0 {
+		return nil, errors.New("rotation limits cannot be negative")
+	}
+	return &RotatingWriter{
+		filename:   filename,
+		cfg:        cfg,
+		create:     create,
+		partitions: make(map[string]*partition),
+	}, nil
+}
+
+// ManifestPath returns where a RotatingWriter for filename writes its
+// manifest: books.csv.gz gives books.manifest.json.
+func ManifestPath(filename string) string {
+	stem, _ := splitShardExt(filename)
+	return stem + ".manifest.json"
+}
+
+// splitShardExt splits filename into its stem and its full extension,
+// including any compression extension: books.jsonl.gz gives books and
+// .jsonl.gz.
+func splitShardExt(filename string) (stem, ext string) {
+	trimmed := TrimCompressionExt(filename)
+	ext = filepath.Ext(trimmed)
+	return strings.TrimSuffix(trimmed, ext), ext + strings.TrimPrefix(filename, trimmed)
+}
+
+// shardPath names shard seq of partition key.
+func (rw *RotatingWriter) shardPath(key string, seq int) string {
+	stem, ext := splitShardExt(rw.filename)
+	if rw.cfg.PartitionBy != "" {
+		stem += "-" + rw.cfg.PartitionBy + "=" + sanitizeKey(key)
+	}
+	return fmt.Sprintf("%s-%05d%s", stem, seq, ext)
+}
+
+// sanitizeKey makes a partition value safe for a file name. Values that
+// need changing, including the empty one, also get a short hash of the raw
+// value after a ~, which sanitized characters never include, so "In stock"
+// and "In_stock" still name different shards.
+func sanitizeKey(key string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	if safe == key && key != "" {
+		return key
+	}
+	if key == "" {
+		safe = "unknown"
+	}
+	sum := sha256.Sum256([]byte(key))
+	return safe + "~" + hex.EncodeToString(sum[:4])
+}
+
+// Write routes books to the current shard of their partition, rolling to a
+// new shard whenever a limit is reached.
+func (rw *RotatingWriter) Write(books []*models.Book) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	groups := make(map[string][]*models.Book)
+	var order []string
+	for _, book := range books {
+		key := ""
+		if rw.cfg.PartitionBy != "" {
+			key, _ = partitionKey(book, rw.cfg.PartitionBy)
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], book)
+	}
+	for _, key := range order {
+		if err := rw.writePartition(key, groups[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rw *RotatingWriter) writePartition(key string, books []*models.Book) error {
+	p, ok := rw.partitions[key]
+	if !ok {
+		p = &partition{key: key}
+		rw.partitions[key] = p
+	}
+	for len(books) > 0 {
+		if p.current == nil {
+			p.seq++
+			path := rw.shardPath(key, p.seq)
+			writer, err := rw.create(path)
+			if err != nil {
+				return fmt.Errorf("create shard %s: %w", path, err)
+			}
+			p.current = &shard{path: path, partition: key, writer: writer}
+			rw.shards = append(rw.shards, p.current)
+		}
+		s := p.current
+
+		n := len(books)
+		if rw.cfg.MaxRecords > 0 {
+			n = min(n, rw.cfg.MaxRecords-s.records)
+		}
+		if err := s.writer.Write(books[:n]); err != nil {
+			return fmt.Errorf("write shard %s: %w", s.path, err)
+		}
+		s.records += n
+		books = books[n:]
+
+		full, err := rw.full(s)
+		if err != nil {
+			return err
+		}
+		if full {
+			p.current = nil
+			if err := s.finish(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// full reports whether s has reached a rotation limit.
+func (rw *RotatingWriter) full(s *shard) (bool, error) {
+	if rw.cfg.MaxRecords > 0 && s.records >= rw.cfg.MaxRecords {
+		return true, nil
+	}
+	if rw.cfg.MaxBytes <= 0 {
+		return false, nil
+	}
+	sz, ok := s.writer.(sizer)
+	if !ok {
+		return false, fmt.Errorf("shard %s: writer cannot report its size for byte-based rotation", s.path)
+	}
+	size, err := sz.Size()
+	if err != nil {
+		return false, fmt.Errorf("shard %s: %w", s.path, err)
+	}
+	return size >= rw.cfg.MaxBytes, nil
+}
+
+// finish validates and closes a shard that will receive no more records. An
+// invalid shard is aborted rather than published.
+func (s *shard) finish() error {
+	w := s.writer
+	s.writer = nil
+	if err := w.Validate(); err != nil {
+		_ = Abort(w)
+		return fmt.Errorf("validate shard %s: %w", s.path, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close shard %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Validate checks the shards still open. A run without records, like an
+// empty CSV output, is valid: it has no shards and an empty manifest.
+func (rw *RotatingWriter) Validate() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	var errs []error
+	for _, s := range rw.shards {
+		if s.writer == nil {
+			continue
+		}
+		if err := s.writer.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("shard %s: %w", s.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetSummary hands the run summary to the shards still open that report
+// one; shards already rotated out are finished without it.
+func (rw *RotatingWriter) SetSummary(summary RunSummary) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	for _, s := range rw.shards {
+		if s.writer != nil {
+			SetSummary(s.writer, summary)
+		}
+	}
+}
+
+// Close closes every open shard, writes the manifest and removes stale
+// shards of earlier runs.
+func (rw *RotatingWriter) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	var errs []error
+	for _, s := range rw.shards {
+		if s.writer == nil {
+			continue
+		}
+		if err := s.writer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close shard %s: %w", s.path, err))
+		}
+		s.writer = nil
+	}
+	for _, p := range rw.partitions {
+		p.current = nil
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if err := rw.writeManifest(); err != nil {
+		return err
+	}
+	rw.removeStaleShards()
+	return nil
+}
+
+// files lists the files of the shard written to path.
+func (rw *RotatingWriter) files(path string) []string {
+	if rw.cfg.Files != nil {
+		return rw.cfg.Files(path)
+	}
+	return []string{path}
+}
+
+// removeStaleShards deletes the shards of earlier runs that the manifest
+// just written does not list, such as books-00004.csv left by a run with
+// more shards, so the directory holds one run's shards. Files that only
+// look like shards, such as books-notes.csv, are left alone.
+func (rw *RotatingWriter) removeStaleShards() {
+	current := make(map[string]bool)
+	for _, s := range rw.shards {
+		for _, file := range rw.files(s.path) {
+			current[filepath.Base(file)] = true
+		}
+	}
+	patterns := rw.shardPatterns()
+	dir := filepath.Dir(rw.filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("listing shards to remove stale ones", slog.String("dir", dir), slog.Any("error", err))
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || current[name] || !slices.ContainsFunc(patterns, func(re *regexp.Regexp) bool { return re.MatchString(name) }) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := os.Remove(path); err != nil {
+			slog.Warn("removing stale shard", slog.String("shard", path), slog.Any("error", err))
+			continue
+		}
+		slog.Info("removed stale shard", slog.String("shard", path))
+	}
+}
+
+// shardPatterns match the names of every file of any shard of filename,
+// whatever its partition or sequence number.
+func (rw *RotatingWriter) shardPatterns() []*regexp.Regexp {
+	stem, ext := splitShardExt(rw.filename)
+	partitions := "(?:(?:" + strings.Join(PartitionFields, "|") + ")=.*-)?"
+	var patterns []*regexp.Regexp
+	for _, file := range rw.files(stem + "-00001" + ext) {
+		fileStem, fileExt := splitShardExt(filepath.Base(file))
+		prefix := strings.TrimSuffix(fileStem, "00001")
+		patterns = append(patterns, regexp.MustCompile("^"+regexp.QuoteMeta(prefix)+partitions+`\d{5,}`+regexp.QuoteMeta(fileExt)+"$"))
+	}
+	return patterns
+}
+
+// Abort discards the shards still open and writes no manifest. Shards
+// already rotated out have been published and stay where they are.
+func (rw *RotatingWriter) Abort() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	for _, s := range rw.shards {
+		if s.writer == nil {
+			continue
+		}
+		if err := Abort(s.writer); err != nil {
+			slog.Debug("closing aborted shard", slog.String("shard", s.path), slog.Any("error", err))
+		}
+		s.writer = nil
+	}
+	for _, p := range rw.partitions {
+		p.current = nil
+	}
+}
+
+// Manifest lists the shards of a RotatingWriter.
+type Manifest struct {
+	CreatedAt    time.Time       `json:"created_at"`
+	PartitionBy  string          `json:"partition_by,omitempty"`
+	MaxRecords   int             `json:"max_records,omitempty"`
+	MaxBytes     int64           `json:"max_bytes,omitempty"`
+	TotalRecords int             `json:"total_records"`
+	Shards       []ManifestShard `json:"shards"`
+}
+
+// ManifestShard is one file of a shard. Paths are relative to the
+// manifest's directory.
+type ManifestShard struct {
+	Path      string `json:"path"`
+	Partition string `json:"partition,omitempty"`
+	Records   int    `json:"records"`
+	Bytes     int64  `json:"bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+func (rw *RotatingWriter) writeManifest() error {
+	m := Manifest{
+		CreatedAt:   time.Now().UTC(),
+		PartitionBy: rw.cfg.PartitionBy,
+		MaxRecords:  rw.cfg.MaxRecords,
+		MaxBytes:    rw.cfg.MaxBytes,
+		Shards:      []ManifestShard{},
+	}
+	shards := append([]*shard(nil), rw.shards...)
+	sort.SliceStable(shards, func(i, j int) bool { return shards[i].path < shards[j].path })
+	for _, s := range shards {
+		m.TotalRecords += s.records
+		for _, file := range rw.files(s.path) {
+			size, sum, err := checksumFile(file)
+			if err != nil {
+				return fmt.Errorf("checksum shard %s: %w", file, err)
+			}
+			m.Shards = append(m.Shards, ManifestShard{
+				Path:      filepath.Base(file),
+				Partition: s.partition,
+				Records:   s.records,
+				Bytes:     size,
+				SHA256:    sum,
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	path := ManifestPath(rw.filename)
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create manifest temp file: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err == nil {
+		err = f.Chmod(0o644) // CreateTemp opens it 0600; keep the manifest readable
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("publish manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest loads the manifest at path.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+func checksumFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,318 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+func rotationBooks(n int) []*models.Book {
+	books := make([]*models.Book, n)
+	for i := range books {
+		books[i] = &models.Book{
+			Title:         "Book",
+			URL:           "http://example.test/" + string(rune('a'+i)),
+			RatingNumeric: i%2 + 4,
+			Source:        "books",
+			ScrapedAt:     time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC),
+		}
+	}
+	return books
+}
+
+func closeRotating(t *testing.T, w *RotatingWriter) *Manifest {
+	t.Helper()
+	if err := w.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	m, err := ReadManifest(ManifestPath(w.filename))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	return m
+}
+
+func shardPaths(m *Manifest) []string {
+	paths := make([]string, len(m.Shards))
+	for i, s := range m.Shards {
+		paths[i] = s.Path
+	}
+	return paths
+}
+
+func TestRotatingWriter_RotatesByRecords(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewRotatingWriter(filepath.Join(dir, "books.csv"), RotationConfig{MaxRecords: 2}, func(name string) (OutputWriter, error) {
+		return NewCSVWriter(name)
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	books := rotationBooks(5)
+	if err := w.Write(books[:3]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Write(books[3:]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	m := closeRotating(t, w)
+
+	want := []string{"books-00001.csv", "books-00002.csv", "books-00003.csv"}
+	if got := shardPaths(m); !reflect.DeepEqual(got, want) {
+		t.Fatalf("shards = %v, want %v", got, want)
+	}
+	if m.TotalRecords != 5 || m.MaxRecords != 2 {
+		t.Fatalf("manifest = %+v", m)
+	}
+	for i, records := range []int{2, 2, 1} {
+		s := m.Shards[i]
+		got, err := ReadAll(filepath.Join(dir, s.Path))
+		if err != nil || len(got) != records || s.Records != records {
+			t.Fatalf("shard %s: manifest says %d, file has %d (err %v), want %d", s.Path, s.Records, len(got), err, records)
+		}
+		size, sum, err := checksumFile(filepath.Join(dir, s.Path))
+		if err != nil || size != s.Bytes || sum != s.SHA256 {
+			t.Fatalf("shard %s: size %d sum %s, manifest %+v", s.Path, size, sum, s)
+		}
+	}
+}
+
+func TestRotatingWriter_RotatesByBytes(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewRotatingWriter(filepath.Join(dir, "books.jsonl"), RotationConfig{MaxBytes: 1}, func(name string) (OutputWriter, error) {
+		return NewJSONWriter(name)
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for _, book := range rotationBooks(3) {
+		if err := w.Write([]*models.Book{book}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	m := closeRotating(t, w)
+	if len(m.Shards) != 3 {
+		t.Fatalf("shards = %v, want one per batch once the byte limit is reached", shardPaths(m))
+	}
+}
+
+func TestRotatingWriter_Partitions(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewRotatingWriter(filepath.Join(dir, "books.jsonl.gz"), RotationConfig{PartitionBy: "rating"}, func(name string) (OutputWriter, error) {
+		return NewJSONWriter(name)
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.Write(rotationBooks(5)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	m := closeRotating(t, w)
+
+	want := []string{"books-rating=4-00001.jsonl.gz", "books-rating=5-00001.jsonl.gz"}
+	if got := shardPaths(m); !reflect.DeepEqual(got, want) {
+		t.Fatalf("shards = %v, want %v", got, want)
+	}
+	if m.Shards[0].Partition != "4" || m.Shards[0].Records != 3 || m.Shards[1].Records != 2 {
+		t.Fatalf("manifest shards = %+v", m.Shards)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "books.manifest.json")); err != nil {
+		t.Fatalf("manifest not next to the shards: %v", err)
+	}
+}
+
+func TestRotatingWriter_ListsEveryFileOfAShard(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewRotatingWriter(filepath.Join(dir, "books.csv"), RotationConfig{
+		PartitionBy: "date",
+		Files: func(name string) []string {
+			return []string{name, name[:len(name)-len(".csv")] + ".json"}
+		},
+	}, func(name string) (OutputWriter, error) {
+		return newCSVAndJSONWriter(name, name[:len(name)-len(".csv")]+".json")
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.Write(rotationBooks(2)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	m := closeRotating(t, w)
+	want := []string{"books-date=2024-05-01-00001.csv", "books-date=2024-05-01-00001.json"}
+	if got := shardPaths(m); !reflect.DeepEqual(got, want) {
+		t.Fatalf("shards = %v, want %v", got, want)
+	}
+}
+
+func TestRotatingWriter_Errors(t *testing.T) {
+	create := func(name string) (OutputWriter, error) { return NewCSVWriter(name) }
+	if _, err := NewRotatingWriter("books.csv", RotationConfig{PartitionBy: "title"}, create); err == nil {
+		t.Fatal("expected an error for an unknown partition field")
+	}
+	if _, err := NewRotatingWriter("books.csv", RotationConfig{MaxRecords: -1}, create); err == nil {
+		t.Fatal("expected an error for a negative limit")
+	}
+}
+
+func TestRotatingWriter_EmptyRun(t *testing.T) {
+	w, err := NewRotatingWriter(filepath.Join(t.TempDir(), "books.csv"), RotationConfig{MaxRecords: 1}, func(name string) (OutputWriter, error) {
+		return NewCSVWriter(name)
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	m := closeRotating(t, w)
+	if m.TotalRecords != 0 || len(m.Shards) != 0 {
+		t.Fatalf("manifest of an empty run = %+v, want no shards", m)
+	}
+}
+
+func TestRotatingWriter_AbortsInvalidShard(t *testing.T) {
+	var shards []*abortableWriter
+	w, err := NewRotatingWriter(filepath.Join(t.TempDir(), "books.csv"), RotationConfig{MaxRecords: 1}, func(string) (OutputWriter, error) {
+		s := &abortableWriter{failingWriter: failingWriter{mockWriter: mockWriter{validateErr: errors.New("truncated")}}}
+		shards = append(shards, s)
+		return s, nil
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.Write(rotationBooks(1)); err == nil {
+		t.Fatal("expected the invalid shard to fail the write")
+	}
+	_ = w.Close()
+	if len(shards) != 1 || !shards[0].aborted || shards[0].closed {
+		t.Fatal("invalid shard was published instead of aborted")
+	}
+}
+
+func TestRotatingWriter_Abort(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewRotatingWriter(filepath.Join(dir, "books.csv"), RotationConfig{MaxRecords: 2}, func(name string) (OutputWriter, error) {
+		return NewCSVWriter(name)
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.Write(rotationBooks(3)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := Abort(w); err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+	// The full first shard was published when it rotated out; the open
+	// second shard and the manifest are not.
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"books-00001.csv"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("files after abort = %v, want %v", names, want)
+	}
+}
+
+func TestRotatingWriter_RemovesStaleShards(t *testing.T) {
+	dir := t.TempDir()
+	// Shards of an earlier, longer run and files that only look like shards.
+	for _, name := range []string{"books-00001.csv", "books-00004.csv", "books-rating=5-00001.csv", "books-00002.json", "books-notes.csv", "books-2024-00001.csv", "other-00001.csv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	files := func(name string) []string { return []string{name, strings.TrimSuffix(name, ".csv") + ".json"} }
+	w, err := NewRotatingWriter(filepath.Join(dir, "books.csv"), RotationConfig{MaxRecords: 2, Files: files}, func(name string) (OutputWriter, error) {
+		return newCSVAndJSONWriter(name, files(name)[1])
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.Write(rotationBooks(2)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	closeRotating(t, w)
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"books-00001.csv", "books-00001.json", "books-2024-00001.csv", "books-notes.csv", "books.manifest.json", "other-00001.csv"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("files = %v, want %v", names, want)
+	}
+}
+
+func TestRotatingWriter_LeavesOtherManifestTempFilesAlone(t *testing.T) {
+	dir := t.TempDir()
+	// Another run writing the same manifest is midway through its temp file.
+	other := filepath.Join(dir, ".books.manifest.json.tmp")
+	if err := os.WriteFile(other, []byte("in flight"), 0o644); err != nil {
+		t.Fatalf("write other temp file: %v", err)
+	}
+	w, err := NewRotatingWriter(filepath.Join(dir, "books.csv"), RotationConfig{MaxRecords: 2}, func(name string) (OutputWriter, error) {
+		return NewCSVWriter(name)
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.Write(rotationBooks(1)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if m := closeRotating(t, w); m.TotalRecords != 1 {
+		t.Fatalf("manifest = %+v", m)
+	}
+	if got, err := os.ReadFile(other); err != nil || string(got) != "in flight" {
+		t.Fatalf("other temp file = %q (%v), want it untouched", got, err)
+	}
+}
+
+func TestRotatingWriter_DistinctShardsForSimilarKeys(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewRotatingWriter(filepath.Join(dir, "books.jsonl"), RotationConfig{PartitionBy: "availability"}, func(name string) (OutputWriter, error) {
+		return NewJSONWriter(name)
+	})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	books := rotationBooks(3)
+	books[0].Availability = "In stock"
+	books[1].Availability = "In_stock"
+	books[2].Availability = "In/stock"
+	if err := w.Write(books); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	m := closeRotating(t, w)
+
+	if len(m.Shards) != 3 {
+		t.Fatalf("shards = %v, want one per availability", shardPaths(m))
+	}
+	seen := make(map[string]bool)
+	for _, s := range m.Shards {
+		if seen[s.Path] {
+			t.Fatalf("shard path %s is used twice", s.Path)
+		}
+		seen[s.Path] = true
+		got, err := ReadAll(filepath.Join(dir, s.Path))
+		if err != nil || len(got) != 1 || got[0].Availability != s.Partition {
+			t.Fatalf("shard %s holds %+v (err %v), want its own %q record", s.Path, got, err, s.Partition)
+		}
+	}
+}
+
+func TestSanitizeKey(t *testing.T) {
+	for key, want := range map[string]string{"": "unknown~e3b0c442", "In stock": "In_stock~f66315eb", "In_stock": "In_stock", "a/b": "a_b~c14cddc0", "GBP": "GBP"} {
+		if got := sanitizeKey(key); got != want {
+			t.Fatalf("sanitizeKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// outputFields returns fields, or every field of models.BookFields when none
+// are given; the writers take their columns from it.
+func outputFields(fields []models.Field) []models.Field {
+	if len(fields) == 0 {
+		return models.BookFields
+	}
+	return fields
+}
+
+// appendJSONRecord appends the JSON object of the fields of b, in order.
+// With every field it matches what encoding/json makes of a models.Book.
+func appendJSONRecord(buf *bytes.Buffer, b *models.Book, fields []models.Field) error {
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, err := json.Marshal(f.Value(b))
+		if err != nil {
+			return fmt.Errorf("encode field %s: %w", f.Name, err)
+		}
+		name, _ := json.Marshal(f.Name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// ArrowSchema returns the Arrow schema of fields, every field when none are
+// given. Timestamps are stored in microseconds, in UTC.
+func ArrowSchema(fields ...models.Field) *arrow.Schema {
+	fields = outputFields(fields)
+	columns := make([]arrow.Field, len(fields))
+	for i, f := range fields {
+		columns[i] = arrow.Field{Name: f.Name, Type: arrowType(f.Type)}
+	}
+	return arrow.NewSchema(columns, nil)
+}
+
+func arrowType(t models.FieldType) arrow.DataType {
+	switch t {
+	case models.FieldInt:
+		return arrow.PrimitiveTypes.Int64
+	case models.FieldFloat:
+		return arrow.PrimitiveTypes.Float64
+	case models.FieldTime:
+		return arrow.FixedWidthTypes.Timestamp_us
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// AvroSchema returns the Avro schema of fields, every field when none are
+// given, as JSON: a Book record whose timestamps are longs with the
+// timestamp-micros logical type.
+func AvroSchema(fields ...models.Field) string {
+	fields = outputFields(fields)
+	columns := make([]map[string]any, len(fields))
+	for i, f := range fields {
+		columns[i] = map[string]any{"name": f.Name, "type": avroType(f.Type)}
+	}
+	schema, err := json.Marshal(map[string]any{
+		"type":      "record",
+		"name":      "Book",
+		"namespace": "books.scraper",
+		"fields":    columns,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("marshal avro schema: %v", err))
+	}
+	return string(schema)
+}
+
+func avroType(t models.FieldType) any {
+	switch t {
+	case models.FieldInt:
+		return "long"
+	case models.FieldFloat:
+		return "double"
+	case models.FieldTime:
+		return map[string]string{"type": "long", "logicalType": "timestamp-micros"}
+	default:
+		return "string"
+	}
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing one record of
+// fields, every field when none are given, as the JSON writer writes it.
+// Every field is required and no other is allowed.
+func JSONSchema(fields ...models.Field) map[string]any {
+	fields = outputFields(fields)
+	properties := make(map[string]any, len(fields))
+	required := make([]string, len(fields))
+	for i, f := range fields {
+		properties[f.Name] = jsonSchemaType(f.Type)
+		required[i] = f.Name
+	}
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "Book",
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func jsonSchemaType(t models.FieldType) map[string]string {
+	switch t {
+	case models.FieldInt:
+		return map[string]string{"type": "integer"}
+	case models.FieldFloat:
+		return map[string]string{"type": "number"}
+	case models.FieldTime:
+		return map[string]string{"type": "string", "format": "date-time"}
+	default:
+		return map[string]string{"type": "string"}
+	}
+}
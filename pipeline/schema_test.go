@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+func TestSchemasFollowFields(t *testing.T) {
+	fields, err := models.SelectFields([]string{"url", "title", "scraped_at", "price_numeric"}, nil)
+	if err != nil {
+		t.Fatalf("select fields: %v", err)
+	}
+	arrowFields := ArrowSchema(fields...).Fields()
+	var avro struct {
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(AvroSchema(fields...)), &avro); err != nil {
+		t.Fatalf("avro schema is not JSON: %v", err)
+	}
+	jsonSchema := JSONSchema(fields...)
+	if len(arrowFields) != len(fields) || len(avro.Fields) != len(fields) || len(jsonSchema["required"].([]string)) != len(fields) {
+		t.Fatalf("schemas have %d, %d and %d fields, want %d", len(arrowFields), len(avro.Fields), len(jsonSchema["required"].([]string)), len(fields))
+	}
+	for i, f := range fields {
+		if arrowFields[i].Name != f.Name || avro.Fields[i].Name != f.Name {
+			t.Errorf("field %d: arrow %s, avro %s, want %s", i, arrowFields[i].Name, avro.Fields[i].Name, f.Name)
+		}
+	}
+	properties := jsonSchema["properties"].(map[string]any)
+	if got := properties["scraped_at"].(map[string]string); got["format"] != "date-time" {
+		t.Errorf("scraped_at schema = %v", got)
+	}
+	if got := properties["price_numeric"].(map[string]string); got["type"] != "number" {
+		t.Errorf("price_numeric schema = %v", got)
+	}
+	if len(ArrowSchema().Fields()) != len(models.BookFields) {
+		t.Errorf("default arrow schema has %d fields, want every field", len(ArrowSchema().Fields()))
+	}
+}
+
+func TestJSONWriterMatchesStructEncoding(t *testing.T) {
+	book := &models.Book{
+		Title:        `A <b>"quoted"</b> title`,
+		PriceNumeric: 51.77,
+		URL:          "http://example.test/book?a=1&b=2",
+		ScrapedAt:    time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+	}
+	path := filepath.Join(t.TempDir(), "books.jsonl")
+	writer, err := NewJSONWriter(path)
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	if err := writer.Write([]*models.Book{book}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	want, _ := json.Marshal(book)
+	if string(got) != string(want)+"\n" {
+		t.Fatalf("record:\n got  %s want %s", got, want)
+	}
+}
+
+func TestWritersSelectFields(t *testing.T) {
+	fields, err := models.SelectFields([]string{"url", "title", "price"}, nil)
+	if err != nil {
+		t.Fatalf("select fields: %v", err)
+	}
+	book := &models.Book{Title: "T", Price: "£1.00", URL: "http://example.test/t", ISBN: "123"}
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "books.csv")
+	jsonPath := filepath.Join(dir, "books.jsonl")
+	csvWriter, err := NewCSVWriter(csvPath, fields...)
+	if err != nil {
+		t.Fatalf("create csv writer: %v", err)
+	}
+	jsonWriter, err := NewJSONWriter(jsonPath, fields...)
+	if err != nil {
+		t.Fatalf("create json writer: %v", err)
+	}
+	for _, w := range []OutputWriter{csvWriter, jsonWriter} {
+		if err := w.Write([]*models.Book{book}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+
+	csvData, _ := os.ReadFile(csvPath)
+	if want := "url,title,price\nhttp://example.test/t,T,£1.00\n"; string(csvData) != want {
+		t.Errorf("csv:\n got  %q\n want %q", csvData, want)
+	}
+	jsonData, _ := os.ReadFile(jsonPath)
+	if want := `{"url":"http://example.test/t","title":"T","price":"£1.00"}`; strings.TrimSpace(string(jsonData)) != want {
+		t.Errorf("json:\n got  %s\n want %s", jsonData, want)
+	}
+	books, err := ReadAll(csvPath)
+	if err != nil || len(books) != 1 || books[0].URL != book.URL || books[0].ISBN != "" {
+		t.Errorf("read back %+v, %v", books, err)
+	}
+}
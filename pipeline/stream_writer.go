@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// StreamWriter writes records to a stream such as stdout, as CSV or JSON
+// Lines, for piping into other tools. Unlike the file writers there is no
+// temp file to rename: each batch is encoded in memory and written with one
+// call, so a reader downstream sees whole records as soon as each batch is
+// flushed. Close does not close the stream.
+type StreamWriter struct {
+	w       io.Writer
+	format  string
+	fields  []models.Field
+	written int64
+	failed  error // first write error; Validate reports it
+	mu      sync.Mutex
+}
+
+// NewStreamWriter initialises a writer of format, csv or json, on w; for CSV
+// it writes the header row. Records hold fields, in order, or every field of
+// models.BookFields.
+func NewStreamWriter(w io.Writer, format string, fields ...models.Field) (*StreamWriter, error) {
+	if format != "csv" && format != "json" {
+		return nil, fmt.Errorf("cannot stream the %s format: want csv or json", format)
+	}
+	sw := &StreamWriter{w: w, format: format, fields: outputFields(fields)}
+	if format == "csv" {
+		header := make([]string, len(sw.fields))
+		for i, f := range sw.fields {
+			header[i] = f.Name
+		}
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		_ = cw.Write(header)
+		cw.Flush()
+		if err := sw.flush(buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("write csv header: %w", err)
+		}
+	}
+	return sw, nil
+}
+
+// Write encodes books and writes them to the stream at once.
+func (sw *StreamWriter) Write(books []*models.Book) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.failed != nil {
+		return sw.failed
+	}
+
+	var buf bytes.Buffer
+	if sw.format == "csv" {
+		cw := csv.NewWriter(&buf)
+		for _, book := range books {
+			record := make([]string, len(sw.fields))
+			for i, f := range sw.fields {
+				record[i] = f.Text(book)
+			}
+			if err := cw.Write(record); err != nil {
+				return fmt.Errorf("encode csv record: %w", err)
+			}
+		}
+		cw.Flush()
+	} else {
+		for _, book := range books {
+			if err := appendJSONRecord(&buf, book, sw.fields); err != nil {
+				return fmt.Errorf("encode json record: %w", err)
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	if err := sw.flush(buf.Bytes()); err != nil {
+		return fmt.Errorf("write %s stream: %w", sw.format, err)
+	}
+	return nil
+}
+
+func (sw *StreamWriter) flush(p []byte) error {
+	n, err := sw.w.Write(p)
+	sw.written += int64(n)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		sw.failed = err
+	}
+	return err
+}
+
+// Size returns how many bytes have been written to the stream.
+func (sw *StreamWriter) Size() (int64, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.written, nil
+}
+
+// Close releases nothing: the stream belongs to the caller.
+func (sw *StreamWriter) Close() error {
+	return nil
+}
+
+// Validate reports the first write error, if any. Records already written
+// cannot be taken back, so this is all a stream can check.
+func (sw *StreamWriter) Validate() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.failed != nil {
+		return fmt.Errorf("%s stream failed: %w", sw.format, sw.failed)
+	}
+	if sw.written == 0 {
+		return errors.New("nothing was written to the stream")
+	}
+	return nil
+}
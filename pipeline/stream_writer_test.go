@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// chunkRecorder records each Write call separately.
+type chunkRecorder struct {
+	chunks []string
+	err    error
+}
+
+func (c *chunkRecorder) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.chunks = append(c.chunks, string(p))
+	return len(p), nil
+}
+
+func TestStreamWriter_OneWritePerBatch(t *testing.T) {
+	fields, err := models.SelectFields([]string{"url", "title"}, nil)
+	if err != nil {
+		t.Fatalf("select fields: %v", err)
+	}
+	books := []*models.Book{
+		{URL: "http://example.test/1", Title: "One, with a comma"},
+		{URL: "http://example.test/2", Title: "Two"},
+	}
+	for format, want := range map[string][]string{
+		"csv": {
+			"url,title\n",
+			"http://example.test/1,\"One, with a comma\"\nhttp://example.test/2,Two\n",
+			"http://example.test/1,\"One, with a comma\"\n",
+		},
+		"json": {
+			`{"url":"http://example.test/1","title":"One, with a comma"}` + "\n" + `{"url":"http://example.test/2","title":"Two"}` + "\n",
+			`{"url":"http://example.test/1","title":"One, with a comma"}` + "\n",
+		},
+	} {
+		t.Run(format, func(t *testing.T) {
+			var out chunkRecorder
+			writer, err := NewStreamWriter(&out, format, fields...)
+			if err != nil {
+				t.Fatalf("create writer: %v", err)
+			}
+			if err := writer.Write(books); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := writer.Write(books[:1]); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := writer.Validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if strings.Join(out.chunks, "|") != strings.Join(want, "|") {
+				t.Errorf("writes = %q, want %q", out.chunks, want)
+			}
+		})
+	}
+}
+
+func TestStreamWriter_Errors(t *testing.T) {
+	if _, err := NewStreamWriter(&bytes.Buffer{}, "xlsx"); err == nil {
+		t.Error("xlsx stream: want an error")
+	}
+
+	var empty bytes.Buffer
+	writer, err := NewStreamWriter(&empty, "json")
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	if err := writer.Validate(); err == nil {
+		t.Error("validate of an empty stream: want an error")
+	}
+
+	broken := &chunkRecorder{}
+	writer, err = NewStreamWriter(broken, "json")
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	broken.err = errors.New("broken pipe")
+	if err := writer.Write([]*models.Book{{URL: "http://example.test/1"}}); err == nil {
+		t.Fatal("write to a broken stream: want an error")
+	}
+	if err := writer.Validate(); err == nil || !strings.Contains(err.Error(), "broken pipe") {
+		t.Errorf("validate after a failed write: err = %v", err)
+	}
+}
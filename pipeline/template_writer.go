@@ -0,0 +1,274 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// TemplateWriter renders records through a user's text/template file, for
+// formats without a writer of their own: Markdown tables, SQL scripts, XML
+// feeds. The file defines up to three templates: "header", executed once with
+// a TemplateDoc before the first record, "row", executed with a
+// TemplateRecord for every record, and "footer", executed with a TemplateDoc
+// by Validate or Close. Only "row" is required. Templates may call the
+// functions of TemplateFuncs.
+//
+// Each batch is rendered in memory and then appended to a temp file renamed
+// onto the final path by Close, like the other writers.
+type TemplateWriter struct {
+	*atomicFile
+	tmpl     *template.Template
+	fields   []models.Field
+	count    int
+	summary  *RunSummary
+	finished bool // footer written by Validate; no more writes
+	mu       sync.Mutex
+}
+
+// TemplateDoc is the data of the header and footer templates.
+type TemplateDoc struct {
+	Fields  []models.Field // the output fields, for templates that loop over them
+	Count   int            // records written; 0 in the header
+	Summary *RunSummary    // the run, in the footer of a crawl's output; nil otherwise
+}
+
+// TemplateRecord is the data of the row template: the book itself, so
+// {{.Title}} works, plus its position and the output fields.
+type TemplateRecord struct {
+	*models.Book
+	Index  int // of the record in the output, from 0
+	Fields []models.Field
+}
+
+// TemplateFuncs are the functions templates of TemplateWriter may call, on
+// top of the text/template builtins:
+//
+//	csv v         v as one CSV field, quoted when needed
+//	json v        v as JSON: a quoted string, a number, an RFC 3339 time
+//	xml v         v escaped for XML text and attribute values
+//	sql v         v as an SQL literal: a quoted string or time, or a number
+//	md v          v for a Markdown table cell, with pipes and newlines escaped
+//	fixed n v     the number v with n decimals
+//	text f b      the field f of book b, as the CSV writer writes it
+//	value f b     the field f of book b, as a string, int64, float64 or time
+var TemplateFuncs = template.FuncMap{
+	"csv":   csvField,
+	"json":  jsonValue,
+	"xml":   xmlText,
+	"sql":   sqlLiteral,
+	"md":    markdownCell,
+	"fixed": fixed,
+	"text":  func(f models.Field, b *models.Book) string { return f.Text(b) },
+	"value": func(f models.Field, b *models.Book) any { return f.Value(b) },
+}
+
+// NewTemplateWriter parses templateFile and writes its header to a temp file
+// in the same directory as filename. The templates see fields, in order, or
+// every field of models.BookFields.
+func NewTemplateWriter(filename, templateFile string, fields ...models.Field) (*TemplateWriter, error) {
+	tmpl, err := ParseTemplateFile(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	af, err := createAtomicFile(filename, "template")
+	if err != nil {
+		return nil, err
+	}
+	tw := &TemplateWriter{atomicFile: af, tmpl: tmpl, fields: outputFields(fields)}
+	if err := tw.render("header", TemplateDoc{Fields: tw.fields}); err != nil {
+		af.abort()
+		return nil, err
+	}
+	return tw, nil
+}
+
+// ParseTemplateFile parses a template file for TemplateWriter, checking that
+// it defines a row template.
+func ParseTemplateFile(templateFile string) (*template.Template, error) {
+	tmpl, err := template.New(filepath.Base(templateFile)).Funcs(TemplateFuncs).ParseFiles(templateFile)
+	if err != nil {
+		return nil, fmt.Errorf("parse output template: %w", err)
+	}
+	if tmpl.Lookup("row") == nil {
+		return nil, fmt.Errorf("output template %s defines no row template", templateFile)
+	}
+	return tmpl, nil
+}
+
+// TemplateExt is the extension of outputs rendered through templateFile: its
+// own extension once a trailing .tmpl, .tpl or .gotmpl is removed, so
+// books.md.tmpl renders .md files, or .txt.
+func TemplateExt(templateFile string) string {
+	name := filepath.Base(templateFile)
+	switch filepath.Ext(name) {
+	case ".tmpl", ".tpl", ".gotmpl":
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if ext := filepath.Ext(name); ext != "" && ext != name {
+		return ext
+	}
+	return ".txt"
+}
+
+// render executes the template called name, when the file defines it, and
+// appends the result.
+func (tw *TemplateWriter) render(name string, data any) error {
+	if tw.tmpl.Lookup(name) == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := tw.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return fmt.Errorf("render %s template: %w", name, err)
+	}
+	if _, err := tw.atomicFile.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write template output: %w", err)
+	}
+	return nil
+}
+
+// Write renders the row template for every book, appending the batch at once.
+func (tw *TemplateWriter) Write(books []*models.Book) error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.finished {
+		return errors.New("write template output: footer already written by Validate")
+	}
+
+	var buf bytes.Buffer
+	for i, book := range books {
+		record := TemplateRecord{Book: book, Index: tw.count + i, Fields: tw.fields}
+		if err := tw.tmpl.ExecuteTemplate(&buf, "row", record); err != nil {
+			return fmt.Errorf("render row template: %w", err)
+		}
+	}
+	if _, err := tw.atomicFile.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write template output: %w", err)
+	}
+	tw.count += len(books)
+	return nil
+}
+
+// SetSummary records the run summary for the footer template.
+func (tw *TemplateWriter) SetSummary(s RunSummary) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.summary = &s
+}
+
+func (tw *TemplateWriter) finish() error {
+	if tw.finished {
+		return nil
+	}
+	tw.finished = true
+	return tw.render("footer", TemplateDoc{Fields: tw.fields, Count: tw.count, Summary: tw.summary})
+}
+
+// Close renders the footer, closes the temp file, and atomically renames it
+// onto the final path. On any error the temp file is removed (best-effort)
+// and the final path is left untouched.
+func (tw *TemplateWriter) Close() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if err := tw.finish(); err != nil {
+		tw.abort()
+		return err
+	}
+	return tw.commit()
+}
+
+// Validate renders the footer and ensures the temp file has data, so it must
+// come after the last Write and SetSummary.
+func (tw *TemplateWriter) Validate() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if err := tw.finish(); err != nil {
+		return err
+	}
+	return tw.validate()
+}
+
+// templateText formats v as text for the escaping functions.
+func templateText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func csvField(v any) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{templateText(v)}); err != nil {
+		return "", err
+	}
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n"), w.Error()
+}
+
+func jsonValue(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func xmlText(v any) (string, error) {
+	var buf strings.Builder
+	err := xml.EscapeText(&buf, []byte(templateText(v)))
+	return buf.String(), err
+}
+
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int, int64, float64:
+		return templateText(v)
+	default:
+		return "'" + strings.ReplaceAll(templateText(v), "'", "''") + "'"
+	}
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ")
+
+func markdownCell(v any) string {
+	return markdownEscaper.Replace(templateText(v))
+}
+
+func fixed(decimals int, v any) (string, error) {
+	var f float64
+	switch v := v.(type) {
+	case float64:
+		f = v
+	case int:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	default:
+		return "", fmt.Errorf("fixed: want a number, got %T", v)
+	}
+	return strconv.FormatFloat(f, 'f', decimals, 64), nil
+}
@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+func writeTemplate(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "books.sql.tmpl")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTemplateWriter_Sections(t *testing.T) {
+	tmpl := writeTemplate(t, `{{define "header"}}INSERT INTO books ({{range $i, $f := .Fields}}{{if $i}}, {{end}}{{$f.Name}}{{end}}) VALUES
+{{end}}{{define "row"}}{{if .Index}},
+{{end}}({{range $i, $f := .Fields}}{{if $i}}, {{end}}{{sql (value $f $.Book)}}{{end}}){{end}}
+{{define "footer"}};
+-- {{.Count}} books{{with .Summary}}, {{.Stats.Processed}} processed{{end}}
+{{end}}`)
+	fields, err := models.SelectFields([]string{"url", "title", "price_numeric"}, nil)
+	if err != nil {
+		t.Fatalf("select fields: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "books.sql")
+	writer, err := NewTemplateWriter(path, tmpl, fields...)
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	// Two batches, so Index runs across them.
+	if err := writer.Write([]*models.Book{{URL: "http://example.test/1", Title: "O'Brien", PriceNumeric: 9.5}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writer.Write([]*models.Book{{URL: "http://example.test/2", Title: "Two", PriceNumeric: 12}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	writer.SetSummary(RunSummary{Stats: PipelineStats{Processed: 2}})
+	if err := writer.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := writer.Write(nil); err == nil {
+		t.Error("write after validate succeeded, want an error")
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `INSERT INTO books (url, title, price_numeric) VALUES
+('http://example.test/1', 'O''Brien', 9.5),
+('http://example.test/2', 'Two', 12);
+-- 2 books, 2 processed
+`
+	if string(data) != want {
+		t.Errorf("output:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestTemplateWriter_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewTemplateWriter(filepath.Join(dir, "a.txt"), writeTemplate(t, `{{define "header"}}x{{end}}`)); err == nil || !strings.Contains(err.Error(), "no row template") {
+		t.Errorf("template without row: err = %v", err)
+	}
+	if _, err := NewTemplateWriter(filepath.Join(dir, "b.txt"), writeTemplate(t, `{{define "row"}}{{.Title}{{end}}`)); err == nil {
+		t.Error("malformed template: want an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("malformed template left an output behind: %v", err)
+	}
+
+	path := filepath.Join(dir, "c.txt")
+	writer, err := NewTemplateWriter(path, writeTemplate(t, `{{define "row"}}{{.Missing}}{{end}}`))
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	if err := writer.Write([]*models.Book{{URL: "http://example.test/1"}}); err == nil || !strings.Contains(err.Error(), "render row template") {
+		t.Errorf("row with unknown field: err = %v", err)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	book := &models.Book{
+		Title:        "A \"quoted\", <tagged> | piped\ntitle",
+		PriceNumeric: 10,
+		ScrapedAt:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	tests := []struct {
+		text, want string
+	}{
+		{`{{csv .Title}}`, `"A ""quoted"", <tagged> | piped` + "\n" + `title"`},
+		{`{{csv "plain"}}`, `plain`},
+		{`{{json .Title}}`, `"A \"quoted\", <tagged> | piped\ntitle"`},
+		{`{{json .PriceNumeric}}`, `10`},
+		{`{{json .ScrapedAt}}`, `"2024-01-02T03:04:05Z"`},
+		{`{{xml .Title}}`, `A &#34;quoted&#34;, &lt;tagged&gt; | piped&#xA;title`},
+		{`{{sql .ScrapedAt}}`, `'2024-01-02T03:04:05Z'`},
+		{`{{sql .RatingNumeric}}`, `0`},
+		{`{{md .Title}}`, `A "quoted", <tagged> \| piped title`},
+		{`{{fixed 2 .PriceNumeric}}`, `10.00`},
+		{`{{fixed 1 .RatingNumeric}}`, `0.0`},
+		{`{{range .Fields}}{{if eq .Name "scraped_at"}}{{text . $.Book}}{{end}}{{end}}`, `2024-01-02T03:04:05Z`},
+	}
+	for _, tc := range tests {
+		tmpl, err := template.New("t").Funcs(TemplateFuncs).Parse(tc.text)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.text, err)
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, TemplateRecord{Book: book, Fields: models.BookFields}); err != nil {
+			t.Errorf("%s: %v", tc.text, err)
+			continue
+		}
+		if out.String() != tc.want {
+			t.Errorf("%s = %q, want %q", tc.text, out.String(), tc.want)
+		}
+	}
+}
+
+func TestTemplateExt(t *testing.T) {
+	for file, want := range map[string]string{
+		"books.md.tmpl":       ".md",
+		"feeds/books.xml.tpl": ".xml",
+		"insert.sql":          ".sql",
+		"report.tmpl":         ".txt",
+		"template":            ".txt",
+	} {
+		if got := TemplateExt(file); got != want {
+			t.Errorf("TemplateExt(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
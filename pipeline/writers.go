@@ -2,62 +2,53 @@ package pipeline
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
 	"sync"
-	"time"
 
 	"github.com/aluiziolira/go-scrape-books/models"
 )
 
 // CSVWriter writes records to CSV. Output is buffered in a temp file and only
 // renamed onto the final path on a successful Close, so a crash or write error
-// never leaves a half-written file at the final path.
+// never leaves a half-written file at the final path. A filename ending in .gz
+// or .zst is compressed with gzip or zstd.
 type CSVWriter struct {
-	finalPath string
-	tmpPath   string
-	file      *os.File
-	writer    *csv.Writer
-	mu        sync.Mutex
+	*atomicFile
+	writer *csv.Writer
+	fields []models.Field
+	mu     sync.Mutex
 }
 
 // NewCSVWriter initialises a CSV writer and writes the header row to a temp file
 // in the same directory as filename (same filesystem => atomic rename on Close).
-func NewCSVWriter(filename string) (*CSVWriter, error) {
-	if err := ensureDir(filename); err != nil {
+// The columns are fields, in order, or every field of models.BookFields.
+func NewCSVWriter(filename string, fields ...models.Field) (*CSVWriter, error) {
+	af, err := createAtomicFile(filename, "csv")
+	if err != nil {
 		return nil, err
 	}
 
-	dir := filepath.Dir(filename)
-	f, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".*.tmp")
-	if err != nil {
-		return nil, fmt.Errorf("create csv temp file: %w", err)
+	fields = outputFields(fields)
+	writer := csv.NewWriter(af)
+	header := make([]string, len(fields))
+	for i, f := range fields {
+		header[i] = f.Name
 	}
-
-	writer := csv.NewWriter(f)
-	header := []string{"title", "price", "rating", "rating_numeric", "availability", "image_url", "url", "scraped_at", "price_numeric"}
 	if err := writer.Write(header); err != nil {
-		_ = f.Close()
-		_ = os.Remove(f.Name())
+		af.abort()
 		return nil, fmt.Errorf("write csv header: %w", err)
 	}
 	writer.Flush()
 	if err := writer.Error(); err != nil {
-		_ = f.Close()
-		_ = os.Remove(f.Name())
+		af.abort()
 		return nil, fmt.Errorf("flush csv header: %w", err)
 	}
 
-	return &CSVWriter{
-		finalPath: filename,
-		tmpPath:   f.Name(),
-		file:      f,
-		writer:    writer,
-	}, nil
+	return &CSVWriter{atomicFile: af, writer: writer, fields: fields}, nil
 }
 
 // Write appends books to the CSV output.
@@ -66,16 +57,9 @@ func (cw *CSVWriter) Write(books []*models.Book) error {
 	defer cw.mu.Unlock()
 
 	for _, book := range books {
-		record := []string{
-			book.Title,
-			book.Price,
-			book.RatingText,
-			strconv.Itoa(book.RatingNumeric),
-			book.Availability,
-			book.ImageURL,
-			book.URL,
-			book.ScrapedAt.Format(time.RFC3339),
-			strconv.FormatFloat(book.PriceNumeric, 'f', 2, 64),
+		record := make([]string, len(cw.fields))
+		for i, f := range cw.fields {
+			record[i] = f.Text(book)
 		}
 		if err := cw.writer.Write(record); err != nil {
 			_ = os.Remove(cw.tmpPath)
@@ -99,66 +83,47 @@ func (cw *CSVWriter) Close() error {
 
 	cw.writer.Flush()
 	if err := cw.writer.Error(); err != nil {
-		_ = os.Remove(cw.tmpPath)
-		_ = cw.file.Close()
+		cw.abort()
 		return fmt.Errorf("flush csv writer: %w", err)
 	}
-	if err := cw.file.Close(); err != nil {
-		_ = os.Remove(cw.tmpPath)
-		return fmt.Errorf("close csv file: %w", err)
-	}
-	if err := os.Rename(cw.tmpPath, cw.finalPath); err != nil {
-		_ = os.Remove(cw.tmpPath)
-		return fmt.Errorf("rename csv file: %w", err)
-	}
-	return nil
+	return cw.commit()
 }
 
 // Validate ensures the temp file has content besides the header. The data lives
-// in the temp file until Close renames it onto the final path.
+// in the temp file until Close renames it onto the final path. A compressed
+// stream is finished and decompressed in full, so Validate must come after the
+// last Write.
 func (cw *CSVWriter) Validate() error {
-	info, err := cw.file.Stat()
-	if err != nil {
-		return fmt.Errorf("stat csv file: %w", err)
-	}
-	if info.Size() <= 0 {
-		return fmt.Errorf("csv file is empty")
-	}
-	return nil
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.validate()
 }
 
 // JSONWriter writes newline-delimited JSON records. Output is buffered in a temp
 // file and only renamed onto the final path on a successful Close, so a crash or
-// write error never leaves a half-written file at the final path.
+// write error never leaves a half-written file at the final path. A filename
+// ending in .gz or .zst is compressed with gzip or zstd.
 type JSONWriter struct {
-	finalPath string
-	tmpPath   string
-	file      *os.File
-	writer    *bufio.Writer
-	encoder   *json.Encoder
-	mu        sync.Mutex
+	*atomicFile
+	writer *bufio.Writer
+	fields []models.Field
+	record bytes.Buffer
+	mu     sync.Mutex
 }
 
 // NewJSONWriter initialises the JSON writer using a temp file in the same
-// directory as filename (same filesystem => atomic rename on Close).
-func NewJSONWriter(filename string) (*JSONWriter, error) {
-	if err := ensureDir(filename); err != nil {
-		return nil, err
-	}
-
-	dir := filepath.Dir(filename)
-	f, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".*.tmp")
+// directory as filename (same filesystem => atomic rename on Close). Records
+// hold fields, in order, or every field of models.BookFields.
+func NewJSONWriter(filename string, fields ...models.Field) (*JSONWriter, error) {
+	af, err := createAtomicFile(filename, "json")
 	if err != nil {
-		return nil, fmt.Errorf("create json temp file: %w", err)
+		return nil, err
 	}
 
-	buffer := bufio.NewWriter(f)
 	return &JSONWriter{
-		finalPath: filename,
-		tmpPath:   f.Name(),
-		file:      f,
-		writer:    buffer,
-		encoder:   json.NewEncoder(buffer),
+		atomicFile: af,
+		writer:     bufio.NewWriter(af),
+		fields:     outputFields(fields),
 	}, nil
 }
 
@@ -168,10 +133,16 @@ func (jw *JSONWriter) Write(books []*models.Book) error {
 	defer jw.mu.Unlock()
 
 	for _, book := range books {
-		if err := jw.encoder.Encode(book); err != nil {
+		jw.record.Reset()
+		if err := appendJSONRecord(&jw.record, book, jw.fields); err != nil {
 			_ = os.Remove(jw.tmpPath)
 			return fmt.Errorf("encode json record: %w", err)
 		}
+		jw.record.WriteByte('\n')
+		if _, err := jw.writer.Write(jw.record.Bytes()); err != nil {
+			_ = os.Remove(jw.tmpPath)
+			return fmt.Errorf("write json record: %w", err)
+		}
 	}
 
 	if err := jw.writer.Flush(); err != nil {
@@ -190,32 +161,19 @@ func (jw *JSONWriter) Close() error {
 	defer jw.mu.Unlock()
 
 	if err := jw.writer.Flush(); err != nil {
-		_ = os.Remove(jw.tmpPath)
-		_ = jw.file.Close()
+		jw.abort()
 		return fmt.Errorf("flush json writer: %w", err)
 	}
-	if err := jw.file.Close(); err != nil {
-		_ = os.Remove(jw.tmpPath)
-		return fmt.Errorf("close json file: %w", err)
-	}
-	if err := os.Rename(jw.tmpPath, jw.finalPath); err != nil {
-		_ = os.Remove(jw.tmpPath)
-		return fmt.Errorf("rename json file: %w", err)
-	}
-	return nil
+	return jw.commit()
 }
 
 // Validate ensures the temp file has data. The data lives in the temp file until
-// Close renames it onto the final path.
+// Close renames it onto the final path. A compressed stream is finished and
+// decompressed in full, so Validate must come after the last Write.
 func (jw *JSONWriter) Validate() error {
-	info, err := jw.file.Stat()
-	if err != nil {
-		return fmt.Errorf("stat json file: %w", err)
-	}
-	if info.Size() <= 0 {
-		return fmt.Errorf("json file is empty")
-	}
-	return nil
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	return jw.validate()
 }
 
 func ensureDir(filename string) error {
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -53,8 +54,10 @@ func TestCSVWriterWrite(t *testing.T) {
 	if len(records) != 2 {
 		t.Fatalf("records=%d, want 2", len(records))
 	}
-	if records[0][0] != "title" || records[0][1] != "price" {
-		t.Fatalf("unexpected header: %v", records[0])
+	// Existing columns keep their positions; new fields are appended.
+	wantHeader := "title,price,rating,rating_numeric,availability,image_url,url,scraped_at,price_numeric,source,currency,isbn"
+	if got := strings.Join(records[0], ","); got != wantHeader {
+		t.Fatalf("header = %s, want %s", got, wantHeader)
 	}
 }
 
@@ -108,14 +111,28 @@ func TestJSONWriterWrite(t *testing.T) {
 	}
 }
 
-func TestDualWriterWrite(t *testing.T) {
+// newCSVAndJSONWriter fans out to a CSV and a JSON writer, both fail-fast.
+func newCSVAndJSONWriter(csvPath, jsonPath string) (*MultiWriter, error) {
+	csvWriter, err := NewCSVWriter(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	jsonWriter, err := NewJSONWriter(jsonPath)
+	if err != nil {
+		_ = csvWriter.Close()
+		return nil, err
+	}
+	return NewMultiWriter(Sink{Name: csvPath, Writer: csvWriter}, Sink{Name: jsonPath, Writer: jsonWriter})
+}
+
+func TestMultiWriterWrite(t *testing.T) {
 	dir := t.TempDir()
 	csvPath := filepath.Join(dir, "books.csv")
 	jsonPath := filepath.Join(dir, "books.jsonl")
 
-	writer, err := NewDualWriter(csvPath, jsonPath)
+	writer, err := newCSVAndJSONWriter(csvPath, jsonPath)
 	if err != nil {
-		t.Fatalf("create dual writer: %v", err)
+		t.Fatalf("create multi writer: %v", err)
 	}
 
 	book := &models.Book{
@@ -130,10 +147,10 @@ func TestDualWriterWrite(t *testing.T) {
 	}
 
 	if err := writer.Write([]*models.Book{book}); err != nil {
-		t.Fatalf("write dual: %v", err)
+		t.Fatalf("write multi: %v", err)
 	}
 	if err := writer.Close(); err != nil {
-		t.Fatalf("close dual: %v", err)
+		t.Fatalf("close multi: %v", err)
 	}
 
 	if info, err := os.Stat(csvPath); err != nil || info.Size() == 0 {
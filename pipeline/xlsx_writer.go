@@ -0,0 +1,414 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// Sheet names of the workbooks XLSXWriter writes.
+const (
+	XLSXBooksSheet   = "Books"
+	XLSXSummarySheet = "Summary"
+)
+
+// maxHyperlinkLen is the longest URL written as a HYPERLINK formula; Excel
+// rejects longer string literals in formulas, so those stay plain text.
+const maxHyperlinkLen = 255
+
+// XLSXWriter writes an Excel workbook with a Books sheet of typed cells, one
+// row per record: numbers stay numeric, timestamps are date cells and URLs
+// are hyperlinks, under a frozen header with an autofilter. Rows are streamed
+// to disk as they are written, so memory stays bounded whatever the number of
+// records. Given a RunSummary before Validate, it adds a Summary sheet.
+//
+// The workbook is assembled and buffered in a temp file when Validate or
+// Close finishes it, then renamed onto the final path by Close. Until then
+// Size reports nothing, so byte-based rotation does not apply.
+type XLSXWriter struct {
+	*atomicFile
+	file     *excelize.File
+	stream   *excelize.StreamWriter
+	fields   []models.Field
+	styles   xlsxStyles
+	rows     int // written so far, header included
+	summary  *RunSummary
+	finished bool // workbook written by Validate; no more writes
+	mu       sync.Mutex
+}
+
+type xlsxStyles struct {
+	header, date, decimal, link int
+}
+
+// NewXLSXWriter initialises the XLSX writer and writes the header row. The
+// columns are fields, in order, or every field of models.BookFields.
+func NewXLSXWriter(filename string, fields ...models.Field) (*XLSXWriter, error) {
+	af, err := createAtomicFile(filename, "xlsx")
+	if err != nil {
+		return nil, err
+	}
+	xw := &XLSXWriter{atomicFile: af, file: excelize.NewFile(), fields: outputFields(fields)}
+	if err := xw.start(); err != nil {
+		_ = xw.file.Close()
+		af.abort()
+		return nil, err
+	}
+	return xw, nil
+}
+
+// start sets up the Books sheet: styles, column widths, the frozen header.
+func (xw *XLSXWriter) start() error {
+	if err := xw.file.SetSheetName("Sheet1", XLSXBooksSheet); err != nil {
+		return fmt.Errorf("create xlsx sheet: %w", err)
+	}
+	if err := xw.newStyles(); err != nil {
+		return fmt.Errorf("create xlsx styles: %w", err)
+	}
+	stream, err := xw.file.NewStreamWriter(XLSXBooksSheet)
+	if err != nil {
+		return fmt.Errorf("create xlsx stream: %w", err)
+	}
+	xw.stream = stream
+
+	for i, f := range xw.fields {
+		if err := stream.SetColWidth(i+1, i+1, columnWidth(f)); err != nil {
+			return fmt.Errorf("set xlsx column width: %w", err)
+		}
+	}
+	if err := stream.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return fmt.Errorf("freeze xlsx header: %w", err)
+	}
+	header := make([]any, len(xw.fields))
+	for i, f := range xw.fields {
+		header[i] = excelize.Cell{StyleID: xw.styles.header, Value: f.Name}
+	}
+	return xw.setRow(header)
+}
+
+func (xw *XLSXWriter) newStyles() error {
+	var err error
+	dateFormat := "yyyy-mm-dd hh:mm:ss"
+	styles := []struct {
+		id    *int
+		style *excelize.Style
+	}{
+		{&xw.styles.header, &excelize.Style{
+			Font: &excelize.Font{Bold: true},
+			Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"D9E1F2"}},
+		}},
+		{&xw.styles.date, &excelize.Style{CustomNumFmt: &dateFormat}},
+		{&xw.styles.decimal, &excelize.Style{NumFmt: 2}},
+		{&xw.styles.link, &excelize.Style{Font: &excelize.Font{Color: "0563C1", Underline: "single"}}},
+	}
+	for _, s := range styles {
+		if *s.id, err = xw.file.NewStyle(s.style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func columnWidth(f models.Field) float64 {
+	switch {
+	case isURLField(f):
+		return 50
+	case f.Name == "title":
+		return 40
+	case f.Type == models.FieldTime:
+		return 20
+	default:
+		return 14
+	}
+}
+
+func isURLField(f models.Field) bool {
+	return f.Type == models.FieldString && (f.Name == "url" || strings.HasSuffix(f.Name, "_url"))
+}
+
+func (xw *XLSXWriter) setRow(values []any) error {
+	cell, err := excelize.CoordinatesToCellName(1, xw.rows+1)
+	if err != nil {
+		return err
+	}
+	if err := xw.stream.SetRow(cell, values); err != nil {
+		return fmt.Errorf("write xlsx row: %w", err)
+	}
+	xw.rows++
+	return nil
+}
+
+// Write appends one row per book to the Books sheet.
+func (xw *XLSXWriter) Write(books []*models.Book) error {
+	xw.mu.Lock()
+	defer xw.mu.Unlock()
+	if xw.finished {
+		return errors.New("write xlsx file: workbook already finished by Validate")
+	}
+
+	for _, book := range books {
+		row := make([]any, len(xw.fields))
+		for i, f := range xw.fields {
+			row[i] = xw.cell(f, book)
+		}
+		if err := xw.setRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cell returns the typed cell of the field f of book.
+func (xw *XLSXWriter) cell(f models.Field, book *models.Book) any {
+	switch v := f.Value(book).(type) {
+	case float64:
+		return excelize.Cell{StyleID: xw.styles.decimal, Value: v}
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		return excelize.Cell{StyleID: xw.styles.date, Value: v.UTC()}
+	case string:
+		if isURLField(f) && v != "" && len(v) <= maxHyperlinkLen {
+			formula := `HYPERLINK("` + strings.ReplaceAll(v, `"`, `""`) + `")`
+			return excelize.Cell{StyleID: xw.styles.link, Value: v, Formula: formula}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// SetSummary records the run summary for the Summary sheet.
+func (xw *XLSXWriter) SetSummary(s RunSummary) {
+	xw.mu.Lock()
+	defer xw.mu.Unlock()
+	xw.summary = &s
+}
+
+// finish ends the Books sheet, adds the Summary sheet and writes the
+// workbook to the temp file.
+func (xw *XLSXWriter) finish() error {
+	if xw.finished {
+		return nil
+	}
+	xw.finished = true
+	defer func() { _ = xw.file.Close() }()
+
+	if xw.rows > 1 {
+		last, err := excelize.CoordinatesToCellName(len(xw.fields), xw.rows)
+		if err != nil {
+			return err
+		}
+		if err := xw.stream.AddTable(&excelize.Table{Range: "A1:" + last, Name: XLSXBooksSheet, StyleName: "TableStyleLight1"}); err != nil {
+			return fmt.Errorf("add xlsx autofilter: %w", err)
+		}
+	}
+	if err := xw.stream.Flush(); err != nil {
+		return fmt.Errorf("flush xlsx stream: %w", err)
+	}
+	if xw.summary != nil {
+		if err := xw.writeSummary(); err != nil {
+			return fmt.Errorf("write xlsx summary: %w", err)
+		}
+	}
+	if err := xw.file.Write(xw.atomicFile); err != nil {
+		return fmt.Errorf("write xlsx file: %w", err)
+	}
+	return nil
+}
+
+// summaryRows lays out s as rows of the Summary sheet: run metrics, then a
+// table of per-site counts.
+func summaryRows(s *RunSummary) [][]any {
+	rows := [][]any{{"Metric", "Value"}}
+	for _, m := range s.metrics() {
+		rows = append(rows, []any{m.Name, m.Value})
+	}
+	if sites := s.sites(); len(sites) > 0 {
+		rows = append(rows, nil, []any{"Site", "Pages", "Requests", "Books", "Errors", "Retries"})
+		for _, d := range sites {
+			rows = append(rows, []any{d.Name, d.PageCount, d.RequestCount, d.ItemCount, d.ErrorCount, d.RetryCount})
+		}
+	}
+	return rows
+}
+
+// writeSummary fills the Summary sheet from the run summary.
+func (xw *XLSXWriter) writeSummary() error {
+	if _, err := xw.file.NewSheet(XLSXSummarySheet); err != nil {
+		return err
+	}
+	for i, row := range summaryRows(xw.summary) {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		if err := xw.file.SetSheetRow(XLSXSummarySheet, cell, &row); err != nil {
+			return err
+		}
+		style := 0
+		switch {
+		case i == 0 || (len(row) > 0 && row[0] == "Site"):
+			style = xw.styles.header
+		case len(row) > 1:
+			if _, ok := row[1].(time.Time); ok {
+				style = xw.styles.date
+			}
+		}
+		if style != 0 {
+			end, _ := excelize.CoordinatesToCellName(max(len(row), 1), i+1)
+			if err := xw.file.SetCellStyle(XLSXSummarySheet, cell, end, style); err != nil {
+				return err
+			}
+		}
+	}
+	return xw.file.SetColWidth(XLSXSummarySheet, "A", "A", 24)
+}
+
+// Close finishes the workbook, closes the temp file, and atomically renames
+// it onto the final path. On any error the temp file is removed (best-effort)
+// and the final path is left untouched.
+func (xw *XLSXWriter) Close() error {
+	xw.mu.Lock()
+	defer xw.mu.Unlock()
+	if err := xw.finish(); err != nil {
+		xw.abort()
+		return err
+	}
+	return xw.commit()
+}
+
+// Abort discards the workbook, leaving the final path untouched.
+func (xw *XLSXWriter) Abort() {
+	xw.mu.Lock()
+	defer xw.mu.Unlock()
+	if !xw.finished {
+		xw.finished = true
+		_ = xw.file.Close()
+	}
+	xw.abort()
+}
+
+// Validate finishes the workbook and ensures the temp file has data, so it
+// must come after the last Write and SetSummary.
+func (xw *XLSXWriter) Validate() error {
+	xw.mu.Lock()
+	defer xw.mu.Unlock()
+	if err := xw.finish(); err != nil {
+		return err
+	}
+	return xw.validate()
+}
+
+// XLSXReader reads the Books sheet of workbooks written by XLSXWriter.
+// Columns are matched by header name, like CSVReader.
+type XLSXReader struct {
+	file    *excelize.File
+	rows    *excelize.Rows
+	columns map[string]int
+	line    int
+}
+
+// NewXLSXReader opens filename and reads the header row of its Books sheet.
+func NewXLSXReader(filename string) (*XLSXReader, error) {
+	in, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx file: %w", err)
+	}
+	file, err := excelize.OpenReader(in)
+	_ = in.Close()
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx file: %w", err)
+	}
+	rows, err := file.Rows(XLSXBooksSheet)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("open xlsx sheet: %w", err)
+	}
+	xr := &XLSXReader{file: file, rows: rows}
+	header, err := xr.next()
+	if err != nil {
+		_ = xr.Close()
+		if errors.Is(err, io.EOF) {
+			err = errors.New("no header row")
+		}
+		return nil, fmt.Errorf("read xlsx header: %w", err)
+	}
+	xr.columns = make(map[string]int, len(header))
+	for i, name := range header {
+		xr.columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := xr.columns["url"]; !ok {
+		_ = xr.Close()
+		return nil, fmt.Errorf("xlsx file %s has no url column", filename)
+	}
+	return xr, nil
+}
+
+// next returns the raw cell values of the next row.
+func (xr *XLSXReader) next() ([]string, error) {
+	if !xr.rows.Next() {
+		if err := xr.rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	xr.line++
+	return xr.rows.Columns(excelize.Options{RawCellValue: true})
+}
+
+// Read returns the next record.
+func (xr *XLSXReader) Read() (*models.Book, error) {
+	row, err := xr.next()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read xlsx row: %w", err)
+	}
+	book := &models.Book{}
+	for _, f := range models.BookFields {
+		i, ok := xr.columns[f.Name]
+		if !ok || i >= len(row) || row[i] == "" {
+			continue
+		}
+		if f.Type == models.FieldTime {
+			err = setExcelTime(f, book, row[i])
+		} else {
+			err = f.SetText(book, row[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xlsx row %d: invalid %s: %w", xr.line, f.Name, err)
+		}
+	}
+	return book, nil
+}
+
+// setExcelTime parses a date cell, a serial number of days, into the field f
+// of book, to the millisecond.
+func setExcelTime(f models.Field, book *models.Book, serial string) error {
+	days, err := strconv.ParseFloat(serial, 64)
+	if err != nil {
+		return err
+	}
+	t, err := excelize.ExcelDateToTime(days, false)
+	if err != nil {
+		return err
+	}
+	return f.SetValue(book, t.Round(time.Millisecond).UTC())
+}
+
+// Close releases the workbook.
+func (xr *XLSXReader) Close() error {
+	_ = xr.rows.Close()
+	return xr.file.Close()
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+func TestXLSXWriter_Workbook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.xlsx")
+	writer, err := NewXLSXWriter(path)
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	books := []*models.Book{
+		{Title: "One", PriceNumeric: 12.5, RatingNumeric: 3, URL: "http://example.test/one", ScrapedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{Title: "Two", PriceNumeric: 7, RatingNumeric: 5, URL: "http://example.test/" + strings.Repeat("x", maxHyperlinkLen)},
+	}
+	if err := writer.Write(books); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	writer.SetSummary(RunSummary{
+		Result: &models.ScraperResult{
+			StartTime:    start,
+			EndTime:      start.Add(90 * time.Second),
+			PageCount:    4,
+			RequestCount: 5,
+			Domains:      map[string]models.DomainResult{"example.test": {PageCount: 4, ItemCount: 2}},
+		},
+		Stats: PipelineStats{Processed: 2, ValidationErrors: map[string]int{"missing_title": 1}},
+	})
+	if err := writer.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := writer.Write(books); err == nil {
+		t.Error("write after validate succeeded, want an error")
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatalf("open workbook: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if got := f.GetSheetList(); len(got) != 2 || got[0] != XLSXBooksSheet || got[1] != XLSXSummarySheet {
+		t.Errorf("sheets = %v, want [%s %s]", got, XLSXBooksSheet, XLSXSummarySheet)
+	}
+	panes, err := f.GetPanes(XLSXBooksSheet)
+	if err != nil || !panes.Freeze || panes.YSplit != 1 {
+		t.Errorf("panes = %+v, %v; want the header row frozen", panes, err)
+	}
+	tables, err := f.GetTables(XLSXBooksSheet)
+	if err != nil || len(tables) != 1 || !strings.HasPrefix(tables[0].Range, "A1:") {
+		t.Errorf("tables = %+v, %v; want one autofilter table over the rows", tables, err)
+	}
+
+	cell := func(field string, row int) string {
+		t.Helper()
+		i := 0
+		for i < len(models.BookFields) && models.BookFields[i].Name != field {
+			i++
+		}
+		name, _ := excelize.CoordinatesToCellName(i+1, row)
+		return name
+	}
+	for _, tc := range []struct {
+		cell, want string
+	}{
+		{cell("price_numeric", 2), "12.5"},
+		{cell("rating_numeric", 2), "3"},
+		{cell("scraped_at", 2), "45293.12783564815"},
+	} {
+		if got, err := f.GetCellValue(XLSXBooksSheet, tc.cell, excelize.Options{RawCellValue: true}); err != nil || got != tc.want {
+			t.Errorf("cell %s = %q, %v; want the number %s", tc.cell, got, err, tc.want)
+		}
+	}
+	if got, _ := f.GetCellValue(XLSXBooksSheet, cell("scraped_at", 2)); got != "2024-01-02 03:04:05" {
+		t.Errorf("scraped_at = %q, want a formatted date", got)
+	}
+	if got, _ := f.GetCellFormula(XLSXBooksSheet, cell("url", 2)); got != `HYPERLINK("http://example.test/one")` {
+		t.Errorf("url formula = %q, want a hyperlink", got)
+	}
+	if got, _ := f.GetCellFormula(XLSXBooksSheet, cell("url", 3)); got != "" {
+		t.Errorf("long url formula = %q, want plain text", got)
+	}
+
+	summary, err := f.GetRows(XLSXSummarySheet)
+	if err != nil {
+		t.Fatalf("read summary: %v", err)
+	}
+	values := map[string]string{}
+	for _, row := range summary {
+		if len(row) > 1 {
+			values[row[0]] = row[1]
+		}
+	}
+	for metric, want := range map[string]string{"Pages": "4", "Duration (s)": "90", "Books written": "2", "Rejected: missing_title": "1", "example.test": "4"} {
+		if values[metric] != want {
+			t.Errorf("summary %s = %q, want %q", metric, values[metric], want)
+		}
+	}
+}
+
+func TestXLSXWriter_NoSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.xlsx")
+	writer, err := NewXLSXWriter(path)
+	if err != nil {
+		t.Fatalf("create writer: %v", err)
+	}
+	if err := writer.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatalf("open workbook: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	if got := f.GetSheetList(); len(got) != 1 || got[0] != XLSXBooksSheet {
+		t.Errorf("sheets = %v, want only %s", got, XLSXBooksSheet)
+	}
+	if books, err := ReadAll(path); err != nil || len(books) != 0 {
+		t.Errorf("ReadAll = %d books, %v; want none", len(books), err)
+	}
+}
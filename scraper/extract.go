@@ -8,38 +8,56 @@ import (
 	"github.com/gocolly/colly/v2"
 )
 
-// extractBook parses a single product listing element into a Book. It
-// returns nil when the element is missing the fields required to identify
-// the book (title, link).
-func extractBook(e *colly.HTMLElement) *models.Book {
-	title := strings.TrimSpace(e.ChildAttr("h3 a", "title"))
+// extractBook parses a single product listing element into a Book using the
+// selectors from profile. It returns nil when the element is missing the
+// fields required to identify the book (title, link).
+func extractBook(e *colly.HTMLElement, profile Profile) *models.Book {
+	title := ""
+	if profile.TitleAttr != "" {
+		title = strings.TrimSpace(e.ChildAttr(profile.Title, profile.TitleAttr))
+	}
+	if title == "" {
+		title = strings.TrimSpace(e.ChildText(profile.Title))
+	}
 	if title == "" {
 		return nil
 	}
 
-	href := e.ChildAttr("h3 a", "href")
+	href := e.ChildAttr(profile.Title, "href")
 	if href == "" {
 		return nil
 	}
 
 	bookURL := e.Request.AbsoluteURL(href)
-	priceText := strings.TrimSpace(e.ChildText("p.price_color"))
+	priceText := ""
+	if profile.Price != "" {
+		priceText = strings.TrimSpace(e.ChildText(profile.Price))
+	}
 
-	ratingClass := e.ChildAttr("p.star-rating", "class")
 	ratingText := ""
-	if ratingClass != "" {
-		parts := strings.Fields(ratingClass)
+	if profile.Rating != "" {
+		parts := strings.Fields(e.ChildAttr(profile.Rating, "class"))
 		if len(parts) > 1 {
 			ratingText = parts[1]
 		}
 	}
 
-	availability := strings.TrimSpace(e.ChildText("p.instock.availability"))
-	if availability == "" {
-		availability = strings.TrimSpace(e.ChildText("p.availability"))
+	availability := ""
+	for _, selector := range profile.Availability {
+		availability = strings.TrimSpace(e.ChildText(selector))
+		if availability != "" {
+			break
+		}
 	}
 
-	imageURL := e.Request.AbsoluteURL(e.ChildAttr("img", "src"))
+	// AbsoluteURL("") resolves to the page itself, which would hide a missing
+	// image from the fill-rate health checks.
+	imageURL := ""
+	if profile.Image != "" {
+		if src := e.ChildAttr(profile.Image, "src"); src != "" {
+			imageURL = e.Request.AbsoluteURL(src)
+		}
+	}
 
 	return &models.Book{
 		Title:        title,
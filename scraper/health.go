@@ -0,0 +1,244 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+)
+
+// healthFields are the optional book fields whose fill rate is tracked. A drop
+// in any of them usually means a selector stopped matching.
+var healthFields = []string{"price", "rating", "image"}
+
+// pageItemsCtxKey counts the items emitted for the current page on the colly
+// request context.
+const pageItemsCtxKey = "page_items"
+
+// healthTracker accumulates per-site extraction statistics during a crawl.
+type healthTracker struct {
+	mu            sync.Mutex
+	pages         int
+	items         int
+	zeroItemPages []string
+	missing       map[string]int
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{missing: make(map[string]int)}
+}
+
+// observeBook records which tracked fields book is missing.
+func (h *healthTracker) observeBook(book *models.Book) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.items++
+	if book.Price == "" {
+		h.missing["price"]++
+	}
+	if book.RatingText == "" {
+		h.missing["rating"]++
+	}
+	if book.ImageURL == "" {
+		h.missing["image"]++
+	}
+}
+
+// observePage records one scraped HTML page and the items it yielded.
+func (h *healthTracker) observePage(url string, items int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pages++
+	if items == 0 {
+		h.zeroItemPages = append(h.zeroItemPages, url)
+	}
+}
+
+// fillRates returns the fraction of observed books that had each field.
+func (h *healthTracker) fillRates() map[string]float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rates := make(map[string]float64, len(healthFields))
+	if h.items == 0 {
+		return rates
+	}
+	for _, field := range healthFields {
+		rates[field] = 1 - float64(h.missing[field])/float64(h.items)
+	}
+	return rates
+}
+
+// fill copies the tracked statistics onto a domain result.
+func (h *healthTracker) fill(d *models.DomainResult) {
+	rates := h.fillRates()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d.ListingPages = h.pages
+	d.ZeroItemPages = append([]string(nil), h.zeroItemPages...)
+	if h.pages > 0 {
+		d.ItemsPerPage = float64(h.items) / float64(h.pages)
+	}
+	d.FillRates = rates
+}
+
+// HealthBaseline is the stored extraction profile of a known-good run that
+// later runs are compared against.
+type HealthBaseline struct {
+	Domains map[string]DomainBaseline `json:"domains"`
+}
+
+// DomainBaseline holds the expected extraction statistics for one site.
+type DomainBaseline struct {
+	ItemsPerPage float64            `json:"items_per_page"`
+	FillRates    map[string]float64 `json:"fill_rates"`
+}
+
+// LoadHealthBaseline reads a baseline file. A missing file yields an empty
+// baseline so the first run can create it.
+func LoadHealthBaseline(path string) (*HealthBaseline, error) {
+	baseline := &HealthBaseline{Domains: make(map[string]DomainBaseline)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return baseline, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read health baseline: %w", err)
+	}
+	if err := json.Unmarshal(data, baseline); err != nil {
+		return nil, fmt.Errorf("parse health baseline %s: %w", path, err)
+	}
+	if baseline.Domains == nil {
+		baseline.Domains = make(map[string]DomainBaseline)
+	}
+	return baseline, nil
+}
+
+// Update replaces the baseline of every domain in result with its observed
+// statistics. Domains that produced no items keep their previous baseline so
+// a broken run cannot become the new normal.
+func (b *HealthBaseline) Update(result *models.ScraperResult) {
+	for name, d := range result.Domains {
+		if d.ItemCount == 0 {
+			continue
+		}
+		b.Domains[name] = DomainBaseline{ItemsPerPage: d.ItemsPerPage, FillRates: d.FillRates}
+	}
+}
+
+// Save writes the baseline to path via a temp file and rename.
+func (b *HealthBaseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode health baseline: %w", err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create directory %q: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create health baseline temp file: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("write health baseline: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("close health baseline: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("rename health baseline: %w", err)
+	}
+	return nil
+}
+
+// CheckHealth compares result against baseline (which may be nil) and returns
+// every extraction warning: pages that yielded no items, sites that yielded
+// nothing at all, and items-per-page or field fill rates more than tolerance
+// (a fraction, e.g. 0.1) below the baseline. Each warning is logged, counted
+// in the scraper metrics, and appended to result.Warnings.
+func (s *Scraper) CheckHealth(result *models.ScraperResult, baseline *HealthBaseline, tolerance float64) []models.ExtractionWarning {
+	names := make([]string, 0, len(result.Domains))
+	for name := range result.Domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []models.ExtractionWarning
+	for _, name := range names {
+		d := result.Domains[name]
+		for _, url := range d.ZeroItemPages {
+			warnings = append(warnings, models.ExtractionWarning{
+				Domain:  name,
+				Kind:    "zero_items",
+				URL:     url,
+				Message: "page yielded no items",
+			})
+		}
+		if d.ItemCount == 0 && d.ListingPages > 0 {
+			warnings = append(warnings, models.ExtractionWarning{
+				Domain:  name,
+				Kind:    "no_items",
+				Message: "site yielded no items",
+			})
+			continue
+		}
+
+		if baseline == nil {
+			continue
+		}
+		expected, ok := baseline.Domains[name]
+		if !ok {
+			continue
+		}
+		if expected.ItemsPerPage > 0 && d.ItemsPerPage < expected.ItemsPerPage*(1-tolerance) {
+			warnings = append(warnings, models.ExtractionWarning{
+				Domain:   name,
+				Kind:     "items_per_page_drop",
+				Value:    d.ItemsPerPage,
+				Baseline: expected.ItemsPerPage,
+				Message:  "items per page dropped below baseline",
+			})
+		}
+		for _, field := range healthFields {
+			want, ok := expected.FillRates[field]
+			if !ok {
+				continue
+			}
+			if got := d.FillRates[field]; got < want-tolerance {
+				warnings = append(warnings, models.ExtractionWarning{
+					Domain:   name,
+					Kind:     "fill_rate_drop",
+					Field:    field,
+					Value:    got,
+					Baseline: want,
+					Message:  "field fill rate dropped below baseline",
+				})
+			}
+		}
+	}
+
+	for _, w := range warnings {
+		slog.Warn("extraction health",
+			slog.String("domain", w.Domain),
+			slog.String("kind", w.Kind),
+			slog.String("field", w.Field),
+			slog.String("url", w.URL),
+			slog.Float64("value", w.Value),
+			slog.Float64("baseline", w.Baseline),
+			slog.String("message", w.Message),
+		)
+		s.Metrics.IncExtractionWarning(w.Domain, w.Kind)
+	}
+	result.Warnings = append(result.Warnings, warnings...)
+	return warnings
+}
@@ -0,0 +1,131 @@
+package scraper
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestScraper_TracksExtractionHealth(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.BaseURL = "http://example.test/"
+	cfg.RespectRobotsTxt = false
+	cfg.MaxPages = 2
+
+	// Page 1 is healthy; page 2 has drifted markup and yields nothing.
+	transport := httpmock.NewMockTransport()
+	transport.RegisterResponder("GET", "http://example.test/", htmlResponder(buildCatalogPage(1, true)))
+	transport.RegisterResponder("GET", "http://example.test/page-2.html", htmlResponder("<html><body><div class=\"product\"></div></body></html>"))
+
+	s, err := NewScraper(cfg)
+	if err != nil {
+		t.Fatalf("new scraper: %v", err)
+	}
+	s.setTransport(transport)
+
+	writer := &collectingWriter{}
+	p := pipeline.NewPipeline(context.Background(), writer, cfg)
+	p.Start(1)
+	result, err := s.Run(context.Background(), p)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close pipeline: %v", err)
+	}
+
+	d := result.Domains["example.test"]
+	if d.ListingPages != 2 || d.ItemsPerPage != 10 {
+		t.Fatalf("pages=%d items/page=%v, want 2 and 10", d.ListingPages, d.ItemsPerPage)
+	}
+	if len(d.ZeroItemPages) != 1 || d.ZeroItemPages[0] != "http://example.test/page-2.html" {
+		t.Fatalf("zero item pages = %v", d.ZeroItemPages)
+	}
+	if d.FillRates["price"] != 1 || d.FillRates["image"] != 1 {
+		t.Fatalf("fill rates = %v", d.FillRates)
+	}
+	if got := counterValue(t, s.Metrics.ZeroItemPagesTotal.WithLabelValues("example.test")); got != 1 {
+		t.Fatalf("zero item pages metric = %v, want 1", got)
+	}
+
+	warnings := s.CheckHealth(result, nil, 0.1)
+	if len(warnings) != 1 || warnings[0].Kind != "zero_items" {
+		t.Fatalf("warnings = %+v, want one zero_items", warnings)
+	}
+	if len(result.Warnings) != 1 {
+		t.Fatalf("result warnings = %d, want 1", len(result.Warnings))
+	}
+}
+
+func TestCheckHealth_BaselineDrift(t *testing.T) {
+	s := &Scraper{Metrics: NewMetrics()}
+	baseline := &HealthBaseline{Domains: map[string]DomainBaseline{
+		"a": {ItemsPerPage: 20, FillRates: map[string]float64{"price": 1, "rating": 1, "image": 0.5}},
+	}}
+	result := &models.ScraperResult{Domains: map[string]models.DomainResult{
+		"a": {ItemCount: 30, ListingPages: 2, ItemsPerPage: 15, FillRates: map[string]float64{"price": 0.95, "rating": 0.4, "image": 0.5}},
+		"b": {ItemCount: 0, ListingPages: 1, ZeroItemPages: []string{"http://b/"}},
+	}}
+
+	warnings := s.CheckHealth(result, baseline, 0.1)
+	kinds := make(map[string]int)
+	for _, w := range warnings {
+		kinds[w.Kind]++
+		if w.Kind == "fill_rate_drop" && w.Field != "rating" {
+			t.Fatalf("unexpected fill rate warning for %q", w.Field)
+		}
+	}
+	want := map[string]int{"items_per_page_drop": 1, "fill_rate_drop": 1, "zero_items": 1, "no_items": 1}
+	for kind, n := range want {
+		if kinds[kind] != n {
+			t.Fatalf("warnings by kind = %v, want %v", kinds, want)
+		}
+	}
+	if got := counterValue(t, s.Metrics.ExtractionWarningsTotal.WithLabelValues("a", "fill_rate_drop")); got != 1 {
+		t.Fatalf("warning metric = %v, want 1", got)
+	}
+}
+
+func TestHealthBaselineRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "baseline.json")
+
+	baseline, err := LoadHealthBaseline(path)
+	if err != nil {
+		t.Fatalf("load missing baseline: %v", err)
+	}
+	baseline.Update(&models.ScraperResult{Domains: map[string]models.DomainResult{
+		"a":      {ItemCount: 20, ItemsPerPage: 20, FillRates: map[string]float64{"price": 1}},
+		"broken": {ItemCount: 0},
+	}})
+	if err := baseline.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, err := LoadHealthBaseline(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, ok := loaded.Domains["broken"]; ok {
+		t.Fatalf("domain without items should not enter the baseline")
+	}
+	if got := loaded.Domains["a"]; got.ItemsPerPage != 20 || got.FillRates["price"] != 1 {
+		t.Fatalf("loaded baseline = %+v", got)
+	}
+}
+
+// counterValue reads the current value of c.
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,68 @@
+package scraper
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/gocolly/colly/v2"
+)
+
+// latencyRecordedCtxKey marks a request whose latency has been recorded, so
+// an OnError after OnResponse (e.g. an HTML parse error) does not count it
+// twice.
+const latencyRecordedCtxKey = "latency_recorded"
+
+// latencyRecorder keeps every request latency of a crawl so exact percentiles
+// can be reported. A duration is 8 bytes, so even long crawls stay small.
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+// observe records the latency of the request ctx belongs to, measured from
+// its OnRequest, once per request. It returns the latency and whether it was
+// recorded by this call.
+func (lr *latencyRecorder) observe(ctx *colly.Context) (time.Duration, bool) {
+	start, ok := ctx.GetAny("start").(time.Time)
+	if !ok || ctx.GetAny(latencyRecordedCtxKey) != nil {
+		return 0, false
+	}
+	ctx.Put(latencyRecordedCtxKey, true)
+	d := time.Since(start)
+	lr.mu.Lock()
+	lr.samples = append(lr.samples, d)
+	lr.mu.Unlock()
+	return d, true
+}
+
+// summary returns the mean, nearest-rank percentiles and maximum of the
+// recorded latencies.
+func (lr *latencyRecorder) summary() models.LatencySummary {
+	lr.mu.Lock()
+	sorted := append([]time.Duration(nil), lr.samples...)
+	lr.mu.Unlock()
+	if len(sorted) == 0 {
+		return models.LatencySummary{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	percentile := func(p int) time.Duration {
+		rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+		return sorted[max(rank, 1)-1]
+	}
+	return models.LatencySummary{
+		Count: len(sorted),
+		Mean:  total / time.Duration(len(sorted)),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P95:   percentile(95),
+		P99:   percentile(99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,32 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestLatencyRecorderSummary(t *testing.T) {
+	var lr latencyRecorder
+	if got := lr.summary(); got.Count != 0 {
+		t.Fatalf("empty summary = %+v", got)
+	}
+	for i := 100; i >= 1; i-- {
+		lr.samples = append(lr.samples, time.Duration(i)*time.Millisecond)
+	}
+	got := lr.summary()
+	if got.Count != 100 || got.P50 != 50*time.Millisecond || got.P90 != 90*time.Millisecond ||
+		got.P99 != 99*time.Millisecond || got.Max != 100*time.Millisecond || got.Mean != 50500*time.Microsecond {
+		t.Fatalf("summary = %+v", got)
+	}
+
+	ctx := colly.NewContext()
+	ctx.Put("start", time.Now())
+	if _, ok := lr.observe(ctx); !ok {
+		t.Fatal("first observation of a request should be recorded")
+	}
+	if _, ok := lr.observe(ctx); ok {
+		t.Fatal("a request's latency should be recorded only once")
+	}
+}
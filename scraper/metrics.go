@@ -6,14 +6,20 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-// Metrics bundles Prometheus collectors for the scraper.
+// Metrics bundles Prometheus collectors for the scraper. Every collector is
+// labelled by domain (the site name) so multi-site crawls can be broken down.
 type Metrics struct {
 	Registry          *prometheus.Registry
 	RequestsTotal     *prometheus.CounterVec
-	RequestDuration   prometheus.Histogram
-	ItemsScrapedTotal prometheus.Counter
-	RetriesTotal      prometheus.Counter
+	RequestDuration   *prometheus.HistogramVec
+	ItemsScrapedTotal *prometheus.CounterVec
+	RetriesTotal      *prometheus.CounterVec
 	ErrorsTotal       *prometheus.CounterVec
+
+	PageItems               *prometheus.HistogramVec
+	ZeroItemPagesTotal      *prometheus.CounterVec
+	FieldFillRatio          *prometheus.GaugeVec
+	ExtractionWarningsTotal *prometheus.CounterVec
 }
 
 // NewMetrics constructs and registers all metrics on a dedicated registry.
@@ -25,36 +31,70 @@ func NewMetrics() *Metrics {
 			Name: "scraper_requests_total",
 			Help: "Total HTTP requests issued by the scraper.",
 		},
-		[]string{"phase"},
+		[]string{"domain", "phase"},
 	)
-	requestDuration := prometheus.NewHistogram(
+	requestDuration := prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "scraper_request_duration_seconds",
 			Help:    "HTTP request latency for scraper requests.",
 			Buckets: prometheus.DefBuckets,
 		},
+		[]string{"domain"},
 	)
-	itemsScraped := prometheus.NewCounter(
+	itemsScraped := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "scraper_items_scraped_total",
 			Help: "Total number of items sent to the pipeline.",
 		},
+		[]string{"domain"},
 	)
-	retries := prometheus.NewCounter(
+	retries := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "scraper_retries_total",
 			Help: "Total number of retry attempts scheduled.",
 		},
+		[]string{"domain"},
 	)
 	errorsTotal := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "scraper_errors_total",
 			Help: "Total number of scraper errors by type.",
 		},
-		[]string{"error_type"},
+		[]string{"domain", "error_type"},
+	)
+
+	pageItems := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "scraper_page_items",
+			Help:    "Items extracted per scraped HTML page.",
+			Buckets: []float64{0, 1, 5, 10, 20, 50, 100},
+		},
+		[]string{"domain"},
+	)
+	zeroItemPages := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scraper_zero_item_pages_total",
+			Help: "Scraped HTML pages that yielded no items.",
+		},
+		[]string{"domain"},
+	)
+	fillRatio := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scraper_field_fill_ratio",
+			Help: "Fraction of extracted items with the field populated.",
+		},
+		[]string{"domain", "field"},
+	)
+	extractionWarnings := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scraper_extraction_warnings_total",
+			Help: "Extraction health warnings raised after a crawl, by kind.",
+		},
+		[]string{"domain", "kind"},
 	)
 
-	registry.MustRegister(requests, requestDuration, itemsScraped, retries, errorsTotal)
+	registry.MustRegister(requests, requestDuration, itemsScraped, retries, errorsTotal,
+		pageItems, zeroItemPages, fillRatio, extractionWarnings)
 
 	return &Metrics{
 		Registry:          registry,
@@ -63,45 +103,79 @@ func NewMetrics() *Metrics {
 		ItemsScrapedTotal: itemsScraped,
 		RetriesTotal:      retries,
 		ErrorsTotal:       errorsTotal,
+
+		PageItems:               pageItems,
+		ZeroItemPagesTotal:      zeroItemPages,
+		FieldFillRatio:          fillRatio,
+		ExtractionWarningsTotal: extractionWarnings,
 	}
 }
 
 // IncRequest increments the requests total counter.
-func (m *Metrics) IncRequest(phase string) {
+func (m *Metrics) IncRequest(domain, phase string) {
 	if m == nil {
 		return
 	}
-	m.RequestsTotal.WithLabelValues(phase).Inc()
+	m.RequestsTotal.WithLabelValues(domain, phase).Inc()
 }
 
 // ObserveDuration records an HTTP request duration.
-func (m *Metrics) ObserveDuration(d time.Duration) {
+func (m *Metrics) ObserveDuration(domain string, d time.Duration) {
 	if m == nil {
 		return
 	}
-	m.RequestDuration.Observe(d.Seconds())
+	m.RequestDuration.WithLabelValues(domain).Observe(d.Seconds())
 }
 
 // IncItems increments the items scraped counter.
-func (m *Metrics) IncItems() {
+func (m *Metrics) IncItems(domain string) {
 	if m == nil {
 		return
 	}
-	m.ItemsScrapedTotal.Inc()
+	m.ItemsScrapedTotal.WithLabelValues(domain).Inc()
 }
 
 // IncRetries increments the retries counter.
-func (m *Metrics) IncRetries() {
+func (m *Metrics) IncRetries(domain string) {
 	if m == nil {
 		return
 	}
-	m.RetriesTotal.Inc()
+	m.RetriesTotal.WithLabelValues(domain).Inc()
 }
 
 // IncError increments the errors counter for a type label.
-func (m *Metrics) IncError(errorType string) {
+func (m *Metrics) IncError(domain, errorType string) {
+	if m == nil {
+		return
+	}
+	m.ErrorsTotal.WithLabelValues(domain, errorType).Inc()
+}
+
+// ObservePage records the number of items a scraped page yielded.
+func (m *Metrics) ObservePage(domain string, items int) {
+	if m == nil {
+		return
+	}
+	m.PageItems.WithLabelValues(domain).Observe(float64(items))
+	if items == 0 {
+		m.ZeroItemPagesTotal.WithLabelValues(domain).Inc()
+	}
+}
+
+// SetFillRates publishes the current per-field fill ratios for a domain.
+func (m *Metrics) SetFillRates(domain string, rates map[string]float64) {
+	if m == nil {
+		return
+	}
+	for field, rate := range rates {
+		m.FieldFillRatio.WithLabelValues(domain, field).Set(rate)
+	}
+}
+
+// IncExtractionWarning increments the extraction warnings counter.
+func (m *Metrics) IncExtractionWarning(domain, kind string) {
 	if m == nil {
 		return
 	}
-	m.ErrorsTotal.WithLabelValues(errorType).Inc()
+	m.ExtractionWarningsTotal.WithLabelValues(domain, kind).Inc()
 }
@@ -0,0 +1,72 @@
+package scraper
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+)
+
+// Profile describes where a site's catalog markup keeps each book field. All
+// selectors are evaluated relative to a single Product element.
+type Profile struct {
+	Name string
+	// Product selects one listing entry on a catalog page.
+	Product string
+	// Title selects the anchor carrying the book title and detail link. The
+	// title is read from TitleAttr, falling back to the anchor text.
+	Title     string
+	TitleAttr string
+	Price     string
+	// Rating selects the element whose second class names the rating word
+	// ("star-rating Three").
+	Rating string
+	// Availability lists selectors tried in order until one yields text.
+	Availability []string
+	Image        string
+	// Next selects the pagination link on the catalog page (document scope).
+	Next string
+	// StructuredData is the default schema.org handling for sites using this
+	// profile: "off", "fallback" or "primary".
+	StructuredData string
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]Profile{
+		config.DefaultProfile: {
+			Name:           config.DefaultProfile,
+			Product:        "article.product_pod",
+			Title:          "h3 a",
+			TitleAttr:      "title",
+			Price:          "p.price_color",
+			Rating:         "p.star-rating",
+			Availability:   []string{"p.instock.availability", "p.availability"},
+			Image:          "img",
+			Next:           "li.next a",
+			StructuredData: structuredFallback,
+		},
+	}
+)
+
+// RegisterProfile makes p available to sites by name, replacing any existing
+// profile with the same name.
+func RegisterProfile(p Profile) error {
+	if p.Name == "" || p.Product == "" || p.Title == "" {
+		return fmt.Errorf("profile requires a name, product and title selector")
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[p.Name] = p
+	return nil
+}
+
+func lookupProfile(name string) (Profile, error) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown extraction profile %q", name)
+	}
+	return p, nil
+}
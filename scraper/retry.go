@@ -16,6 +16,7 @@ type retryManager struct {
 	collector *colly.Collector
 	cfg       *config.Config
 	metrics   *Metrics
+	domain    string
 	ctx       context.Context
 
 	mu           sync.Mutex
@@ -25,13 +26,14 @@ type retryManager struct {
 	stopped      bool
 }
 
-func newRetryManager(collector *colly.Collector, cfg *config.Config, metrics *Metrics) *retryManager {
+func newRetryManager(collector *colly.Collector, cfg *config.Config, metrics *Metrics, domain string) *retryManager {
 	return &retryManager{
 		collector: collector,
 		cfg:       cfg,
 		attempts:  make(map[string]int),
 		timers:    make(map[string]*time.Timer),
 		metrics:   metrics,
+		domain:    domain,
 		ctx:       context.Background(),
 	}
 }
@@ -64,7 +66,7 @@ func (rm *retryManager) Schedule(url string) bool {
 	rm.attempts[url] = attempt
 	rm.totalRetries++
 	if rm.metrics != nil {
-		rm.metrics.IncRetries()
+		rm.metrics.IncRetries(rm.domain)
 	}
 
 	delay := rm.backoff(attempt)
@@ -136,6 +138,21 @@ func (rm *retryManager) Stop() {
 	}
 }
 
+// Attempts returns how many retries of url have been scheduled so far, i.e.
+// 0 for the first request.
+func (rm *retryManager) Attempts(url string) int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.attempts[url]
+}
+
+// Pending returns how many retries are waiting for their backoff to elapse.
+func (rm *retryManager) Pending() int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return len(rm.timers)
+}
+
 func (rm *retryManager) TotalRetries() int {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
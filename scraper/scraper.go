@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,6 +15,9 @@ import (
 	"github.com/aluiziolira/go-scrape-books/config"
 	"github.com/aluiziolira/go-scrape-books/models"
 	"github.com/gocolly/colly/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Sink receives books extracted from the page as they are scraped. It is
@@ -23,79 +27,197 @@ type Sink interface {
 	Process(books ...*models.Book) error
 }
 
-// Scraper wraps the colly collector and retry logic for the demo target.
+// ContextSink is a Sink that also accepts the context of the page a book came
+// from, so the hand-off shows up in that page's trace. The scraper uses it
+// when the sink provides it.
+type ContextSink interface {
+	Sink
+	ProcessContext(ctx context.Context, books ...*models.Book) error
+}
+
+// Scraper wraps one colly collector per configured site, together with the
+// retry logic for each.
 type Scraper struct {
-	cfg       *config.Config
-	collector *colly.Collector
-	retry     *retryManager
-	Metrics   *Metrics
+	cfg     *config.Config
+	sites   []*site
+	sink    Sink
+	Metrics *Metrics
+
+	mu sync.Mutex // guards every site's failedURLs/errorsByType
+
+	latency latencyRecorder
+
+	sinkErrLogged atomic.Bool
+	handlersOnce  sync.Once
+}
+
+// site is the per-domain crawl state: its own collector (so parallelism,
+// delays, user agent and robots policy are independent), retry budget,
+// extraction profile and counters.
+type site struct {
+	cfg        config.SiteConfig
+	profile    Profile
+	structured string
+	collector  *colly.Collector
+	retry      *retryManager
+	health     *healthTracker
 
 	requestCount int64
+	inFlight     int64
 	pageCount    int64
 	errorCount   int64
+	itemCount    int64
 
-	mu           sync.Mutex
 	failedURLs   []string
 	errorsByType map[string]int
-
-	sinkErrLogged atomic.Bool
-	handlersOnce  sync.Once
 }
 
 // NewScraper builds a scraper instance configured from cfg.
 func NewScraper(cfg *config.Config) (*Scraper, error) {
-	parsed, err := url.Parse(cfg.BaseURL)
+	return NewScraperWithMetrics(cfg, NewMetrics())
+}
+
+// NewScraperWithMetrics builds a scraper that records into metrics, so
+// several scrapers (e.g. the jobs of a long-running server) can share one
+// registry.
+func NewScraperWithMetrics(cfg *config.Config, metrics *Metrics) (*Scraper, error) {
+	s := &Scraper{
+		cfg:     cfg,
+		Metrics: metrics,
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.Timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	for _, siteCfg := range cfg.ResolvedSites() {
+		st, err := newSite(cfg, siteCfg, transport, s.Metrics)
+		if err != nil {
+			return nil, err
+		}
+		s.sites = append(s.sites, st)
+	}
+	return s, nil
+}
+
+func newSite(cfg *config.Config, siteCfg config.SiteConfig, transport http.RoundTripper, metrics *Metrics) (*site, error) {
+	parsed, err := url.Parse(siteCfg.BaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("parse base url: %w", err)
+		return nil, fmt.Errorf("site %s: parse base url: %w", siteCfg.Name, err)
 	}
 	if parsed.Host == "" {
-		return nil, fmt.Errorf("base url must include a host")
+		return nil, fmt.Errorf("site %s: base url must include a host", siteCfg.Name)
+	}
+	profile, err := lookupProfile(siteCfg.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("site %s: %w", siteCfg.Name, err)
 	}
 
 	collector := colly.NewCollector(
 		colly.Async(true),
 		colly.AllowedDomains(parsed.Hostname()),
-		colly.UserAgent(cfg.UserAgent),
+		colly.UserAgent(siteCfg.UserAgent),
 	)
 
 	collector.SetRequestTimeout(cfg.Timeout)
-	collector.IgnoreRobotsTxt = !cfg.RespectRobotsTxt
-	collector.WithTransport(&http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   cfg.Timeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		MaxIdleConns:        100,
-		IdleConnTimeout:     90 * time.Second,
-		TLSHandshakeTimeout: 10 * time.Second,
-	})
+	collector.IgnoreRobotsTxt = siteCfg.RespectRobotsTxt != nil && !*siteCfg.RespectRobotsTxt
+	collector.WithTransport(transport)
 
 	if err := collector.Limit(&colly.LimitRule{
 		DomainGlob:  "*",
-		Parallelism: cfg.Parallelism,
-		Delay:       cfg.Delay,
-		RandomDelay: cfg.RandomDelay,
+		Parallelism: siteCfg.Parallelism,
+		Delay:       siteCfg.Delay,
+		RandomDelay: siteCfg.RandomDelay,
 	}); err != nil {
-		return nil, fmt.Errorf("configure rate limits: %w", err)
+		return nil, fmt.Errorf("site %s: configure rate limits: %w", siteCfg.Name, err)
 	}
 
-	s := &Scraper{
-		cfg:          cfg,
+	structured := profile.StructuredData
+	if siteCfg.StructuredData != "" {
+		structured = siteCfg.StructuredData
+	}
+	if structured == "" {
+		structured = structuredOff
+	}
+
+	return &site{
+		cfg:          siteCfg,
+		profile:      profile,
+		structured:   structured,
 		collector:    collector,
+		retry:        newRetryManager(collector, cfg, metrics, siteCfg.Name),
+		health:       newHealthTracker(),
 		errorsByType: make(map[string]int),
-		Metrics:      NewMetrics(),
+	}, nil
+}
+
+// setTransport swaps the HTTP transport on every site's collector.
+func (s *Scraper) setTransport(rt http.RoundTripper) {
+	for _, st := range s.sites {
+		st.collector.WithTransport(rt)
 	}
-	s.retry = newRetryManager(collector, cfg, s.Metrics)
-	return s, nil
 }
 
-// Run starts the crawl and streams extracted books into sink.
+// Run starts the crawl of every configured site and streams extracted books
+// into sink.
 func (s *Scraper) Run(ctx context.Context, sink Sink) (*models.ScraperResult, error) {
+	seeds := make([]seed, 0, len(s.sites))
+	for _, st := range s.sites {
+		seeds = append(seeds, seed{site: st, url: st.cfg.BaseURL})
+	}
+	return s.crawl(ctx, sink, seeds)
+}
+
+// Replay crawls urls instead of the configured base URLs, e.g. to retry the
+// FailedURLs of an earlier run. Each URL is handled by the configured site
+// whose host it belongs to; pagination is followed as in Run.
+func (s *Scraper) Replay(ctx context.Context, sink Sink, urls []string) (*models.ScraperResult, error) {
+	seeds := make([]seed, 0, len(urls))
+	for _, raw := range urls {
+		st, err := s.siteFor(raw)
+		if err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seed{site: st, url: raw})
+	}
+	return s.crawl(ctx, sink, seeds)
+}
+
+// seed is a URL to visit first and the site that crawls it.
+type seed struct {
+	site *site
+	url  string
+}
+
+func (s *Scraper) siteFor(raw string) (*site, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse url %q: %w", raw, err)
+	}
+	for _, st := range s.sites {
+		if base, err := url.Parse(st.cfg.BaseURL); err == nil && base.Hostname() == parsed.Hostname() {
+			return st, nil
+		}
+	}
+	return nil, fmt.Errorf("no configured site for %s", raw)
+}
+
+func (s *Scraper) crawl(ctx context.Context, sink Sink, seeds []seed) (*models.ScraperResult, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	s.retry.SetContext(ctx)
+	ctx, span := tracer().Start(ctx, "scraper.crawl", trace.WithAttributes(attribute.Int("scraper.seeds", len(seeds))))
+	defer span.End()
+	for _, st := range s.sites {
+		st.retry.SetContext(ctx)
+	}
 	s.configureHandlers(ctx, sink)
 
 	start := time.Now()
@@ -105,159 +227,315 @@ func (s *Scraper) Run(ctx context.Context, sink Sink) (*models.ScraperResult, er
 	go func() {
 		select {
 		case <-ctx.Done():
-			s.collector.Wait()
-			s.retry.Stop()
+			s.wait()
 		case <-done:
 		}
 	}()
 
-	if err := s.collector.Visit(s.cfg.BaseURL); err != nil {
-		return nil, fmt.Errorf("initial visit: %w", err)
+	for _, sd := range seeds {
+		if err := sd.site.collector.Visit(sd.url); err != nil {
+			err = fmt.Errorf("initial visit of %s: %w", sd.url, err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
 	}
 
-	s.collector.Wait()
-	s.retry.Stop()
-
-	result := &models.ScraperResult{
-		StartTime:    start,
-		EndTime:      time.Now(),
-		ErrorCount:   int(atomic.LoadInt64(&s.errorCount)),
-		FailedURLs:   s.snapshotFailedURLs(),
-		ErrorsByType: s.snapshotErrors(),
-		RetryCount:   s.retry.TotalRetries(),
-		RequestCount: int(atomic.LoadInt64(&s.requestCount)),
-		PageCount:    int(atomic.LoadInt64(&s.pageCount)),
-	}
+	s.wait()
 
+	result := s.snapshot()
+	result.StartTime = start
+	result.EndTime = time.Now()
+	span.SetAttributes(
+		attribute.Int("scraper.requests", result.RequestCount),
+		attribute.Int("scraper.errors", result.ErrorCount),
+		attribute.Int("scraper.retries", result.RetryCount),
+	)
 	return result, nil
 }
 
-func (s *Scraper) configureHandlers(ctx context.Context, sink Sink) { //nolint:gocyclo // registers one branch per colly lifecycle callback
+// wait blocks until every collector is idle and then stops pending retries.
+func (s *Scraper) wait() {
+	for _, st := range s.sites {
+		st.collector.Wait()
+	}
+	for _, st := range s.sites {
+		st.retry.Stop()
+	}
+}
+
+func (s *Scraper) configureHandlers(ctx context.Context, sink Sink) {
 	s.handlersOnce.Do(func() {
-		s.collector.OnRequest(func(r *colly.Request) {
-			r.Ctx.Put("start", time.Now())
-			current := atomic.AddInt64(&s.requestCount, 1)
-			if s.Metrics != nil {
-				s.Metrics.IncRequest("started")
+		s.sink = sink
+		for _, st := range s.sites {
+			s.configureSite(ctx, st)
+		}
+	})
+}
+
+func (s *Scraper) configureSite(ctx context.Context, st *site) { //nolint:gocyclo // registers one branch per colly lifecycle callback
+	domain := st.cfg.Name
+
+	st.collector.OnRequest(func(r *colly.Request) {
+		r.Ctx.Put("start", time.Now())
+		_, span := tracer().Start(ctx, "scraper.request",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("scraper.domain", domain),
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.full", r.URL.String()),
+				attribute.Int("scraper.retry.attempt", st.retry.Attempts(r.URL.String())),
+				attribute.Int("scraper.retry.max", s.cfg.MaxRetries),
+			),
+		)
+		r.Ctx.Put(requestSpanCtxKey, span)
+		atomic.AddInt64(&st.inFlight, 1)
+		current := atomic.AddInt64(&st.requestCount, 1)
+		if s.Metrics != nil {
+			s.Metrics.IncRequest(domain, "started")
+		}
+		if current%50 == 0 {
+			slog.Debug("scraper request progress",
+				slog.String("domain", domain),
+				slog.Int64("requests", current),
+				slog.Int64("pages", atomic.LoadInt64(&st.pageCount)),
+				slog.String("url", r.URL.String()),
+			)
+		}
+	})
+
+	st.collector.OnResponse(func(r *colly.Response) {
+		span := spanFrom(r.Ctx, requestSpanCtxKey)
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", r.StatusCode),
+			attribute.Int("http.response.body.size", len(r.Body)),
+		)
+		if r.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, http.StatusText(r.StatusCode))
+		}
+		span.End()
+		_, extract := tracer().Start(ctx, "scraper.extract", trace.WithAttributes(
+			attribute.String("scraper.domain", domain),
+			attribute.String("url.full", r.Request.URL.String()),
+		))
+		r.Ctx.Put(extractSpanCtxKey, extract)
+
+		if r.StatusCode >= http.StatusBadRequest {
+			slog.Error("non-200 response",
+				slog.String("domain", domain),
+				slog.Int("status", r.StatusCode),
+				slog.String("url", r.Request.URL.String()),
+			)
+		}
+		latency, recorded := s.latency.observe(r.Ctx)
+		if recorded {
+			atomic.AddInt64(&st.inFlight, -1)
+		}
+		if s.Metrics != nil {
+			if r.StatusCode < http.StatusBadRequest {
+				s.Metrics.IncRequest(domain, "success")
+			} else {
+				s.Metrics.IncRequest(domain, "error")
 			}
-			if current%50 == 0 {
-				slog.Debug("scraper request progress",
-					slog.Int64("requests", current),
-					slog.Int64("pages", atomic.LoadInt64(&s.pageCount)),
-					slog.String("url", r.URL.String()),
-				)
+			if recorded {
+				s.Metrics.ObserveDuration(domain, latency)
 			}
-		})
+		}
+	})
 
-		s.collector.OnResponse(func(r *colly.Response) {
-			if r.StatusCode >= http.StatusBadRequest {
-				slog.Error("non-200 response",
-					slog.Int("status", r.StatusCode),
-					slog.String("url", r.Request.URL.String()),
-				)
+	st.collector.OnError(func(r *colly.Response, err error) {
+		atomic.AddInt64(&st.errorCount, 1)
+		statusCode := 0
+		if r != nil {
+			statusCode = r.StatusCode
+		}
+		classified := classifyError(err, statusCode)
+		category := errorTypeLabel(classified)
+
+		s.mu.Lock()
+		st.errorsByType[category]++
+		s.mu.Unlock()
+
+		url := ""
+		if r != nil && r.Request != nil && r.Request.URL != nil {
+			url = r.Request.URL.String()
+		}
+		slog.Error("request error",
+			slog.String("domain", domain),
+			slog.String("url", url),
+			slog.String("category", category),
+			slog.Any("error", err),
+		)
+		if r != nil {
+			if _, recorded := s.latency.observe(r.Ctx); recorded {
+				atomic.AddInt64(&st.inFlight, -1)
 			}
-			if s.Metrics != nil {
-				if r.StatusCode < http.StatusBadRequest {
-					s.Metrics.IncRequest("success")
-				} else {
-					s.Metrics.IncRequest("error")
-				}
-				if start, ok := r.Request.Ctx.GetAny("start").(time.Time); ok {
-					s.Metrics.ObserveDuration(time.Since(start))
-				}
+			span := spanFrom(r.Ctx, requestSpanCtxKey)
+			span.SetAttributes(attribute.String("scraper.error.category", category))
+			if statusCode != 0 {
+				span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
 			}
-		})
-
-		s.collector.OnError(func(r *colly.Response, err error) {
-			atomic.AddInt64(&s.errorCount, 1)
-			statusCode := 0
-			if r != nil {
-				statusCode = r.StatusCode
+			endSpan(r.Ctx, requestSpanCtxKey, err)
+		}
+		if s.Metrics != nil {
+			if r == nil || r.StatusCode == 0 {
+				s.Metrics.IncRequest(domain, "error")
 			}
-			classified := classifyError(err, statusCode)
-			category := errorTypeLabel(classified)
+			s.Metrics.IncError(domain, category)
+		}
 
+		if !st.retry.Schedule(url) {
 			s.mu.Lock()
-			s.errorsByType[category]++
+			st.failedURLs = append(st.failedURLs, url)
 			s.mu.Unlock()
+		}
+	})
 
-			url := ""
-			if r != nil && r.Request != nil && r.Request.URL != nil {
-				url = r.Request.URL.String()
-			}
-			slog.Error("request error",
-				slog.String("url", url),
-				slog.String("category", category),
-				slog.Any("error", err),
-			)
-			if s.Metrics != nil {
-				if r == nil || r.StatusCode == 0 {
-					s.Metrics.IncRequest("error")
-				}
-				s.Metrics.IncError(category)
-			}
-
-			if !s.retry.Schedule(url) {
-				s.mu.Lock()
-				s.failedURLs = append(s.failedURLs, url)
-				s.mu.Unlock()
+	if st.structured != structuredOff {
+		// Registered before the product callback so the page's schema.org
+		// data is on the context by the time products are extracted.
+		st.collector.OnHTML("html", func(e *colly.HTMLElement) {
+			books := parseStructuredData(e.DOM, e.Request.URL.String(), e.Request.AbsoluteURL)
+			if len(books) > 0 {
+				e.Request.Ctx.Put(structuredCtxKey, newStructuredPage(books))
 			}
 		})
-
-		s.collector.OnHTML("article.product_pod", func(e *colly.HTMLElement) {
-			book := extractBook(e)
-			if book == nil {
-				return
-			}
-			if s.Metrics != nil {
-				s.Metrics.IncItems()
-			}
-			if err := sink.Process(book); err != nil {
-				// Sink is an opaque interface, so the scraper can't tell a benign
-				// "shutting down" rejection from a genuine failure (e.g. a write
-				// error). Surface the first occurrence loudly and the rest at
-				// debug, instead of guessing from ctx state and risking either a
-				// real failure going unlogged or a burst of expected shutdown
-				// rejections flooding the logs.
-				if s.sinkErrLogged.CompareAndSwap(false, true) {
-					slog.Error("sink rejected book; further occurrences logged at debug", slog.Any("error", err))
-				} else {
-					slog.Debug("sink process error", slog.Any("error", err))
-				}
+		st.collector.OnScraped(func(r *colly.Response) {
+			page, _ := r.Ctx.GetAny(structuredCtxKey).(*structuredPage)
+			for _, book := range page.remaining() {
+				s.emit(r.Ctx, st, book)
 			}
 		})
+	}
 
-		s.collector.OnHTML("li.next a", func(e *colly.HTMLElement) {
-			currentPage := atomic.AddInt64(&s.pageCount, 1)
-			if currentPage >= int64(s.cfg.MaxPages) {
-				return
-			}
-			if ctx.Err() != nil {
-				return
-			}
-			link := e.Attr("href")
-			abs := e.Request.AbsoluteURL(link)
-			if err := s.collector.Visit(abs); err != nil {
-				slog.Debug("visit failed", slog.String("url", abs), slog.Any("error", err))
+	st.collector.OnHTML(st.profile.Product, func(e *colly.HTMLElement) {
+		book := extractBook(e, st.profile)
+		if book == nil {
+			return
+		}
+		page, _ := e.Request.Ctx.GetAny(structuredCtxKey).(*structuredPage)
+		if structured := page.take(book.URL); structured != nil {
+			if st.structured == structuredPrimary {
+				book = mergeBooks(structured, book)
+			} else {
+				book = mergeBooks(book, structured)
 			}
-		})
+		}
+		s.emit(e.Request.Ctx, st, book)
+	})
+
+	// Registered after the structured-data OnScraped so its leftovers count
+	// towards the page.
+	st.collector.OnScraped(func(r *colly.Response) {
+		defer endSpan(r.Ctx, extractSpanCtxKey, nil)
+		if r.Headers == nil || !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+			return
+		}
+		items, _ := r.Ctx.GetAny(pageItemsCtxKey).(int)
+		spanFrom(r.Ctx, extractSpanCtxKey).SetAttributes(attribute.Int("scraper.items", items))
+		st.health.observePage(r.Request.URL.String(), items)
+		if s.Metrics != nil {
+			s.Metrics.ObservePage(domain, items)
+			s.Metrics.SetFillRates(domain, st.health.fillRates())
+		}
+	})
+
+	if st.profile.Next == "" {
+		return
+	}
+	st.collector.OnHTML(st.profile.Next, func(e *colly.HTMLElement) {
+		currentPage := atomic.AddInt64(&st.pageCount, 1)
+		if currentPage >= int64(st.cfg.MaxPages) {
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		link := e.Attr("href")
+		abs := e.Request.AbsoluteURL(link)
+		if err := st.collector.Visit(abs); err != nil {
+			slog.Debug("visit failed", slog.String("domain", domain), slog.String("url", abs), slog.Any("error", err))
+		}
 	})
 }
 
-func (s *Scraper) snapshotFailedURLs() []string {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	out := make([]string, len(s.failedURLs))
-	copy(out, s.failedURLs)
-	return out
+// emit tags book with its site, records it for extraction health, and hands
+// it to the sink.
+func (s *Scraper) emit(ctx *colly.Context, st *site, book *models.Book) {
+	book.Source = st.cfg.Name
+	atomic.AddInt64(&st.itemCount, 1)
+	items, _ := ctx.GetAny(pageItemsCtxKey).(int)
+	ctx.Put(pageItemsCtxKey, items+1)
+	st.health.observeBook(book)
+	if s.Metrics != nil {
+		s.Metrics.IncItems(st.cfg.Name)
+	}
+	var err error
+	if cs, ok := s.sink.(ContextSink); ok {
+		err = cs.ProcessContext(spanContext(ctx, extractSpanCtxKey), book)
+	} else {
+		err = s.sink.Process(book)
+	}
+	if err != nil {
+		// Sink is an opaque interface, so the scraper can't tell a benign
+		// "shutting down" rejection from a genuine failure (e.g. a write
+		// error). Surface the first occurrence loudly and the rest at
+		// debug, instead of guessing from ctx state and risking either a
+		// real failure going unlogged or a burst of expected shutdown
+		// rejections flooding the logs.
+		if s.sinkErrLogged.CompareAndSwap(false, true) {
+			slog.Error("sink rejected book; further occurrences logged at debug", slog.Any("error", err))
+		} else {
+			slog.Debug("sink process error", slog.Any("error", err))
+		}
+	}
 }
 
-func (s *Scraper) snapshotErrors() map[string]int {
+// Progress returns the counters of the crawl so far. It is safe to call while
+// Run is in progress.
+func (s *Scraper) Progress() *models.ScraperResult {
+	return s.snapshot()
+}
+
+// snapshot aggregates the per-site counters into a ScraperResult with a
+// per-domain breakdown.
+func (s *Scraper) snapshot() *models.ScraperResult {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	out := make(map[string]int, len(s.errorsByType))
-	for k, v := range s.errorsByType {
-		out[k] = v
+
+	result := &models.ScraperResult{
+		FailedURLs:   []string{},
+		ErrorsByType: make(map[string]int),
+		Domains:      make(map[string]models.DomainResult, len(s.sites)),
+
+		RequestLatency: s.latency.summary(),
+	}
+	for _, st := range s.sites {
+		domain := models.DomainResult{
+			RequestCount:   int(atomic.LoadInt64(&st.requestCount)),
+			PageCount:      int(atomic.LoadInt64(&st.pageCount)),
+			ItemCount:      int(atomic.LoadInt64(&st.itemCount)),
+			ErrorCount:     int(atomic.LoadInt64(&st.errorCount)),
+			RetryCount:     st.retry.TotalRetries(),
+			InFlight:       int(atomic.LoadInt64(&st.inFlight)),
+			PendingRetries: st.retry.Pending(),
+			FailedURLs:     append([]string(nil), st.failedURLs...),
+			ErrorsByType:   make(map[string]int, len(st.errorsByType)),
+		}
+		st.health.fill(&domain)
+		for k, v := range st.errorsByType {
+			domain.ErrorsByType[k] = v
+			result.ErrorsByType[k] += v
+		}
+		result.Domains[st.cfg.Name] = domain
+
+		result.RequestCount += domain.RequestCount
+		result.PageCount += domain.PageCount
+		result.ErrorCount += domain.ErrorCount
+		result.RetryCount += domain.RetryCount
+		result.InFlight += domain.InFlight
+		result.PendingRetries += domain.PendingRetries
+		result.FailedURLs = append(result.FailedURLs, domain.FailedURLs...)
 	}
-	return out
+	return result
 }
@@ -16,6 +16,10 @@ import (
 	"github.com/aluiziolira/go-scrape-books/pipeline"
 	"github.com/gocolly/colly/v2"
 	"github.com/jarcoal/httpmock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestRetryManagerScheduleRespectsLimit(t *testing.T) {
@@ -24,7 +28,7 @@ func TestRetryManagerScheduleRespectsLimit(t *testing.T) {
 	cfg.RetryBackoff = time.Hour
 	cfg.RetryBackoffMax = time.Hour
 
-	rm := newRetryManager(colly.NewCollector(), cfg, NewMetrics())
+	rm := newRetryManager(colly.NewCollector(), cfg, NewMetrics(), "example.com")
 
 	if !rm.Schedule("http://example.com/page") {
 		t.Fatalf("first retry should be scheduled")
@@ -35,8 +39,14 @@ func TestRetryManagerScheduleRespectsLimit(t *testing.T) {
 	if rm.Schedule("http://example.com/page") {
 		t.Fatalf("third retry should not be scheduled")
 	}
+	if got := rm.Pending(); got != 1 {
+		t.Fatalf("pending retries = %d, want 1", got)
+	}
 
 	rm.Stop()
+	if got := rm.Pending(); got != 0 {
+		t.Fatalf("pending retries after stop = %d, want 0", got)
+	}
 	if got := rm.TotalRetries(); got != 2 {
 		t.Fatalf("total retries = %d, want 2", got)
 	}
@@ -47,7 +57,7 @@ func TestRetryManagerBackoffCapped(t *testing.T) {
 	cfg.RetryBackoff = 200 * time.Millisecond
 	cfg.RetryBackoffMax = 500 * time.Millisecond
 
-	rm := newRetryManager(colly.NewCollector(), cfg, NewMetrics())
+	rm := newRetryManager(colly.NewCollector(), cfg, NewMetrics(), "example.com")
 
 	delay := rm.backoff(4)
 	if delay > cfg.RetryBackoffMax {
@@ -111,7 +121,7 @@ func TestScraperHTTPStatusClassification(t *testing.T) {
 			if err != nil {
 				t.Fatalf("new scraper: %v", err)
 			}
-			s.collector.WithTransport(transport)
+			s.setTransport(transport)
 
 			writer := &collectingWriter{}
 			p := pipeline.NewPipeline(context.Background(), writer, cfg)
@@ -190,7 +200,7 @@ func TestScraper_Integration(t *testing.T) {
 	if err != nil {
 		t.Fatalf("new scraper: %v", err)
 	}
-	s.collector.WithTransport(transport)
+	s.setTransport(transport)
 
 	writer := &collectingWriter{}
 	p := pipeline.NewPipeline(context.Background(), writer, cfg)
@@ -207,6 +217,9 @@ func TestScraper_Integration(t *testing.T) {
 	if got := writer.Count(); got != 60 {
 		t.Fatalf("books=%d, want 60 (requests=%d errors=%d failed=%v)", got, result.RequestCount, result.ErrorCount, result.FailedURLs)
 	}
+	if result.InFlight != 0 || result.PendingRetries != 0 {
+		t.Fatalf("in flight=%d pending retries=%d after the crawl, want 0", result.InFlight, result.PendingRetries)
+	}
 
 	books := writer.All()
 	expectedURL := "http://example.test/catalogue/book-1/index.html"
@@ -234,6 +247,110 @@ func TestScraper_Integration(t *testing.T) {
 	}
 }
 
+func TestScraper_MultiSite(t *testing.T) {
+	robots := false
+	cfg := config.DefaultConfig()
+	cfg.RespectRobotsTxt = false
+	cfg.MaxPages = 5
+	cfg.Sites = []config.SiteConfig{
+		{BaseURL: "http://alpha.test/", MaxPages: 1},
+		{Name: "beta", BaseURL: "http://beta.test/", MaxPages: 2, Parallelism: 1, RespectRobotsTxt: &robots},
+	}
+
+	transport := httpmock.NewMockTransport()
+	transport.RegisterResponder("GET", "http://alpha.test/", htmlResponder(buildCatalogPage(1, true)))
+	transport.RegisterResponder("GET", "http://alpha.test/page-2.html", htmlResponder(buildCatalogPage(2, false)))
+	transport.RegisterResponder("GET", "http://beta.test/", htmlResponder(buildCatalogPage(3, true)))
+	transport.RegisterResponder("GET", "http://beta.test/page-4.html", htmlResponder(buildCatalogPage(4, false)))
+
+	s, err := NewScraper(cfg)
+	if err != nil {
+		t.Fatalf("new scraper: %v", err)
+	}
+	s.setTransport(transport)
+
+	writer := &collectingWriter{}
+	p := pipeline.NewPipeline(context.Background(), writer, cfg)
+	p.Start(2)
+
+	result, err := s.Run(context.Background(), p)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close pipeline: %v", err)
+	}
+
+	// alpha stops after its first page; beta follows one next link.
+	if got := writer.Count(); got != 60 {
+		t.Fatalf("books=%d, want 60", got)
+	}
+	sources := make(map[string]int)
+	for _, book := range writer.All() {
+		sources[book.Source]++
+	}
+	if sources["alpha.test"] != 20 || sources["beta"] != 40 {
+		t.Fatalf("books by source = %v, want alpha.test:20 beta:40", sources)
+	}
+
+	if got := result.Domains["alpha.test"].RequestCount; got != 1 {
+		t.Fatalf("alpha requests=%d, want 1", got)
+	}
+	if got := result.Domains["beta"].ItemCount; got != 40 {
+		t.Fatalf("beta items=%d, want 40", got)
+	}
+	if result.RequestCount != 3 {
+		t.Fatalf("total requests=%d, want 3", result.RequestCount)
+	}
+}
+
+func TestScraper_ReplayRoutesURLsToSites(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RespectRobotsTxt = false
+	cfg.Sites = []config.SiteConfig{
+		{BaseURL: "http://alpha.test/", MaxPages: 1},
+		{Name: "beta", BaseURL: "http://beta.test/", MaxPages: 1},
+	}
+
+	transport := httpmock.NewMockTransport()
+	transport.RegisterResponder("GET", "http://beta.test/page-9.html", htmlResponder(buildCatalogPage(9, false)))
+
+	s, err := NewScraper(cfg)
+	if err != nil {
+		t.Fatalf("new scraper: %v", err)
+	}
+	s.setTransport(transport)
+
+	writer := &collectingWriter{}
+	p := pipeline.NewPipeline(context.Background(), writer, cfg)
+	p.Start(1)
+
+	if _, err := s.Replay(context.Background(), p, []string{"http://gamma.test/"}); err == nil {
+		t.Fatal("expected error for a URL outside every configured site")
+	}
+	result, err := s.Replay(context.Background(), p, []string{"http://beta.test/page-9.html"})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close pipeline: %v", err)
+	}
+	if got := writer.Count(); got != 20 {
+		t.Fatalf("books=%d, want 20", got)
+	}
+	if result.Domains["beta"].RequestCount != 1 || result.Domains["alpha.test"].RequestCount != 0 {
+		t.Fatalf("unexpected per-site requests: %+v", result.Domains)
+	}
+}
+
+func TestNewScraper_UnknownProfile(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Sites = []config.SiteConfig{{BaseURL: "http://example.test/", Profile: "nope"}}
+	if _, err := NewScraper(cfg); err == nil || !strings.Contains(err.Error(), "unknown extraction profile") {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+}
+
 type benchWriter struct {
 	mu    sync.Mutex
 	count int
@@ -324,3 +441,82 @@ func buildCatalogPage(page int, hasNext bool) string {
 	builder.WriteString("</section></body></html>")
 	return builder.String()
 }
+
+func TestScraper_TracesRequestsAndExtraction(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	cfg := config.DefaultConfig()
+	cfg.BaseURL = "http://example.test/"
+	cfg.RespectRobotsTxt = false
+	cfg.MaxPages = 1
+	cfg.Parallelism = 2
+	cfg.MaxRetries = 1
+	cfg.RetryBackoff = time.Hour
+
+	broken, ok := "http://example.test/broken.html", "http://example.test/ok.html"
+	transport := httpmock.NewMockTransport()
+	transport.RegisterResponder("GET", broken, httpmock.NewStringResponder(http.StatusServiceUnavailable, ""))
+	transport.RegisterResponder("GET", ok, htmlResponder(buildCatalogPage(1, false)))
+
+	s, err := NewScraper(cfg)
+	if err != nil {
+		t.Fatalf("new scraper: %v", err)
+	}
+	s.setTransport(transport)
+	p := pipeline.NewPipeline(context.Background(), &collectingWriter{}, cfg)
+	p.Start(1)
+	if _, err := s.Replay(context.Background(), p, []string{broken, ok}); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close pipeline: %v", err)
+	}
+
+	byName := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		byName[span.Name()] = append(byName[span.Name()], span)
+	}
+	crawl := byName["scraper.crawl"]
+	if len(crawl) != 1 {
+		t.Fatalf("crawl spans = %d, want 1", len(crawl))
+	}
+
+	requests := map[any]sdktrace.ReadOnlySpan{}
+	for _, span := range byName["scraper.request"] {
+		if span.Parent().SpanID() != crawl[0].SpanContext().SpanID() {
+			t.Fatalf("request span not parented to the crawl span: %v", spanAttrs(span))
+		}
+		requests[spanAttrs(span)["url.full"]] = span
+	}
+	failed := requests[broken]
+	if failed == nil || failed.Status().Code != codes.Error {
+		t.Fatalf("failed request span = %v, want error status", failed)
+	}
+	attrs := spanAttrs(failed)
+	if attrs["scraper.retry.attempt"] != int64(0) || attrs["scraper.retry.max"] != int64(1) || attrs["http.response.status_code"] != int64(503) {
+		t.Fatalf("failed request span attributes = %v", attrs)
+	}
+	if requests[ok] == nil || requests[ok].Status().Code == codes.Error {
+		t.Fatalf("successful request span = %v", requests[ok])
+	}
+
+	extract := byName["scraper.extract"]
+	if len(extract) != 1 || spanAttrs(extract[0])["scraper.items"] != int64(20) {
+		t.Fatalf("extract spans = %d, want 1 with 20 items", len(extract))
+	}
+	enqueues := byName["pipeline.enqueue"]
+	if len(enqueues) != 20 || enqueues[0].Parent().SpanID() != extract[0].SpanContext().SpanID() {
+		t.Fatalf("enqueue spans = %d, want 20 parented to the extraction span", len(enqueues))
+	}
+}
+
+func spanAttrs(span sdktrace.ReadOnlySpan) map[string]any {
+	attrs := make(map[string]any)
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return attrs
+}
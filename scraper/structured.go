@@ -0,0 +1,333 @@
+package scraper
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aluiziolira/go-scrape-books/models"
+	"github.com/aluiziolira/go-scrape-books/parser"
+)
+
+// Structured data modes. In fallback mode CSS extraction wins and schema.org
+// data only fills the fields it left empty; in primary mode the precedence is
+// reversed. Either way, structured items with no matching CSS product (detail
+// pages, markup drift) are emitted on their own.
+const (
+	structuredOff      = "off"
+	structuredFallback = "fallback"
+	structuredPrimary  = "primary"
+)
+
+// structuredCtxKey stores the page's *structuredPage on the colly request
+// context between the document-level and per-product callbacks.
+const structuredCtxKey = "structured"
+
+// structuredPage holds the schema.org books found on one page, keyed by URL,
+// and tracks which of them were already merged into a CSS-extracted book.
+type structuredPage struct {
+	books    []*models.Book
+	byURL    map[string]*models.Book
+	consumed map[*models.Book]bool
+}
+
+func newStructuredPage(books []*models.Book) *structuredPage {
+	page := &structuredPage{
+		books:    books,
+		byURL:    make(map[string]*models.Book, len(books)),
+		consumed: make(map[*models.Book]bool),
+	}
+	for _, book := range books {
+		if _, ok := page.byURL[book.URL]; !ok {
+			page.byURL[book.URL] = book
+		}
+	}
+	return page
+}
+
+// take returns the structured book for url, marking it consumed.
+func (p *structuredPage) take(url string) *models.Book {
+	if p == nil {
+		return nil
+	}
+	book, ok := p.byURL[url]
+	if !ok {
+		return nil
+	}
+	p.consumed[book] = true
+	return book
+}
+
+// remaining returns the structured books no CSS product claimed.
+func (p *structuredPage) remaining() []*models.Book {
+	if p == nil {
+		return nil
+	}
+	var out []*models.Book
+	for _, book := range p.books {
+		if !p.consumed[book] {
+			out = append(out, book)
+		}
+	}
+	return out
+}
+
+// mergeBooks fills the empty fields of primary from secondary.
+func mergeBooks(primary, secondary *models.Book) *models.Book {
+	if secondary == nil {
+		return primary
+	}
+	if primary.Title == "" {
+		primary.Title = secondary.Title
+	}
+	if primary.Price == "" {
+		primary.Price = secondary.Price
+	}
+	if primary.Currency == "" {
+		primary.Currency = secondary.Currency
+	}
+	if primary.RatingText == "" {
+		primary.RatingText = secondary.RatingText
+	}
+	if primary.Availability == "" {
+		primary.Availability = secondary.Availability
+	}
+	if primary.ImageURL == "" {
+		primary.ImageURL = secondary.ImageURL
+	}
+	if primary.ISBN == "" {
+		primary.ISBN = secondary.ISBN
+	}
+	return primary
+}
+
+// parseStructuredData extracts schema.org Product/Book entities from the
+// JSON-LD scripts and microdata scopes under root. Relative URLs are resolved
+// with resolve; entities without a URL are attributed to pageURL.
+func parseStructuredData(root *goquery.Selection, pageURL string, resolve func(string) string) []*models.Book {
+	var books []*models.Book
+	add := func(book *models.Book) {
+		if book == nil || book.Title == "" {
+			return
+		}
+		if book.URL == "" {
+			book.URL = pageURL
+		} else {
+			book.URL = resolve(book.URL)
+		}
+		if book.ImageURL != "" {
+			book.ImageURL = resolve(book.ImageURL)
+		}
+		book.ScrapedAt = time.Now()
+		books = append(books, book)
+	}
+
+	root.Find(`script[type="application/ld+json"]`).Each(func(_ int, script *goquery.Selection) {
+		var doc any
+		if err := json.Unmarshal([]byte(script.Text()), &doc); err != nil {
+			return
+		}
+		walkJSONLD(doc, add)
+	})
+
+	root.Find("[itemscope][itemtype]").Each(func(_ int, scope *goquery.Selection) {
+		if isBookType(scope.AttrOr("itemtype", "")) {
+			add(microdataBook(scope))
+		}
+	})
+	return books
+}
+
+// walkJSONLD visits every Product/Book node in a JSON-LD document, descending
+// through arrays, @graph containers and ItemList entries.
+func walkJSONLD(node any, add func(*models.Book)) {
+	switch v := node.(type) {
+	case []any:
+		for _, item := range v {
+			walkJSONLD(item, add)
+		}
+	case map[string]any:
+		if graph, ok := v["@graph"]; ok {
+			walkJSONLD(graph, add)
+		}
+		if types := jsonStrings(v["@type"]); hasBookType(types) {
+			add(jsonLDBook(v))
+			return
+		}
+		if elements, ok := v["itemListElement"]; ok {
+			walkJSONLD(elements, add)
+		}
+		if item, ok := v["item"]; ok {
+			walkJSONLD(item, add)
+		}
+	}
+}
+
+func jsonLDBook(node map[string]any) *models.Book {
+	book := &models.Book{
+		Title:    strings.TrimSpace(jsonString(node["name"])),
+		URL:      jsonString(node["url"]),
+		ISBN:     jsonString(node["isbn"]),
+		ImageURL: jsonImage(node["image"]),
+	}
+	if offer := firstObject(node["offers"]); offer != nil {
+		book.Price = jsonString(offer["price"])
+		if book.Price == "" {
+			book.Price = jsonString(offer["lowPrice"])
+		}
+		book.Currency = jsonString(offer["priceCurrency"])
+		book.Availability = schemaAvailability(jsonString(offer["availability"]))
+	}
+	if rating := firstObject(node["aggregateRating"]); rating != nil {
+		book.RatingText = ratingWord(jsonString(rating["ratingValue"]), jsonString(rating["bestRating"]))
+	}
+	return book
+}
+
+func microdataBook(scope *goquery.Selection) *models.Book {
+	props := make(map[string]string)
+	scope.Find("[itemprop]").Each(func(_ int, el *goquery.Selection) {
+		// Skip properties that belong to a nested Product/Book scope; they
+		// are that entity's fields, not ours.
+		owner := el.ParentsFiltered("[itemscope][itemtype]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+			return isBookType(s.AttrOr("itemtype", ""))
+		}).First()
+		if owner.Length() == 0 || owner.Get(0) != scope.Get(0) {
+			return
+		}
+		for _, name := range strings.Fields(el.AttrOr("itemprop", "")) {
+			if _, seen := props[name]; !seen {
+				props[name] = microdataValue(el)
+			}
+		}
+	})
+
+	return &models.Book{
+		Title:        strings.TrimSpace(props["name"]),
+		URL:          props["url"],
+		Price:        props["price"],
+		Currency:     props["priceCurrency"],
+		RatingText:   ratingWord(props["ratingValue"], props["bestRating"]),
+		Availability: schemaAvailability(props["availability"]),
+		ImageURL:     props["image"],
+		ISBN:         props["isbn"],
+	}
+}
+
+func microdataValue(el *goquery.Selection) string {
+	for _, attr := range []string{"content", "href", "src"} {
+		if value, ok := el.Attr(attr); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return strings.TrimSpace(el.Text())
+}
+
+func isBookType(itemtype string) bool {
+	for _, t := range strings.Fields(itemtype) {
+		t = strings.TrimPrefix(strings.TrimPrefix(t, "https://"), "http://")
+		if t == "schema.org/Product" || t == "schema.org/Book" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBookType(types []string) bool {
+	for _, t := range types {
+		if t == "Product" || t == "Book" || isBookType(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ratingWord maps a schema.org rating onto the five-star word scale used by
+// the CSS extractor, rescaling when bestRating is not 5.
+func ratingWord(value, best string) string {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return ""
+	}
+	if b, err := strconv.ParseFloat(best, 64); err == nil && b > 0 && b != 5 {
+		v = v / b * 5
+	}
+	return parser.NumericToRating(v)
+}
+
+// schemaAvailability turns "https://schema.org/InStock" into "In stock".
+func schemaAvailability(value string) string {
+	value = value[strings.LastIndex(value, "/")+1:]
+	switch value {
+	case "InStock":
+		return "In stock"
+	case "OutOfStock":
+		return "Out of stock"
+	}
+	return value
+}
+
+func jsonString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case []any:
+		if len(t) > 0 {
+			return jsonString(t[0])
+		}
+	case map[string]any:
+		if id, ok := t["@id"]; ok {
+			return jsonString(id)
+		}
+	}
+	return ""
+}
+
+func jsonStrings(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func jsonImage(v any) string {
+	switch t := v.(type) {
+	case []any:
+		if len(t) > 0 {
+			return jsonImage(t[0])
+		}
+	case map[string]any:
+		if url := jsonString(t["url"]); url != "" {
+			return url
+		}
+		return jsonString(t["contentUrl"])
+	}
+	return jsonString(v)
+}
+
+func firstObject(v any) map[string]any {
+	switch t := v.(type) {
+	case map[string]any:
+		return t
+	case []any:
+		for _, item := range t {
+			if obj, ok := item.(map[string]any); ok {
+				return obj
+			}
+		}
+	}
+	return nil
+}
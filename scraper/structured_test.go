@@ -0,0 +1,182 @@
+package scraper
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aluiziolira/go-scrape-books/config"
+	"github.com/aluiziolira/go-scrape-books/pipeline"
+	"github.com/jarcoal/httpmock"
+)
+
+const jsonLDListing = `<script type="application/ld+json">
+{"@context":"https://schema.org","@type":"ItemList","itemListElement":[
+  {"@type":"ListItem","position":1,"item":{"@type":"Book","name":"Book 1","url":"catalogue/book-1/index.html",
+    "isbn":"9780000000001","image":{"@type":"ImageObject","url":"media/1.jpg"},
+    "offers":{"@type":"Offer","price":"11.50","priceCurrency":"GBP","availability":"https://schema.org/InStock"},
+    "aggregateRating":{"@type":"AggregateRating","ratingValue":8,"bestRating":10}}},
+  {"@type":"ListItem","position":2,"item":{"@type":["Product"],"name":"Book 2","url":"catalogue/book-2/index.html",
+    "offers":[{"@type":"Offer","price":12,"priceCurrency":"EUR"}],"aggregateRating":{"ratingValue":"5"}}}
+]}
+</script>`
+
+func parseHTML(t *testing.T, html string) []*structuredBookView {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("parse html: %v", err)
+	}
+	resolve := func(u string) string { return "http://example.test/" + strings.TrimPrefix(u, "/") }
+	books := parseStructuredData(doc.Selection, "http://example.test/page", resolve)
+	views := make([]*structuredBookView, 0, len(books))
+	for _, b := range books {
+		views = append(views, &structuredBookView{b.Title, b.URL, b.Price, b.Currency, b.RatingText, b.ImageURL, b.ISBN, b.Availability})
+	}
+	return views
+}
+
+type structuredBookView struct {
+	Title, URL, Price, Currency, Rating, Image, ISBN, Availability string
+}
+
+func TestParseStructuredData_JSONLD(t *testing.T) {
+	books := parseHTML(t, "<html><head>"+jsonLDListing+"</head><body></body></html>")
+	if len(books) != 2 {
+		t.Fatalf("books=%d, want 2", len(books))
+	}
+	want := structuredBookView{
+		Title:        "Book 1",
+		URL:          "http://example.test/catalogue/book-1/index.html",
+		Price:        "11.50",
+		Currency:     "GBP",
+		Rating:       "Four",
+		Image:        "http://example.test/media/1.jpg",
+		ISBN:         "9780000000001",
+		Availability: "In stock",
+	}
+	if *books[0] != want {
+		t.Fatalf("book 1 = %+v, want %+v", *books[0], want)
+	}
+	if books[1].Price != "12" || books[1].Currency != "EUR" {
+		t.Fatalf("book 2 offers = %+v", *books[1])
+	}
+}
+
+func TestParseStructuredData_GraphAndMissingURL(t *testing.T) {
+	html := `<script type="application/ld+json">{"@graph":[{"@type":"WebPage"},{"@type":"Book","name":"Detail"}]}</script>
+<script type="application/ld+json">{not json</script>`
+	books := parseHTML(t, html)
+	if len(books) != 1 || books[0].URL != "http://example.test/page" {
+		t.Fatalf("expected one book attributed to the page URL, got %+v", books)
+	}
+}
+
+func TestParseStructuredData_Microdata(t *testing.T) {
+	html := `<div itemscope itemtype="https://schema.org/Book">
+  <a itemprop="url" href="catalogue/m/index.html"><span itemprop="name">Micro Book</span></a>
+  <img itemprop="image" src="media/m.jpg">
+  <meta itemprop="isbn" content="123">
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <span itemprop="price" content="9.99">£9.99</span><meta itemprop="priceCurrency" content="GBP">
+  </div>
+  <div itemprop="aggregateRating" itemscope itemtype="https://schema.org/AggregateRating">
+    <span itemprop="ratingValue">3</span>
+  </div>
+  <div itemscope itemtype="https://schema.org/Product"><span itemprop="name">Nested</span></div>
+</div>`
+	books := parseHTML(t, html)
+	if len(books) != 2 {
+		t.Fatalf("books=%d, want 2 (outer and nested product)", len(books))
+	}
+	got := *books[0]
+	if got.Title != "Micro Book" || got.Price != "9.99" || got.Currency != "GBP" || got.Rating != "Three" ||
+		got.ISBN != "123" || got.URL != "http://example.test/catalogue/m/index.html" || got.Image != "http://example.test/media/m.jpg" {
+		t.Fatalf("unexpected microdata book: %+v", got)
+	}
+	if books[1].Title != "Nested" {
+		t.Fatalf("nested product name leaked or missing: %+v", *books[1])
+	}
+}
+
+func runStructuredCrawl(t *testing.T, mode, page string) *collectingWriter {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RespectRobotsTxt = false
+	cfg.Sites = []config.SiteConfig{{BaseURL: "http://example.test/", MaxPages: 1, StructuredData: mode}}
+
+	transport := httpmock.NewMockTransport()
+	transport.RegisterResponder("GET", "http://example.test/", htmlResponder(page))
+
+	s, err := NewScraper(cfg)
+	if err != nil {
+		t.Fatalf("new scraper: %v", err)
+	}
+	s.setTransport(transport)
+
+	writer := &collectingWriter{}
+	p := pipeline.NewPipeline(context.Background(), writer, cfg)
+	p.Start(1)
+	if _, err := s.Run(context.Background(), p); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close pipeline: %v", err)
+	}
+	return writer
+}
+
+func TestScraper_StructuredFallbackFillsMissingFields(t *testing.T) {
+	// Book 1's CSS markup lost its price and rating; Book 2 has no CSS entry.
+	page := `<html><head>` + jsonLDListing + `</head><body>
+<article class="product_pod"><h3><a href="catalogue/book-1/index.html" title="Book 1">Book 1</a></h3>
+<p class="instock availability">In stock (3 available)</p></article></body></html>`
+
+	writer := runStructuredCrawl(t, "fallback", page)
+	books := writer.All()
+	if len(books) != 2 {
+		t.Fatalf("books=%d, want 2", len(books))
+	}
+	for _, book := range books {
+		switch book.Title {
+		case "Book 1":
+			if book.PriceNumeric != 11.50 || book.RatingNumeric != 4 || book.ISBN != "9780000000001" {
+				t.Fatalf("book 1 not filled from JSON-LD: %+v", book)
+			}
+			if book.Availability != "In stock (3 available)" {
+				t.Fatalf("CSS availability should win in fallback mode, got %q", book.Availability)
+			}
+		case "Book 2":
+			if book.Currency != "EUR" {
+				t.Fatalf("book 2 currency = %q", book.Currency)
+			}
+		default:
+			t.Fatalf("unexpected book %q", book.Title)
+		}
+	}
+}
+
+func TestScraper_StructuredPrimaryPrefersSchemaData(t *testing.T) {
+	page := `<html><head>` + jsonLDListing + `</head><body>
+<article class="product_pod"><h3><a href="catalogue/book-1/index.html" title="Book 1">Book 1</a></h3>
+<p class="price_color">£99.00</p><p class="star-rating One"></p>
+<p class="instock availability">In stock (3 available)</p></article></body></html>`
+
+	writer := runStructuredCrawl(t, "primary", page)
+	for _, book := range writer.All() {
+		if book.Title == "Book 1" && (book.PriceNumeric != 11.50 || book.Availability != "In stock") {
+			t.Fatalf("primary mode should prefer JSON-LD values, got %+v", book)
+		}
+	}
+	if writer.Count() != 2 {
+		t.Fatalf("books=%d, want 2", writer.Count())
+	}
+}
+
+func TestScraper_StructuredOff(t *testing.T) {
+	page := `<html><head>` + jsonLDListing + `</head><body></body></html>`
+	if got := runStructuredCrawl(t, "off", page).Count(); got != 0 {
+		t.Fatalf("books=%d, want 0 with structured data disabled", got)
+	}
+}
@@ -0,0 +1,51 @@
+package scraper
+
+import (
+	"context"
+
+	"github.com/gocolly/colly/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer returns the scraper's tracer from the global tracer provider, which
+// is a no-op unless tracing has been configured. It is looked up on each use
+// so a provider installed after start-up still takes effect.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/aluiziolira/go-scrape-books/scraper")
+}
+
+// requestSpanCtxKey and extractSpanCtxKey carry the current request's
+// trace.Span between colly callbacks.
+const (
+	requestSpanCtxKey = "request_span"
+	extractSpanCtxKey = "extract_span"
+)
+
+// spanFrom returns the span stored under key on the colly context, or a
+// no-op span when there is none.
+func spanFrom(ctx *colly.Context, key string) trace.Span {
+	if ctx != nil {
+		if span, ok := ctx.GetAny(key).(trace.Span); ok {
+			return span
+		}
+	}
+	return trace.SpanFromContext(context.Background())
+}
+
+// spanContext returns a context carrying the span stored under key, so work
+// started from a colly callback can be parented to it.
+func spanContext(ctx *colly.Context, key string) context.Context {
+	return trace.ContextWithSpan(context.Background(), spanFrom(ctx, key))
+}
+
+// endSpan ends the span stored under key, marking it failed when err is set.
+func endSpan(ctx *colly.Context, key string, err error) {
+	span := spanFrom(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,90 @@
+// Package telemetry configures OpenTelemetry tracing. The scraper and
+// pipeline packages record spans on the global tracer provider; until Setup
+// installs an exporting provider those spans are no-ops.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ServiceName is the service.name resource attribute of exported spans.
+const ServiceName = "go-scrape-books"
+
+// ShutdownFunc flushes buffered spans and releases the exporter.
+type ShutdownFunc func(context.Context) error
+
+// newExporter builds the span exporter named by cfg.TraceExporter. The
+// returned closer, if any, is closed after the exporter has shut down.
+func newExporter(cfg *config.Config, stdout io.Writer) (sdktrace.SpanExporter, io.Closer, error) {
+	switch cfg.TraceExporter {
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(stdout))
+		if err != nil {
+			return nil, nil, fmt.Errorf("create stdout trace exporter: %w", err)
+		}
+		return exp, nil, nil
+	case "file":
+		if err := os.MkdirAll(filepath.Dir(cfg.TraceFile), 0o755); err != nil {
+			return nil, nil, fmt.Errorf("create trace file directory: %w", err)
+		}
+		f, err := os.Create(cfg.TraceFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, fmt.Errorf("create file trace exporter: %w", err)
+		}
+		return exp, f, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported trace exporter: %s", cfg.TraceExporter)
+	}
+}
+
+// Setup installs a global tracer provider that exports spans as configured
+// by cfg.TraceExporter; stdout is where the stdout exporter writes. With no
+// exporter configured it leaves tracing disabled. The returned function must
+// be called before exit to flush pending spans.
+func Setup(cfg *config.Config, stdout io.Writer) (ShutdownFunc, error) {
+	if cfg.TraceExporter == "" || cfg.TraceExporter == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, closer, err := newExporter(cfg, stdout)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("build trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		if err != nil {
+			return fmt.Errorf("shutdown tracing: %w", err)
+		}
+		return nil
+	}, nil
+}
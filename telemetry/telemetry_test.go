@@ -0,0 +1,90 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aluiziolira/go-scrape-books/config"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup_FileExporter(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	cfg := config.DefaultConfig()
+	cfg.TraceExporter = "file"
+	cfg.TraceFile = filepath.Join(t.TempDir(), "traces", "spans.jsonl")
+	shutdown, err := Setup(cfg, nil)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "unit")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	data, err := os.ReadFile(cfg.TraceFile)
+	if err != nil {
+		t.Fatalf("read trace file: %v", err)
+	}
+	var exported struct {
+		Name     string
+		Resource []struct {
+			Key   string
+			Value struct{ Value any }
+		}
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &exported); err != nil {
+		t.Fatalf("decode span: %v\n%s", err, data)
+	}
+	if exported.Name != "unit" {
+		t.Fatalf("span name = %q, want unit", exported.Name)
+	}
+	var service any
+	for _, kv := range exported.Resource {
+		if kv.Key == "service.name" {
+			service = kv.Value.Value
+		}
+	}
+	if service != ServiceName {
+		t.Fatalf("service.name = %v, want %s", service, ServiceName)
+	}
+}
+
+func TestSetup_StdoutAndNone(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	cfg := config.DefaultConfig()
+	shutdown, err := Setup(cfg, nil)
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Fatalf("setup with tracing disabled: %v", err)
+	}
+
+	var out bytes.Buffer
+	cfg.TraceExporter = "stdout"
+	shutdown, err = Setup(cfg, &out)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "to-stdout")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if !strings.Contains(out.String(), `"Name":"to-stdout"`) {
+		t.Fatalf("stdout exporter output = %s", out.String())
+	}
+
+	cfg.TraceExporter = "zipkin"
+	if _, err := Setup(cfg, nil); err == nil {
+		t.Fatal("expected an error for an unsupported exporter")
+	}
+}